@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"net/http"
+	"sync"
+)
+
+const (
+	// Default header carrying the API keys
+	ApiKeyHeader = "X-Api-Key"
+	// Authentication method of the API key principals
+	ApiKeyMethod = "api-key"
+)
+
+// Authenticator of the static API keys, sent in a request header. Keys are stored by their SHA-256 hash, so they
+// are not kept in memory, and the received keys are looked up by hash: lookup timing depends on the hash, not on
+// how much of the key matches
+type ApiKeyAuthenticator struct {
+	sync.RWMutex
+	header string
+	keys   map[[sha256.Size]byte]context.Principal
+}
+
+// Registers the given API key, granting the given principal name and roles
+func (a *ApiKeyAuthenticator) AddKey(key string, name string, roles ...string) {
+	defer a.Unlock()
+	a.Lock()
+	a.keys[sha256.Sum256([]byte(key))] = context.Principal{
+		Name:   name,
+		Roles:  append(make([]string, 0), roles...),
+		Method: ApiKeyMethod,
+	}
+}
+
+// Removes the given API key
+func (a *ApiKeyAuthenticator) RemoveKey(key string) {
+	defer a.Unlock()
+	a.Lock()
+	delete(a.keys, sha256.Sum256([]byte(key)))
+}
+
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (*context.Principal, error) {
+	var key = r.Header.Get(a.header)
+	if key == "" {
+		return nil, nil
+	}
+	a.RLock()
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	a.RUnlock()
+	if !ok {
+		return nil, model.ErrUnauthorized
+	}
+	return &principal, nil
+}
+
+func (a *ApiKeyAuthenticator) Challenge() string {
+	return ""
+}
+
+// Creates an API keys authenticator reading the keys from the given header (empty means ApiKeyHeader)
+func NewApiKeyAuthenticator(header string) *ApiKeyAuthenticator {
+	if header == "" {
+		header = ApiKeyHeader
+	}
+	return &ApiKeyAuthenticator{
+		header: header,
+		keys:   make(map[[sha256.Size]byte]context.Principal),
+	}
+}
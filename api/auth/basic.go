@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"sync"
+)
+
+const (
+	// Authentication method of the HTTP basic principals
+	BasicMethod = "basic"
+)
+
+// Describes the store of the users passwords hashes
+type PasswordStore interface {
+	// Returns the password hash and the principal of the given user, or false when the user is unknown
+	Lookup(username string) ([]byte, *context.Principal, bool)
+}
+
+// Hashes the given password with bcrypt, using the default cost
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+type storedUser struct {
+	hash      []byte
+	principal context.Principal
+}
+
+// In memory password store
+type MemoryPasswordStore struct {
+	sync.RWMutex
+	users map[string]storedUser
+}
+
+// Adds or replaces the given user with the given bcrypt password hash and roles
+func (s *MemoryPasswordStore) AddHashedUser(username string, hash []byte, roles ...string) {
+	defer s.Unlock()
+	s.Lock()
+	s.users[username] = storedUser{
+		hash: append(make([]byte, 0), hash...),
+		principal: context.Principal{
+			Name:   username,
+			Roles:  append(make([]string, 0), roles...),
+			Method: BasicMethod,
+		},
+	}
+}
+
+// Adds or replaces the given user, hashing the given password
+func (s *MemoryPasswordStore) AddUser(username string, password string, roles ...string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.AddHashedUser(username, hash, roles...)
+	return nil
+}
+
+// Removes the given user
+func (s *MemoryPasswordStore) RemoveUser(username string) {
+	defer s.Unlock()
+	s.Lock()
+	delete(s.users, username)
+}
+
+func (s *MemoryPasswordStore) Lookup(username string) ([]byte, *context.Principal, bool) {
+	defer s.RUnlock()
+	s.RLock()
+	user, ok := s.users[username]
+	if !ok {
+		return nil, nil, false
+	}
+	var principal = user.principal
+	return user.hash, &principal, true
+}
+
+// Creates an empty in memory password store
+func NewMemoryPasswordStore() *MemoryPasswordStore {
+	return &MemoryPasswordStore{
+		users: make(map[string]storedUser),
+	}
+}
+
+// Authenticator of the HTTP basic credentials, verified against the bcrypt password hashes of a password store
+type BasicAuthenticator struct {
+	realm     string
+	store     PasswordStore
+	dummyHash []byte
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*context.Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	hash, principal, found := a.store.Lookup(username)
+	if !found {
+		// Unknown users take the same time of the known ones
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, model.ErrUnauthorized
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil, model.ErrUnauthorized
+	}
+	return principal, nil
+}
+
+func (a *BasicAuthenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.realm)
+}
+
+// Creates an HTTP basic authenticator using the given password store. The realm is sent in the 401 Unauthorized
+// challenges
+func NewBasicAuthenticator(realm string, store PasswordStore) (*BasicAuthenticator, error) {
+	if store == nil {
+		return nil, errors.New(fmt.Sprint("Nil password store"))
+	}
+	dummyHash, err := HashPassword(model.GenerateSecureToken(16))
+	if err != nil {
+		return nil, err
+	}
+	return &BasicAuthenticator{
+		realm:     realm,
+		store:     store,
+		dummyHash: dummyHash,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"net/http"
+)
+
+// Authenticator of the verified client certificates of the TLS connections (mutual TLS). The server must
+// request and verify the client certificates, see ServerConfigBuilder.WithClientCaCert and WithClientAuth
+type CertificateAuthenticator struct {
+	mapper model.CertificateMapper
+}
+
+func (a *CertificateAuthenticator) Authenticate(r *http.Request) (*context.Principal, error) {
+	var peer = context.NewPeerCertificate(r.TLS)
+	if peer == nil {
+		return nil, nil
+	}
+	var roles []string
+	if a.mapper != nil {
+		var err error
+		if roles, err = a.mapper(peer); err != nil {
+			return nil, err
+		}
+	}
+	return peer.Principal(roles...), nil
+}
+
+func (a *CertificateAuthenticator) Challenge() string {
+	return ""
+}
+
+// Creates a client certificates authenticator, granting the roles returned by the given mapper
+// (eg.: model.SubjectRoles), nil means no roles
+func NewCertificateAuthenticator(mapper model.CertificateMapper) *CertificateAuthenticator {
+	return &CertificateAuthenticator{
+		mapper: mapper,
+	}
+}
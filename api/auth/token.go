@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Authentication method of the bearer token principals
+	BearerMethod = "bearer"
+)
+
+// Claims carried by the HMAC bearer tokens
+type TokenClaims struct {
+	// Token subject, the principal name
+	Subject string `json:"sub"`
+	// Granted roles
+	Roles []string `json:"roles,omitempty"`
+	// Issue time, in Unix seconds
+	IssuedAt int64 `json:"iat"`
+	// Expiration time, in Unix seconds (0 means no expiration)
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// Authenticator of the bearer tokens signed with HMAC-SHA256, sent in the Authorization header.
+// Tokens are made of the base64 url encoded JSON claims and signature, separated by a dot
+type HmacTokenAuthenticator struct {
+	secret []byte
+	realm  string
+}
+
+func (a *HmacTokenAuthenticator) sign(payload string) string {
+	var mac = hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issues a token for the given principal name and roles, expiring after the given time (0 means no expiration)
+func (a *HmacTokenAuthenticator) Issue(subject string, ttl time.Duration, roles ...string) (string, error) {
+	var now = time.Now()
+	var claims = TokenClaims{
+		Subject:  subject,
+		Roles:    roles,
+		IssuedAt: now.Unix(),
+	}
+	if ttl != 0 {
+		claims.ExpiresAt = now.Add(ttl).Unix()
+	}
+	data, err := json.Marshal(&claims)
+	if err != nil {
+		return "", err
+	}
+	var payload = base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + a.sign(payload), nil
+}
+
+// Verifies the given token signature and expiration, and returns its claims
+func (a *HmacTokenAuthenticator) Verify(token string) (*TokenClaims, error) {
+	var parts = strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errors.New(fmt.Sprint("Malformed bearer token"))
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(a.sign(parts[0]))) {
+		return nil, errors.New(fmt.Sprint("Invalid bearer token signature"))
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed bearer token claims: %v", err))
+	}
+	var claims TokenClaims
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed bearer token claims: %v", err))
+	}
+	if claims.ExpiresAt > 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New(fmt.Sprint("Expired bearer token"))
+	}
+	return &claims, nil
+}
+
+func (a *HmacTokenAuthenticator) Authenticate(r *http.Request) (*context.Principal, error) {
+	var token, ok = BearerToken(r)
+	if !ok || strings.Count(token, ".") != 1 {
+		// Tokens of other kinds (eg.: JWT) are left to the other authenticators
+		return nil, nil
+	}
+	claims, err := a.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &context.Principal{
+		Name:   claims.Subject,
+		Roles:  claims.Roles,
+		Method: BearerMethod,
+		Claims: map[string]interface{}{
+			"sub": claims.Subject,
+			"iat": claims.IssuedAt,
+			"exp": claims.ExpiresAt,
+		},
+	}, nil
+}
+
+func (a *HmacTokenAuthenticator) Challenge() string {
+	return BearerChallenge(a.realm)
+}
+
+// Returns the bearer token sent in the request Authorization header, and if it is present
+func BearerToken(r *http.Request) (string, bool) {
+	var header = r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	var token = strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// Returns the WWW-Authenticate challenge of the bearer token authenticators, for the given realm (empty means no realm)
+func BearerChallenge(realm string) string {
+	if realm == "" {
+		return "Bearer"
+	}
+	return fmt.Sprintf("Bearer realm=%q", realm)
+}
+
+// Creates a bearer tokens authenticator, signing and verifying the tokens with the given secret (at least 32 bytes
+// are suggested, eg.: a model.GenerateSecureToken(32) value). The realm is sent in the 401 Unauthorized challenges
+func NewHmacTokenAuthenticator(secret []byte, realm string) (*HmacTokenAuthenticator, error) {
+	if len(secret) == 0 {
+		return nil, errors.New(fmt.Sprint("Empty token secret"))
+	}
+	return &HmacTokenAuthenticator{
+		secret: append(make([]byte, 0), secret...),
+		realm:  realm,
+	}, nil
+}
+
+var _ model.Authenticator = &HmacTokenAuthenticator{}
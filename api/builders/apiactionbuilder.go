@@ -31,8 +31,11 @@ type apiAction struct{
 }
 
 func (action *apiAction) With(context context.ApiCallContext) model.ApiAction {
-	action.context = &context
-	return action
+	// A new action is returned, so concurrent requests don't share the same context
+	return &apiAction{
+		function: action.function,
+		context: &context,
+	}
 }
 
 func (action *apiAction) Do() error {
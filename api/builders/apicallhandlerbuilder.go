@@ -19,6 +19,13 @@ type ApiCallHandlerBuilder interface {
 	WithWebMethodHandling(method string, action model.ApiAction) ApiCallHandlerBuilder
 	// Associate an error channel, for creating a flow of errors from the request
 	WithErrorChannel(ch chan error) ApiCallHandlerBuilder
+	// Add middleware applied to all the web methods actions of the handler, in the given order.
+	// Handler middleware run after the server middleware and the authentication, just around the action function
+	WithMiddleware(middleware ...model.ApiMiddleware) ApiCallHandlerBuilder
+	// Require an authenticated principal for the given web method, granted at least one of the given roles
+	// (no roles means any authenticated principal). Requests without principal are answered with the
+	// 401 Unauthorized status, and the ones without the required roles with the 403 Forbidden status
+	WithRoles(method string, roles ...string) ApiCallHandlerBuilder
 	// Build the model.ApiCallHandler and report any error occurred during the build process
 	Build() (model.ApiCallHandler, error)
 }
@@ -28,6 +35,8 @@ type apiCallHandlerBuilder struct {
 	methods		map[string]model.ApiAction
 	errorHandling	bool
 	errCh			chan error
+	middleware		[]model.ApiMiddleware
+	roles			map[string][]string
 }
 
 func (b *apiCallHandlerBuilder) WithPath(path string) ApiCallHandlerBuilder {
@@ -48,6 +57,22 @@ func (b *apiCallHandlerBuilder) WithErrorChannel(ch chan error) ApiCallHandlerBu
 	return b
 }
 
+func (b *apiCallHandlerBuilder) WithMiddleware(middleware ...model.ApiMiddleware) ApiCallHandlerBuilder {
+	for _, m := range middleware {
+		if m != nil {
+			b.middleware = append(b.middleware, m)
+		}
+	}
+	return b
+}
+
+func (b *apiCallHandlerBuilder) WithRoles(method string, roles ...string) ApiCallHandlerBuilder {
+	if method != "" {
+		b.roles[strings.ToUpper(method)] = append(make([]string, 0), roles...)
+	}
+	return b
+}
+
 func (b *apiCallHandlerBuilder) Build() (model.ApiCallHandler, error) {
 	var err error
 	var methods = make([]string, 0)
@@ -67,6 +92,8 @@ func (b *apiCallHandlerBuilder) Build() (model.ApiCallHandler, error) {
 		errCh: b.errCh,
 		errorHandling: b.errorHandling,
 		handlerMap: make(map[string]interface{}),
+		middleware: append(make([]model.ApiMiddleware, 0), b.middleware...),
+		roles: b.roles,
 	}, err
 }
 
@@ -79,6 +106,10 @@ type  apiCallHandler struct {
 	errCh			chan error
 	handlerMap 		map[string]interface{}
 	serverMap 		*map[string]interface{}
+	middleware		[]model.ApiMiddleware
+	serverMiddleware	*[]model.ApiMiddleware
+	authenticators	*[]model.Authenticator
+	roles			map[string][]string
 	logger			log.Logger
 }
 
@@ -99,13 +130,61 @@ func (h *apiCallHandler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		context.Logger = h.logger
 		// Set up reference to Api  global server map cache element
 		context.ServerMap = h.serverMap
-		err := action.With(context).Do()
+		err := h.chain(action)(context)
 		if err != nil && h.errorHandling {
 			h.errCh <- err
 		}
 	}
 }
 
+// Composes server and handler middleware around the given action execution
+func (h *apiCallHandler) chain(action model.ApiAction) model.ApiActionFunction {
+	var middleware = make([]model.ApiMiddleware, 0)
+	if h.serverMiddleware != nil {
+		middleware = append(middleware, (*h.serverMiddleware)...)
+	}
+	// Handler middleware run after the authentication, so they can use the request principal
+	middleware = append(middleware, h.authorize)
+	middleware = append(middleware, h.middleware...)
+	return model.ChainApiMiddleware(func(c context2.ApiCallContext) error {
+		return action.With(c).Do()
+	}, middleware...)
+}
+
+// Authenticates the request with the server authenticators, and verifies the roles required by the web method
+func (h *apiCallHandler) authorize(next model.ApiActionFunction) model.ApiActionFunction {
+	return func(c context2.ApiCallContext) error {
+		var authenticators []model.Authenticator
+		if h.authenticators != nil {
+			authenticators = *h.authenticators
+		}
+		if c.Principal == nil && len(authenticators) > 0 {
+			principal, err := model.Authenticate(c.Request, authenticators...)
+			if err != nil {
+				if h.logger != nil {
+					h.logger.Warnf("ApiCallHandler.authorize() - Authentication of %s %s failed - Error: %v", c.Method, c.Path, err)
+				}
+				model.SubmitUnauthorized(c.ResponseWriter, authenticators...)
+				return model.ErrUnauthorized
+			}
+			c.Principal = principal
+		}
+		roles, ok := h.roles[c.Method]
+		if !ok {
+			return next(c)
+		}
+		if c.Principal == nil {
+			model.SubmitUnauthorized(c.ResponseWriter, authenticators...)
+			return model.ErrUnauthorized
+		}
+		if !c.Principal.HasAnyRole(roles...) {
+			http.Error(c.ResponseWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return model.ErrForbidden
+		}
+		return next(c)
+	}
+}
+
 func (h *apiCallHandler) GetPath() string {
 	return h.path
 }
@@ -118,9 +197,19 @@ func (h *apiCallHandler) SetServerMap(m *map[string]interface{}) {
 	h.serverMap = m
 }
 
+func (h *apiCallHandler) SetMiddleware(middleware *[]model.ApiMiddleware) {
+	h.serverMiddleware = middleware
+}
+
+func (h *apiCallHandler) SetAuthenticators(authenticators *[]model.Authenticator) {
+	h.authenticators = authenticators
+}
+
 func NewApiCallHandlerBuilder() ApiCallHandlerBuilder {
 	return &apiCallHandlerBuilder{
 		methods: make(map[string]model.ApiAction),
+		middleware: make([]model.ApiMiddleware, 0),
+		roles: make(map[string][]string),
 	}
 }
 
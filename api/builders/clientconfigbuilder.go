@@ -38,13 +38,18 @@ type ClientConfigBuilder interface {
 	WithClientSessionCache(cache tls.ClientSessionCache) ClientConfigBuilder
 	// Add more Cipher suites to the preset values : tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 	// tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-	// tls.TLS_RSA_WITH_AES_256_CBC_SHA
+	// tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	// tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 (HTTP/2 requires one of the last two)
 	MoreCipherSuites(cipherSuite uint16) ClientConfigBuilder
 	// Add more Curve Ids to the current TLS Curve Preferences, adding to the preset values : tls.CurveP521, tls.CurveP384,
 	// tls.CurveP256
 	MoreCurvePreferences(curve tls.CurveID) ClientConfigBuilder
 	// Set preference for Server Size Cipher Suite
 	WithPreferServerCipherSuites(preferServerCipherSuites bool)  ClientConfigBuilder
+	// Set up the retry policy of the client calls, by default calls are not retried
+	WithRetryPolicy(policy model.RetryPolicy) ClientConfigBuilder
+	// Set up the circuit breaker of the client calls, by default no circuit breaker is used
+	WithCircuitBreaker(policy model.CircuitBreakerPolicy) ClientConfigBuilder
 	// Build the model.ClientConfig and report any error occurred during the build process
 	Build() (model.ClientConfig, error)
 }
@@ -64,6 +69,8 @@ type clientConfigBuilder struct{
 	renegotiation 				tls.RenegotiationSupport
 	cache						tls.ClientSessionCache
 	preferServerCipherSuites 	bool
+	retry						*model.RetryPolicy
+	breaker						*model.CircuitBreakerPolicy
 }
 
 func (b *clientConfigBuilder) WithHost(protocol, address string, port int) ClientConfigBuilder {
@@ -91,7 +98,7 @@ func (b *clientConfigBuilder) MoreTLSCerts(certificate string, key string) Clien
 
 func (b *clientConfigBuilder) WithRootCaCert(certificate string) ClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -102,7 +109,7 @@ func (b *clientConfigBuilder) WithRootCaCert(certificate string) ClientConfigBui
 
 func (b *clientConfigBuilder) WithClientCaCert(certificate string) ClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -113,7 +120,7 @@ func (b *clientConfigBuilder) WithClientCaCert(certificate string) ClientConfigB
 
 func (b *clientConfigBuilder) MoreClientCaCerts(certificate string) ClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -124,7 +131,7 @@ func (b *clientConfigBuilder) MoreClientCaCerts(certificate string) ClientConfig
 
 func (b *clientConfigBuilder) MoreRootCaCerts(certificate string) ClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -171,6 +178,16 @@ func (b *clientConfigBuilder) WithPreferServerCipherSuites(preferServerCipherSui
 	return b
 }
 
+func (b *clientConfigBuilder) WithRetryPolicy(policy model.RetryPolicy) ClientConfigBuilder {
+	b.retry = &policy
+	return b
+}
+
+func (b *clientConfigBuilder) WithCircuitBreaker(policy model.CircuitBreakerPolicy) ClientConfigBuilder {
+	b.breaker = &policy
+	return b
+}
+
 func (b *clientConfigBuilder) MoreCurvePreferences(curve tls.CurveID) ClientConfigBuilder {
 	b.curvePref = append(b.curvePref, curve)
 	return b
@@ -186,6 +203,8 @@ func (b *clientConfigBuilder) Build() (model.ClientConfig, error) {
 		Host: b.address,
 		Port: b.port,
 		Protocol: b.protocol,
+		Retry: b.retry,
+		Breaker: b.breaker,
 		Config: &tls.Config{
 			ClientCAs: b.caPool,
 			Certificates: b.certificates,
@@ -211,6 +230,9 @@ func NewClientConfigBuilder() ClientConfigBuilder{
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 		},
 		curvePref: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
 		minVersion: tls.VersionTLS12,
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"github.com/hellgate75/go-network/common"
 	"github.com/hellgate75/go-network/model"
 	"golang.org/x/crypto/acme/autocert"
 	"io/ioutil"
@@ -13,6 +14,9 @@ import (
 type ServerConfigBuilder interface {
 	// Associate an host and a port to the builder workflow
 	WithHost(address string, port int) ServerConfigBuilder
+	// Set up the maximum size of the requests body in bytes (0 means model.DefaultMaxBodySize, a negative value
+	// means no limit), larger requests are answered with the 413 Request Entity Too Large status
+	WithMaxBodySize(size int64) ServerConfigBuilder
 	// Associate certificate and key files full path to the builder workflow
 	WithTLSCerts(certificate string, key string) ServerConfigBuilder
 	// Add some more certificate files to the certificate list to the builder workflow
@@ -22,8 +26,14 @@ type ServerConfigBuilder interface {
 	WithRootCaCert(certificate string) ServerConfigBuilder
 	// Add one client CA certificate files to the certificate list to the builder workflow
 	WithClientCaCert(certificate string) ServerConfigBuilder
+	// Set up the client certificates request and verification policy, by default the client certificates
+	// are required and verified when any client CA certificate is set up, otherwise they are not requested
+	WithClientAuth(clientAuth tls.ClientAuthType) ServerConfigBuilder
 	// Set up the certificate manager for the auto-scan of certificates for a folder
 	WithCertificateManager(dir string) ServerConfigBuilder
+	// Set up the source of the server certificates, reloaded when their files change and selected by the client
+	// requested server name (SNI), in place of the TLS certificates and the certificate manager
+	WithCertificateSource(source *common.CertificateSource) ServerConfigBuilder
 	// Add more root CA certificate files to the certificate list to the builder workflow
 	MoreClientCaCerts(certificate string) ServerConfigBuilder
 	// Add more client CA certificate files to the certificate list to the builder workflow
@@ -38,7 +48,8 @@ type ServerConfigBuilder interface {
 	WithClientSessionCache(cache tls.ClientSessionCache) ServerConfigBuilder
 	// Add more Cipher suites to the preset values : tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 	// tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-	// tls.TLS_RSA_WITH_AES_256_CBC_SHA
+	// tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	// tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 (HTTP/2 requires one of the last two)
 	MoreCipherSuites(cipherSuite uint16) ServerConfigBuilder
 	// Add more Curve Ids to the current TLS Curve Preferences, adding to the preset values : tls.CurveP521, tls.CurveP384,
 	// tls.CurveP256
@@ -52,6 +63,7 @@ type ServerConfigBuilder interface {
 type serverConfigBuilder struct{
 	address      				string
 	port         				int
+	maxBodySize					int64
 	certificate  				string
 	key          				string
 	caPool       				*x509.CertPool
@@ -65,6 +77,8 @@ type serverConfigBuilder struct{
 	renegotiation 				tls.RenegotiationSupport
 	cache						tls.ClientSessionCache
 	preferServerCipherSuites 	bool
+	clientAuth					*tls.ClientAuthType
+	certSource					*common.CertificateSource
 }
 
 func (b *serverConfigBuilder) WithHost(address string, port int) ServerConfigBuilder {
@@ -73,6 +87,11 @@ func (b *serverConfigBuilder) WithHost(address string, port int) ServerConfigBui
 	return b
 }
 
+func (b *serverConfigBuilder) WithMaxBodySize(size int64) ServerConfigBuilder {
+	b.maxBodySize = size
+	return b
+}
+
 func (b *serverConfigBuilder) WithTLSCerts(certificate string, key string) ServerConfigBuilder {
 	b.certificate=certificate
 	b.key=key
@@ -93,7 +112,7 @@ func (b *serverConfigBuilder) MoreTLSCerts(certificate string, key string) Serve
 
 func (b *serverConfigBuilder) WithRootCaCert(certificate string) ServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -104,7 +123,7 @@ func (b *serverConfigBuilder) WithRootCaCert(certificate string) ServerConfigBui
 
 func (b *serverConfigBuilder) WithClientCaCert(certificate string) ServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -115,7 +134,7 @@ func (b *serverConfigBuilder) WithClientCaCert(certificate string) ServerConfigB
 
 func (b *serverConfigBuilder) MoreClientCaCerts(certificate string) ServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -126,7 +145,7 @@ func (b *serverConfigBuilder) MoreClientCaCerts(certificate string) ServerConfig
 
 func (b *serverConfigBuilder) MoreRootCaCerts(certificate string) ServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -135,6 +154,16 @@ func (b *serverConfigBuilder) MoreRootCaCerts(certificate string) ServerConfigBu
 	return b
 }
 
+func (b *serverConfigBuilder) WithClientAuth(clientAuth tls.ClientAuthType) ServerConfigBuilder {
+	b.clientAuth = &clientAuth
+	return b
+}
+
+func (b *serverConfigBuilder) WithCertificateSource(source *common.CertificateSource) ServerConfigBuilder {
+	b.certSource = source
+	return b
+}
+
 func (b *serverConfigBuilder) WithCertificateManager(dir string) ServerConfigBuilder {
 	b.certManager = &autocert.Manager{
 		Prompt: autocert.AcceptTOS,
@@ -184,13 +213,21 @@ func (b *serverConfigBuilder) Build() (model.ServerConfig, error) {
 	if b.certManager != nil {
 		getCert = b.certManager.GetCertificate
 	}
-	return model.ServerConfig{
+	var clientAuth = tls.NoClientCert
+	if b.clientAuth != nil {
+		clientAuth = *b.clientAuth
+	} else if b.caPool != nil {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	var config = model.ServerConfig{
 		Host: b.address,
 		Port: b.port,
 		CertPath: b.certificate,
 		KeyPath: b.key,
+		MaxBodySize: b.maxBodySize,
 		Config: &tls.Config{
 			ClientCAs: b.caPool,
+			ClientAuth: clientAuth,
 			Certificates: b.certificates,
 			CipherSuites: b.cipherSuits,
 			InsecureSkipVerify: b.insecure,
@@ -203,7 +240,13 @@ func (b *serverConfigBuilder) Build() (model.ServerConfig, error) {
 			Rand: rand.Reader,
 			Renegotiation: b.renegotiation,
 		},
-	}, err
+	}
+	if b.certSource != nil {
+		// Certificate files are served by the source
+		config.CertPath, config.KeyPath = "", ""
+		b.certSource.ApplyTo(config.Config)
+	}
+	return config, err
 }
 
 func NewServerConfigBuilder() ServerConfigBuilder{
@@ -214,6 +257,9 @@ func NewServerConfigBuilder() ServerConfigBuilder{
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 		},
 		curvePref: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
 		minVersion: tls.VersionTLS12,
@@ -0,0 +1,293 @@
+package builders
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/model/encoding"
+	"net/http"
+	"time"
+)
+
+// Helper for creating a new model.WebSocketHandler
+type WebSocketHandlerBuilder interface {
+	// Define mandatory path in various formats (eg.: /path/ or /path/{var} etc...)
+	// accordingly to the gorilla mux Router specifications
+	WithPath(path string) WebSocketHandlerBuilder
+	// Associate the function handling the upgraded connections, without function the connections are kept open
+	// until the peer or the server closes them (eg.: push only connections receiving the hub broadcasts)
+	With(function model.WebSocketFunction) WebSocketHandlerBuilder
+	// Associate the messages encoding (default: encoding.EncodingJSONFormat)
+	WithEncoding(enc encoding.Encoding) WebSocketHandlerBuilder
+	// Associate the hub the connections join, it can be shared by multiple handlers (default: a new hub)
+	WithHub(hub *context2.WebSocketHub) WebSocketHandlerBuilder
+	// Set up the ping interval and the maximum time waiting for any message or pong after a ping
+	// (0 means twice the ping interval), before closing the connection
+	WithPing(interval time.Duration, pongTimeout time.Duration) WebSocketHandlerBuilder
+	// Set up the maximum time for writing a message (0 means no timeout)
+	WithWriteTimeout(timeout time.Duration) WebSocketHandlerBuilder
+	// Set up the maximum size in bytes of a received message (0 means no limit)
+	WithReadLimit(limit int64) WebSocketHandlerBuilder
+	// Associate the function accepting the request Origin header, by default only the requests
+	// from the same host are accepted
+	WithCheckOrigin(checkOrigin func(r *http.Request) bool) WebSocketHandlerBuilder
+	// Associate an error channel, for creating a flow of errors from the connections
+	WithErrorChannel(ch chan error) WebSocketHandlerBuilder
+	// Add middleware applied to the upgrade request, in the given order.
+	// Handler middleware run after the server middleware and the authentication, just around the connection
+	// upgrade and function
+	WithMiddleware(middleware ...model.ApiMiddleware) WebSocketHandlerBuilder
+	// Require an authenticated principal for the upgrade requests, granted at least one of the given roles
+	// (no roles means any authenticated principal). Requests without principal are answered with the
+	// 401 Unauthorized status, and the ones without the required roles with the 403 Forbidden status
+	WithRoles(roles ...string) WebSocketHandlerBuilder
+	// Build the model.WebSocketHandler and report any error occurred during the build process
+	Build() (model.WebSocketHandler, error)
+}
+
+type webSocketHandlerBuilder struct {
+	path          string
+	function      model.WebSocketFunction
+	enc           encoding.Encoding
+	hub           *context2.WebSocketHub
+	options       context2.WebSocketOptions
+	readLimit     int64
+	checkOrigin   func(r *http.Request) bool
+	errorHandling bool
+	errCh         chan error
+	middleware    []model.ApiMiddleware
+	roles         []string
+}
+
+func (b *webSocketHandlerBuilder) WithPath(path string) WebSocketHandlerBuilder {
+	b.path = path
+	return b
+}
+
+func (b *webSocketHandlerBuilder) With(function model.WebSocketFunction) WebSocketHandlerBuilder {
+	b.function = function
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithEncoding(enc encoding.Encoding) WebSocketHandlerBuilder {
+	b.enc = enc
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithHub(hub *context2.WebSocketHub) WebSocketHandlerBuilder {
+	b.hub = hub
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithPing(interval time.Duration, pongTimeout time.Duration) WebSocketHandlerBuilder {
+	b.options.PingInterval = interval
+	b.options.PongTimeout = pongTimeout
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithWriteTimeout(timeout time.Duration) WebSocketHandlerBuilder {
+	b.options.WriteTimeout = timeout
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithReadLimit(limit int64) WebSocketHandlerBuilder {
+	b.readLimit = limit
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithCheckOrigin(checkOrigin func(r *http.Request) bool) WebSocketHandlerBuilder {
+	b.checkOrigin = checkOrigin
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithErrorChannel(ch chan error) WebSocketHandlerBuilder {
+	b.errorHandling = true
+	b.errCh = ch
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithMiddleware(middleware ...model.ApiMiddleware) WebSocketHandlerBuilder {
+	for _, m := range middleware {
+		if m != nil {
+			b.middleware = append(b.middleware, m)
+		}
+	}
+	return b
+}
+
+func (b *webSocketHandlerBuilder) WithRoles(roles ...string) WebSocketHandlerBuilder {
+	b.roles = append(make([]string, 0), roles...)
+	return b
+}
+
+func (b *webSocketHandlerBuilder) Build() (model.WebSocketHandler, error) {
+	var err error
+	if len(b.path) == 0 {
+		err = errors.New(fmt.Sprint("Empty path found"))
+	}
+	var hub = b.hub
+	if hub == nil {
+		hub = context2.NewWebSocketHub()
+	}
+	return &webSocketHandler{
+		path:      b.path,
+		function:  b.function,
+		enc:       b.enc,
+		hub:       hub,
+		options:   b.options,
+		readLimit: b.readLimit,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: b.checkOrigin,
+		},
+		errCh:         b.errCh,
+		errorHandling: b.errorHandling,
+		handlerMap:    make(map[string]interface{}),
+		middleware:    append(make([]model.ApiMiddleware, 0), b.middleware...),
+		roles:         b.roles,
+	}, err
+}
+
+type webSocketHandler struct {
+	path             string
+	function         model.WebSocketFunction
+	enc              encoding.Encoding
+	hub              *context2.WebSocketHub
+	options          context2.WebSocketOptions
+	readLimit        int64
+	upgrader         websocket.Upgrader
+	errorHandling    bool
+	errCh            chan error
+	handlerMap       map[string]interface{}
+	serverMap        *map[string]interface{}
+	middleware       []model.ApiMiddleware
+	serverMiddleware *[]model.ApiMiddleware
+	authenticators   *[]model.Authenticator
+	roles            []string
+	logger           log.Logger
+}
+
+func (h *webSocketHandler) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	context := context2.NewApiCallContext(w, r)
+	context.HandlerMap = &h.handlerMap
+	context.Logger = h.logger
+	context.ServerMap = h.serverMap
+	var middleware = make([]model.ApiMiddleware, 0)
+	if h.serverMiddleware != nil {
+		middleware = append(middleware, (*h.serverMiddleware)...)
+	}
+	// Handler middleware run after the authentication, so they can use the request principal
+	middleware = append(middleware, h.authorize)
+	middleware = append(middleware, h.middleware...)
+	err := model.ChainApiMiddleware(h.serve, middleware...)(context)
+	if err != nil && h.errorHandling {
+		h.errCh <- err
+	}
+}
+
+// Authenticates the upgrade request with the server authenticators, and verifies the required roles,
+// before the connection upgrade
+func (h *webSocketHandler) authorize(next model.ApiActionFunction) model.ApiActionFunction {
+	return func(c context2.ApiCallContext) error {
+		var authenticators []model.Authenticator
+		if h.authenticators != nil {
+			authenticators = *h.authenticators
+		}
+		if c.Principal == nil && len(authenticators) > 0 {
+			principal, err := model.Authenticate(c.Request, authenticators...)
+			if err != nil {
+				if h.logger != nil {
+					h.logger.Warnf("WebSocketHandler.authorize() - Authentication of path %s failed - Error: %v", c.Path, err)
+				}
+				model.SubmitUnauthorized(c.ResponseWriter, authenticators...)
+				return model.ErrUnauthorized
+			}
+			c.Principal = principal
+		}
+		if h.roles == nil {
+			return next(c)
+		}
+		if c.Principal == nil {
+			model.SubmitUnauthorized(c.ResponseWriter, authenticators...)
+			return model.ErrUnauthorized
+		}
+		if !c.Principal.HasAnyRole(h.roles...) {
+			http.Error(c.ResponseWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return model.ErrForbidden
+		}
+		return next(c)
+	}
+}
+
+// Upgrades the request connection, then runs the handler function until it returns or the connection is closed
+func (h *webSocketHandler) serve(c context2.ApiCallContext) error {
+	conn, err := h.upgrader.Upgrade(c.ResponseWriter, c.Request, nil)
+	if err != nil {
+		// The upgrader already answered the request with the error status
+		if h.logger != nil {
+			h.logger.Warnf("WebSocketHandler.serve() - Upgrade of path %s failed - Error: %v", c.Path, err)
+		}
+		return err
+	}
+	if h.readLimit > 0 {
+		conn.SetReadLimit(h.readLimit)
+	}
+	var enc = h.enc
+	if enc == encoding.EncodingUNKNOWNFormat {
+		enc = encoding.EncodingJSONFormat
+	}
+	var ws = context2.NewWebSocketContext(conn, c.Request, enc, h.options)
+	ws.Id = c.Id
+	ws.HandlerMap = c.HandlerMap
+	ws.ServerMap = c.ServerMap
+	ws.Logger = c.Logger
+	ws.Hub = h.hub
+	ws.Principal = c.Principal
+	h.hub.Join(&ws)
+	defer h.hub.Leave(&ws)
+	if h.function == nil {
+		<-ws.Context().Done()
+		_ = ws.Close(websocket.CloseNormalClosure, "")
+		return nil
+	}
+	err = h.function(ws)
+	if err != nil {
+		_ = ws.Close(websocket.CloseInternalServerErr, "")
+	} else {
+		_ = ws.Close(websocket.CloseNormalClosure, "")
+	}
+	return err
+}
+
+func (h *webSocketHandler) GetPath() string {
+	return h.path
+}
+
+func (h *webSocketHandler) Hub() *context2.WebSocketHub {
+	return h.hub
+}
+
+func (h *webSocketHandler) SetLogger(logger log.Logger) {
+	h.logger = logger
+}
+
+func (h *webSocketHandler) SetServerMap(m *map[string]interface{}) {
+	h.serverMap = m
+}
+
+func (h *webSocketHandler) SetMiddleware(middleware *[]model.ApiMiddleware) {
+	h.serverMiddleware = middleware
+}
+
+func (h *webSocketHandler) SetAuthenticators(authenticators *[]model.Authenticator) {
+	h.authenticators = authenticators
+}
+
+func NewWebSocketHandlerBuilder() WebSocketHandlerBuilder {
+	return &webSocketHandlerBuilder{
+		enc:        encoding.EncodingJSONFormat,
+		middleware: make([]model.ApiMiddleware, 0),
+	}
+}
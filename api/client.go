@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	io2 "github.com/hellgate75/go-network/io"
@@ -17,6 +18,7 @@ type apiClient struct{
 	config 			*model.ClientConfig
 	cli				*http.Client
 	baseUrl			string
+	breaker			*circuitBreaker
 	logger			log.Logger
 }
 
@@ -28,9 +30,19 @@ func (c *apiClient) Connect(config model.ClientConfig) error {
 	}
 	c.cli = &http.Client{
 	}
+	if c.config.Config != nil {
+		// Client certificates and trusted root CAs of the Security Configuration apply to https calls
+		var transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.config.Config
+		c.cli.Transport = transport
+	}
 	if c.config.Timeout > 0 {
 		c.cli.Timeout = c.config.Timeout
 	}
+	c.breaker = nil
+	if c.config.Breaker != nil && c.config.Breaker.FailureThreshold > 0 {
+		c.breaker = newCircuitBreaker(*c.config.Breaker)
+	}
 	c.baseUrl = fmt.Sprintf("%s://%s:%v", c.config.Protocol, c.config.Host, c.config.Port)
 	c.logger.Debugf("Created default base url: %s", c.baseUrl)
 	return nil
@@ -38,39 +50,59 @@ func (c *apiClient) Connect(config model.ClientConfig) error {
 
 
 func (c *apiClient) Call(path string, method string, contentType *encoding.MimeType, accepts *encoding.MimeType, body io.Reader) (*http.Response, error) {
+	return c.CallContext(context.Background(), path, method, contentType, accepts, body)
+}
+
+func (c *apiClient) CallContext(ctx context.Context, path string, method string, contentType *encoding.MimeType, accepts *encoding.MimeType, body io.Reader) (*http.Response, error) {
 	if c.cli == nil {
 		c.logger.Fatal("Client is not connected to a server socket")
 		return nil, errors.New(fmt.Sprint("Client is not connected to a server socket"))
 	}
 	var err error
-	var out *http.Response
-	var r *http.Request
+	var data []byte
 	var url = fmt.Sprintf("%s%s", c.baseUrl, path)
-	c.logger.Debugf("Creating request with url: %s, and web method: %s ...", url, method)
-	r, err = http.NewRequest(method, url, body)
-	if err != nil {
-		c.logger.Errorf("Error creating the request: %v", err)
-		return out, err
-	}
-	if contentType != nil {
-		c.logger.Debugf("Adding Content Type Header: %s", string(*contentType))
-		r.Header.Add("Content-Type", string(*contentType))
-	}
-	if accepts != nil {
-		c.logger.Debugf("Adding Accepts Header: %s", string(*accepts))
-		r.Header.Add("Accepts", string(*accepts))
+	if body != nil && maxAttempts(c.config.Retry, method) > 1 {
+		// Body must be sent again on retries
+		data, err = ioutil.ReadAll(body)
+		if err != nil {
+			c.logger.Errorf("Error reading the request body: %v", err)
+			return nil, err
+		}
 	}
-	c.logger.Debug("Running the client handler using out request ...")
-	return c.cli.Do(r)
+	return c.send(ctx, method, func() (*http.Request, error) {
+		var reader = body
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+		c.logger.Debugf("Creating request with url: %s, and web method: %s ...", url, method)
+		r, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			c.logger.Errorf("Error creating the request: %v", err)
+			return nil, err
+		}
+		if contentType != nil {
+			c.logger.Debugf("Adding Content Type Header: %s", string(*contentType))
+			r.Header.Add("Content-Type", string(*contentType))
+		}
+		if accepts != nil {
+			c.logger.Debugf("Adding Accept Header: %s", string(*accepts))
+			r.Header.Add("Accept", string(*accepts))
+		}
+		c.logger.Debug("Running the client handler using out request ...")
+		return r, nil
+	})
 }
 
 func (c *apiClient) Encode(path string, method string, contentType encoding.MimeType, accepts *encoding.MimeType, request interface{}, response interface{}) error {
+	return c.EncodeContext(context.Background(), path, method, contentType, accepts, request, response)
+}
+
+func (c *apiClient) EncodeContext(ctx context.Context, path string, method string, contentType encoding.MimeType, accepts *encoding.MimeType, request interface{}, response interface{}) error {
 	if c.cli == nil {
 		c.logger.Fatal("Client is not connected to a server socket")
 		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
 	}
 	var err error
-	var r *http.Request
 	var data []byte
 	var url = fmt.Sprintf("%s%s", c.baseUrl, path)
 	c.logger.Debugf("Creating request with url: %s, and web method: %s ...", url, method)
@@ -80,35 +112,82 @@ func (c *apiClient) Encode(path string, method string, contentType encoding.Mime
 		c.logger.Errorf("Error parsing the request mime type to encoding.Encoding: %v", err)
 		return err
 	}
-	r, err = http.NewRequest(method, url, bytes.NewBuffer(data))
+	resp, err := c.send(ctx, method, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+		if err != nil {
+			c.logger.Errorf("Error creating the request: %v", err)
+			return nil, err
+		}
+		if string(contentType) != "" {
+			c.logger.Debugf("Adding Content Type Header: %s", string(contentType))
+			r.Header.Add("Content-Type", string(contentType))
+		}
+		if accepts != nil {
+			c.logger.Debugf("Adding Accept Header: %s", string(*accepts))
+			r.Header.Add("Accept", string(*accepts))
+		}
+		c.logger.Debug("Running the client handler using out request ...")
+		return r, nil
+	})
 	if err != nil {
-		c.logger.Errorf("Error creating the request: %v", err)
-		return err
-	}
-	if string(contentType) != "" {
-		c.logger.Debugf("Adding Content Type Header: %s", string(contentType))
-		r.Header.Add("Content-Type", string(contentType))
+		c.logger.Errorf("Error sending the request: %v", err)
+		if err == model.ErrCircuitOpen {
+			return err
+		}
+		return errors.New(fmt.Sprintf("Error sending the request: %v", err))
 	}
+	var responseMime encoding.MimeType
 	if accepts != nil {
-		c.logger.Debugf("Adding Accepts Header: %s", string(*accepts))
-		r.Header.Add("Accepts", string(*accepts))
+		responseMime = *accepts
 	}
-	c.logger.Debug("Running the client handler using out request ...")
-	resp, err :=  c.cli.Do(r)
+	err = readResponse(resp, responseMime, response)
 	if err != nil {
-		c.logger.Errorf("Error sending the request: %v", err)
-		return errors.New(fmt.Sprintf("Error sending the request: %v", err))
+		c.logger.Errorf("Error reading the response: %v", err)
 	}
-	if accepts != nil && response != nil {
-		respData, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			c.logger.Errorf("Error reading the response body: %v", err)
-			return errors.New(fmt.Sprintf("Error reading the response body: %v", err))
+	return err
+}
+
+// Reads and closes the response body: status codes not in the 2xx range are returned as *model.ApiError,
+// otherwise the body is decoded in the given response (when not nil) with the encoding related to the response
+// Content-Type, or to the given accepted mime type when the Content-Type is missing or unknown
+func readResponse(resp *http.Response, accepts encoding.MimeType, response interface{}) error {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error reading the response body: %v", err))
+	}
+	responseEncoding := encoding.ParseMimeType(encoding.MimeType(resp.Header.Get("Content-Type")))
+	if responseEncoding == encoding.EncodingUNKNOWNFormat && accepts != "" {
+		responseEncoding = encoding.ParseMimeType(accepts)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var apiErr = &model.ApiError{}
+		if responseEncoding != encoding.EncodingUNKNOWNFormat && len(data) > 0 {
+			_ = io2.Unmarshal(data, responseEncoding, apiErr)
+		}
+		apiErr.StatusCode = resp.StatusCode
+		apiErr.Status = resp.Status
+		apiErr.Body = data
+		if apiErr.Message == "" {
+			apiErr.Message = string(bytes.TrimSpace(data))
 		}
-		responseEncoding := encoding.ParseMimeType(*accepts)
-		err = io2.Unmarshal(respData, responseEncoding, response)
+		return apiErr
 	}
-	return err
+	if response == nil || len(data) == 0 {
+		return nil
+	}
+	return io2.Unmarshal(data, responseEncoding, response)
+}
+
+func (c *apiClient) BreakerStats() model.CircuitBreakerStats {
+	if c.breaker == nil {
+		return model.CircuitBreakerStats{
+			State: model.CircuitClosed,
+		}
+	}
+	return c.breaker.snapshot()
 }
 
 func NewApiClient(appName string, verbosity log.LogLevel) model.ApiClient {
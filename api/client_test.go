@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/hellgate75/go-network/api/builders"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/model/encoding"
+	"github.com/hellgate75/go-network/testsuite"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Connects a new Api Client to the given server address
+func connectClient(t *testing.T, address net.Addr) model.ApiClient {
+	client := NewApiClient("Test Api Client", log.FATAL)
+	clientConfig, err := builders.NewClientConfigBuilder().WithHost("http", "127.0.0.1", address.(*net.TCPAddr).Port).Build()
+	testsuite.AssertNil(t, "Client config error must be nil", err)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	return client
+}
+
+func TestEncodeContext(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	var seen = make(chan error, 2)
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/wait").
+		WithWebMethodHandling(http.MethodPost, builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+			// The client disconnection is detected once the request body is read
+			var request wsSample
+			_ = c.ParseBody(&request)
+			select {
+			case <-c.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			seen <- c.Context().Err()
+			return nil
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+	client := connectClient(t, server.Address())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	err = client.EncodeContext(ctx, "/wait", http.MethodPost, encoding.JsonMimeType, nil, &wsSample{}, nil)
+	testsuite.AssertNotNil(t, "Expired context must abort the call", err)
+	testsuite.AssertEquals(t, "Call must return at the deadline", true, time.Since(start) < 2*time.Second)
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancelNow()
+	}()
+	_, err = client.CallContext(cancelled, "/wait", http.MethodPost, nil, nil, nil)
+	testsuite.AssertNotNil(t, "Cancelled context must abort the call", err)
+	// Aborted calls close the connection, cancelling the request context seen by the action
+	for i := 0; i < 2; i++ {
+		select {
+		case err = <-seen:
+			testsuite.AssertEquals(t, "Action context must be cancelled", context.Canceled, err)
+		case <-time.After(3 * time.Second):
+			t.Fatal("Action context must be cancelled when the client aborts the call")
+		}
+	}
+}
+
+// Response body recording if it has been closed
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// Reader failing on the first read
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// Connects a new Api Client to the given test server
+func connectTestServer(t *testing.T, server *httptest.Server) model.ApiClient {
+	address, err := net.ResolveTCPAddr("tcp", strings.TrimPrefix(server.URL, "http://"))
+	testsuite.AssertNil(t, "Address error must be nil", err)
+	return connectClient(t, address)
+}
+
+func TestTypedErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"code":"duplicated","message":"Sample already exists"}`))
+	}))
+	defer server.Close()
+	client := connectTestServer(t, server)
+	_, err := Post[wsSample, wsSample](context.Background(), client, "/samples", wsSample{Value: 1})
+	apiErr, ok := err.(*model.ApiError)
+	testsuite.AssertEquals(t, "Non 2xx responses must be returned as ApiError", true, ok)
+	testsuite.AssertEquals(t, "ApiError must carry the status code", http.StatusConflict, apiErr.StatusCode)
+	testsuite.AssertEquals(t, "ApiError code must be decoded", "duplicated", apiErr.Code)
+	testsuite.AssertEquals(t, "ApiError message must be decoded", "Sample already exists", apiErr.Message)
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Sample not found", http.StatusNotFound)
+	}))
+	defer plain.Close()
+	_, err = Get[wsSample](context.Background(), connectTestServer(t, plain), "/samples/1")
+	apiErr, ok = err.(*model.ApiError)
+	testsuite.AssertEquals(t, "Plain text errors must be returned as ApiError", true, ok)
+	testsuite.AssertEquals(t, "ApiError must carry the status code", http.StatusNotFound, apiErr.StatusCode)
+	testsuite.AssertEquals(t, "ApiError message must be the response body", "Sample not found", apiErr.Message)
+}
+
+func TestTypedResponseContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testsuite.AssertEquals(t, "Request must accept json", "application/json", r.Header.Get("Accept"))
+		// The server answers with yaml, even if json is accepted
+		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+		_, _ = w.Write([]byte("value: 42\n"))
+	}))
+	defer server.Close()
+	response, err := Get[wsSample](context.Background(), connectTestServer(t, server), "/samples/1")
+	testsuite.AssertNil(t, "Get error must be nil", err)
+	testsuite.AssertEquals(t, "Response must be decoded with the response Content-Type", 42, response.Value)
+}
+
+func TestReadResponseClosesBody(t *testing.T) {
+	var header = http.Header{}
+	header.Set("Content-Type", "application/json")
+	for name, resp := range map[string]*http.Response{
+		"success":      {StatusCode: http.StatusOK, Header: header, Body: &trackedBody{Reader: bytes.NewBufferString(`{"value":1}`)}},
+		"error status": {StatusCode: http.StatusInternalServerError, Header: header, Body: &trackedBody{Reader: bytes.NewBufferString(`{"message":"failure"}`)}},
+		"decode error": {StatusCode: http.StatusOK, Header: header, Body: &trackedBody{Reader: bytes.NewBufferString(`{"value":`)}},
+		"empty body":   {StatusCode: http.StatusNoContent, Header: header, Body: &trackedBody{Reader: bytes.NewBuffer(nil)}},
+		"read error":   {StatusCode: http.StatusOK, Header: header, Body: &trackedBody{Reader: failingReader{}}},
+	} {
+		var response wsSample
+		_ = readResponse(resp, encoding.JsonMimeType, &response)
+		testsuite.AssertEquals(t, "Response body must be closed on "+name, true, resp.Body.(*trackedBody).closed)
+	}
+	var resp = &http.Response{StatusCode: http.StatusOK, Header: header, Body: &trackedBody{Reader: bytes.NewBufferString(`{"value":1}`)}}
+	testsuite.AssertNil(t, "Nil response error must be nil", readResponse(resp, encoding.JsonMimeType, nil))
+	testsuite.AssertEquals(t, "Response body must be closed with nil response", true, resp.Body.(*trackedBody).closed)
+}
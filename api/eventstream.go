@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Wait time before reconnecting a Server-Sent Events subscription, when the server has not set it
+	SubscribeRetryDelay = 3 * time.Second
+)
+
+// Reads the events of a Server-Sent Events stream, calling the handler for each of them, until the stream ends
+// or the handler returns an error. The identifier of the last event and the reconnection delay are updated
+// with the received values
+func readEvents(reader io.Reader, lastEventId *string, retry *time.Duration, handler model.ServerSentEventHandler) error {
+	var scanner = bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 4096), 16*1024*1024)
+	var event = context2.ServerSentEvent{}
+	var data = bytes.NewBuffer(make([]byte, 0))
+	var hasData = false
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if line == "" {
+			// Blank line dispatches the event
+			event.Id = *lastEventId
+			if hasData {
+				event.Data = append(make([]byte, 0, data.Len()), data.Bytes()...)
+				if err := handler(event); err != nil {
+					return err
+				}
+			}
+			event = context2.ServerSentEvent{}
+			data.Reset()
+			hasData = false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment
+			continue
+		}
+		var field, value = line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				*lastEventId = value
+			}
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteString("\n")
+			}
+			data.WriteString(value)
+			hasData = true
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms >= 0 {
+				*retry = time.Duration(ms) * time.Millisecond
+				event.Retry = *retry
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *apiClient) Subscribe(ctx context.Context, path string, lastEventId string, handler model.ServerSentEventHandler) error {
+	if c.cli == nil {
+		c.logger.Fatal("Client is not connected to a server socket")
+		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	if handler == nil {
+		return errors.New(fmt.Sprint("Nil Server-Sent Events handler"))
+	}
+	// The client timeout would end the stream
+	var cli = *c.cli
+	cli.Timeout = 0
+	var url = fmt.Sprintf("%s%s", c.baseUrl, path)
+	var retry = SubscribeRetryDelay
+	for {
+		c.logger.Debugf("ApiClient.Subscribe() - Subscribing to url: %s, last event id: %s ...", url, lastEventId)
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			c.logger.Errorf("ApiClient.Subscribe() - Error creating the request: %v", err)
+			return err
+		}
+		r.Header.Set("Accept", string(context2.EventStreamMimeType))
+		r.Header.Set("Cache-Control", "no-cache")
+		if lastEventId != "" {
+			r.Header.Set(context2.LastEventIdHeader, lastEventId)
+		}
+		resp, err := cli.Do(r)
+		if err == nil {
+			if resp.StatusCode == http.StatusNoContent {
+				// The server asks to stop reconnecting
+				_ = resp.Body.Close()
+				return nil
+			}
+			if resp.StatusCode != http.StatusOK {
+				return readResponse(resp, "", nil)
+			}
+			if mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mimeType != string(context2.EventStreamMimeType) {
+				_ = resp.Body.Close()
+				return errors.New(fmt.Sprintf("Invalid Server-Sent Events stream content type: %s", resp.Header.Get("Content-Type")))
+			}
+			var handlerErr error
+			err = readEvents(resp.Body, &lastEventId, &retry, func(event context2.ServerSentEvent) error {
+				handlerErr = handler(event)
+				return handlerErr
+			})
+			_ = resp.Body.Close()
+			if handlerErr != nil {
+				return handlerErr
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.logger.Warnf("ApiClient.Subscribe() - Stream of url: %s ended, reconnecting in %v - Error: %v", url, retry, err)
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/hellgate75/go-network/api/builders"
+	"github.com/hellgate75/go-network/log"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/model/encoding"
+	"github.com/hellgate75/go-network/testsuite"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseSample struct {
+	Value int `json:"value"`
+}
+
+func TestReadEvents(t *testing.T) {
+	var stream = ": comment\n\nid: 1\nevent: change\ndata: first\ndata: second\n\nretry: 250\ndata: third\n\n"
+	var lastEventId = ""
+	var retry time.Duration
+	var events = make([]context2.ServerSentEvent, 0)
+	err := readEvents(strings.NewReader(stream), &lastEventId, &retry, func(event context2.ServerSentEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	testsuite.AssertNil(t, "Read error must be nil", err)
+	testsuite.AssertEquals(t, "Two events must be dispatched", 2, len(events))
+	testsuite.AssertEquals(t, "Event type must be read", "change", events[0].Event)
+	testsuite.AssertEquals(t, "Data lines must be joined", "first\nsecond", string(events[0].Data))
+	testsuite.AssertEquals(t, "Event identifier must be kept by the next events", "1", events[1].Id)
+	testsuite.AssertEquals(t, "Retry must be read", 250*time.Millisecond, retry)
+}
+
+func TestSubscribeResumesFromLastEvent(t *testing.T) {
+	var retryDelay = SubscribeRetryDelay
+	SubscribeRetryDelay = 10 * time.Millisecond
+	defer func() {
+		SubscribeRetryDelay = retryDelay
+	}()
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/changes").
+		WithWebMethodHandling(http.MethodGet, builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+			var next = 1
+			if id := c.Request.Header.Get(context2.LastEventIdHeader); id != "" {
+				last, _ := strconv.Atoi(id)
+				next = last + 1
+			}
+			if next > 4 {
+				c.ResponseWriter.WriteHeader(http.StatusNoContent)
+				return nil
+			}
+			stream, err := c.EventStream(encoding.EncodingJSONFormat)
+			if err != nil {
+				return err
+			}
+			// Each connection sends two events, then the stream ends
+			for i := next; i < next+2; i++ {
+				if err := stream.Send("change", strconv.Itoa(i), &sseSample{Value: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+
+	client := NewApiClient("Test Api Client", log.ERROR)
+	clientConfig, err := builders.NewClientConfigBuilder().WithHost("http", "127.0.0.1", server.Address().(*net.TCPAddr).Port).Build()
+	testsuite.AssertNil(t, "Client config error must be nil", err)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var values = make([]string, 0)
+	err = client.Subscribe(ctx, "/changes", "", func(event context2.ServerSentEvent) error {
+		var sample sseSample
+		if err := event.Decode(encoding.EncodingJSONFormat, &sample); err != nil {
+			return err
+		}
+		values = append(values, fmt.Sprintf("%s:%v", event.Id, sample.Value))
+		return nil
+	})
+	testsuite.AssertNil(t, "No content status must end the subscription without error", err)
+	testsuite.AssertEquals(t, "All events must be received once", "1:1,2:2,3:3,4:4", strings.Join(values, ","))
+}
@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Header carrying the request identifier
+	RequestIdHeader = "X-Request-Id"
+)
+
+// Recovers panics raised by the next functions, answering with an internal server error status.
+// The panic is returned as an error, so it flows to the handler error channel.
+func Recovery() model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = errors.New(fmt.Sprintf("Recovery() - Panic in %s %s: %v", c.Method, c.Path, r))
+					if c.Logger != nil {
+						c.Logger.Errorf("%v\n%s", err, debug.Stack())
+					}
+					http.Error(c.ResponseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// Logs each request with method, path, response status, duration and request identifier,
+// using the server logger
+func Logging() model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) error {
+			var start = time.Now()
+			var writer = &statusWriter{ResponseWriter: c.ResponseWriter}
+			c.ResponseWriter = writer
+			err := next(c)
+			if c.Logger != nil {
+				var status = writer.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if err != nil {
+					c.Logger.Errorf("%s %s - status: %v, duration: %v, id: %s, error: %v", c.Method, c.Path, status, time.Now().Sub(start), c.Id, err)
+				} else {
+					c.Logger.Infof("%s %s - status: %v, duration: %v, id: %s", c.Method, c.Path, status, time.Now().Sub(start), c.Id)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// Uses the request identifier received in the X-Request-Id header, or the generated one when missing,
+// as context identifier and sends it back in the X-Request-Id response header
+func RequestId() model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) error {
+			if id := c.Request.Header.Get(RequestIdHeader); id != "" {
+				c.Id = id
+			}
+			c.ResponseWriter.Header().Set(RequestIdHeader, c.Id)
+			return next(c)
+		}
+	}
+}
+
+// Describe the Cross-Origin Resource Sharing policy
+type CorsConfig struct {
+	// Allowed origins, "*" allows any origin
+	AllowedOrigins []string
+	// Allowed web methods, for preflight requests
+	AllowedMethods []string
+	// Allowed request headers, for preflight requests
+	AllowedHeaders []string
+	// Response headers exposed to the client
+	ExposedHeaders []string
+	// Allow requests with credentials
+	AllowCredentials bool
+	// Preflight response cache duration (0 means not set)
+	MaxAge time.Duration
+}
+
+func (cfg CorsConfig) allowOrigin(origin string) string {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			if cfg.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Applies the given Cross-Origin Resource Sharing policy. Preflight requests are answered without calling
+// the next functions, so the handler must manage the OPTIONS web method to receive them.
+func Cors(cfg CorsConfig) model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) error {
+			var origin = c.Request.Header.Get("Origin")
+			if origin == "" {
+				return next(c)
+			}
+			var header = c.ResponseWriter.Header()
+			header.Add("Vary", "Origin")
+			var allowed = cfg.allowOrigin(origin)
+			if allowed == "" {
+				if c.Method == http.MethodOptions {
+					c.ResponseWriter.WriteHeader(http.StatusForbidden)
+					return nil
+				}
+				return next(c)
+			}
+			header.Set("Access-Control-Allow-Origin", allowed)
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if c.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != "" {
+				// Preflight request
+				if len(cfg.AllowedMethods) > 0 {
+					header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+				}
+				if len(cfg.AllowedHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+				} else if requested := c.Request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+				if cfg.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+				}
+				c.ResponseWriter.WriteHeader(http.StatusNoContent)
+				return nil
+			}
+			if len(cfg.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+			}
+			return next(c)
+		}
+	}
+}
+
+// Compresses the response with the given gzip level, when the client accepts the gzip content encoding
+func Gzip(level int) model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) error {
+			// Upgraded connections (eg.: WebSocket) are not compressed
+			if c.Request.Header.Get("Upgrade") != "" || !acceptsGzip(c.Request.Header.Get("Accept-Encoding")) {
+				return next(c)
+			}
+			gz, err := gzip.NewWriterLevel(c.ResponseWriter, level)
+			if err != nil {
+				return err
+			}
+			c.ResponseWriter.Header().Add("Vary", "Accept-Encoding")
+			var writer = &gzipWriter{ResponseWriter: c.ResponseWriter, writer: gz}
+			c.ResponseWriter = writer
+			err = next(c)
+			if closeErr := writer.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+	}
+}
+
+func acceptsGzip(acceptEncoding string) bool {
+	for _, value := range strings.Split(acceptEncoding, ",") {
+		var parts = strings.Split(value, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Response writer recording the written status code
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijacks the connection, for upgrade requests (eg.: WebSocket), recording the switching protocols status
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprint("Response writer does not support hijacking"))
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Response writer compressing the written data, the response is compressed only when it has a body
+type gzipWriter struct {
+	http.ResponseWriter
+	writer      *gzip.Writer
+	wroteHeader bool
+	wroteBody   bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code != http.StatusNoContent && code != http.StatusNotModified && code >= http.StatusOK {
+		w.ResponseWriter.Header().Set("Content-Encoding", "gzip")
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.wroteBody = true
+	return w.writer.Write(p)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.wroteBody {
+		_ = w.writer.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Close() error {
+	if !w.wroteBody {
+		return nil
+	}
+	return w.writer.Close()
+}
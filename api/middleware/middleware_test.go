@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func tracing(name string, trace *[]string) model.ApiMiddleware {
+	return func(next model.ApiActionFunction) model.ApiActionFunction {
+		return func(c context.ApiCallContext) error {
+			*trace = append(*trace, name+"-before")
+			err := next(c)
+			*trace = append(*trace, name+"-after")
+			return err
+		}
+	}
+}
+
+func newContext(method string, header map[string]string) (context.ApiCallContext, *httptest.ResponseRecorder) {
+	var r = httptest.NewRequest(method, "/sample", nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	var w = httptest.NewRecorder()
+	return context.NewApiCallContext(w, r), w
+}
+
+func TestChainApiMiddlewareOrder(t *testing.T) {
+	var trace = make([]string, 0)
+	var function = model.ChainApiMiddleware(func(c context.ApiCallContext) error {
+		trace = append(trace, "action")
+		return nil
+	}, tracing("first", &trace), nil, tracing("second", &trace))
+	c, _ := newContext(http.MethodGet, nil)
+	err := function(c)
+	testsuite.AssertNil(t, "Chain error must be nil", err)
+	testsuite.AssertEquals(t, "Chain must run middleware in the given order",
+		"first-before,second-before,action,second-after,first-after", strings.Join(trace, ","))
+}
+
+func TestRecovery(t *testing.T) {
+	var function = model.ChainApiMiddleware(func(c context.ApiCallContext) error {
+		panic("sample failure")
+	}, Recovery())
+	c, w := newContext(http.MethodGet, nil)
+	err := function(c)
+	testsuite.AssertNotNil(t, "Recovered panic must be reported as error", err)
+	testsuite.AssertEquals(t, "Recovered panic must answer internal server error", http.StatusInternalServerError, w.Code)
+}
+
+func TestRequestIdAndGzip(t *testing.T) {
+	var function = model.ChainApiMiddleware(func(c context.ApiCallContext) error {
+		if c.Id != "sample-id" {
+			return errors.New("Unexpected request identifier: " + c.Id)
+		}
+		c.ResponseWriter.WriteHeader(http.StatusOK)
+		_, err := c.ResponseWriter.Write([]byte("sample response"))
+		return err
+	}, RequestId(), Gzip(gzip.DefaultCompression))
+	c, w := newContext(http.MethodGet, map[string]string{RequestIdHeader: "sample-id", "Accept-Encoding": "gzip, deflate"})
+	err := function(c)
+	testsuite.AssertNil(t, "Chain error must be nil", err)
+	testsuite.AssertEquals(t, "Request identifier must be sent back", "sample-id", w.Header().Get(RequestIdHeader))
+	testsuite.AssertEquals(t, "Response must be compressed", "gzip", w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	testsuite.AssertNil(t, "Compressed response must be readable", err)
+	data, err := ioutil.ReadAll(reader)
+	testsuite.AssertNil(t, "Compressed response read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Response must be the written data", []byte("sample response"), data)
+}
+
+func TestCorsPreflight(t *testing.T) {
+	var called = false
+	var function = model.ChainApiMiddleware(func(c context.ApiCallContext) error {
+		called = true
+		return nil
+	}, Cors(CorsConfig{AllowedOrigins: []string{"https://sample.org"}, AllowedMethods: []string{"GET", "POST"}}))
+	c, w := newContext(http.MethodOptions, map[string]string{"Origin": "https://sample.org", "Access-Control-Request-Method": "POST"})
+	err := function(c)
+	testsuite.AssertNil(t, "Preflight error must be nil", err)
+	testsuite.AssertEquals(t, "Preflight must not reach the action", false, called)
+	testsuite.AssertEquals(t, "Preflight must answer no content", http.StatusNoContent, w.Code)
+	testsuite.AssertEquals(t, "Preflight must allow the origin", "https://sample.org", w.Header().Get("Access-Control-Allow-Origin"))
+	testsuite.AssertEquals(t, "Preflight must list the allowed methods", "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"github.com/hellgate75/go-network/model"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Returns the number of attempts allowed by the policy for the given web method
+func maxAttempts(policy *model.RetryPolicy, method string) int {
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return 1
+	}
+	if policy.IdempotentOnly && !isIdempotent(method) {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+func isRetryableStatus(policy *model.RetryPolicy, code int) bool {
+	var codes = policy.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryableStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the wait time before the given retry (0 is the first retry)
+func backoff(policy *model.RetryPolicy, retry int) time.Duration {
+	var multiplier = policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	var wait = float64(policy.InitialBackoff) * math.Pow(multiplier, float64(retry))
+	if policy.MaxBackoff > 0 && wait > float64(policy.MaxBackoff) {
+		wait = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		wait -= wait * math.Min(policy.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(wait)
+}
+
+// Circuit breaker tracking the consecutive failures of the client calls
+type circuitBreaker struct {
+	sync.Mutex
+	policy   model.CircuitBreakerPolicy
+	stats    model.CircuitBreakerStats
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(policy model.CircuitBreakerPolicy) *circuitBreaker {
+	return &circuitBreaker{
+		policy: policy,
+		stats: model.CircuitBreakerStats{
+			State: model.CircuitClosed,
+			Since: time.Now(),
+		},
+	}
+}
+
+func (b *circuitBreaker) setState(state model.CircuitState) {
+	b.stats.State = state
+	b.stats.Since = time.Now()
+}
+
+// Reports if a call is allowed, and if it is the half-open circuit trial call. It returns model.ErrCircuitOpen
+// when the call must fail immediately
+func (b *circuitBreaker) allow() (bool, error) {
+	defer b.Unlock()
+	b.Lock()
+	switch b.stats.State {
+	case model.CircuitOpen:
+		if time.Now().Sub(b.openedAt) < b.policy.OpenTimeout {
+			b.stats.Rejected++
+			return false, model.ErrCircuitOpen
+		}
+		b.setState(model.CircuitHalfOpen)
+		b.trial = true
+		return true, nil
+	case model.CircuitHalfOpen:
+		if b.trial {
+			// Only one trial call is allowed
+			b.stats.Rejected++
+			return false, model.ErrCircuitOpen
+		}
+		b.trial = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// Releases an allowed call without recording its outcome (eg.: a call cancelled by the caller), so a trial call
+// can be made again
+func (b *circuitBreaker) release(trial bool) {
+	defer b.Unlock()
+	b.Lock()
+	if trial {
+		b.trial = false
+	}
+}
+
+// Records the outcome of an allowed call, the trial flag must be the one returned by allow
+func (b *circuitBreaker) record(trial bool, success bool) {
+	defer b.Unlock()
+	b.Lock()
+	if trial {
+		b.trial = false
+	} else if b.stats.State == model.CircuitHalfOpen {
+		// Calls allowed before the circuit opened do not decide the half-open circuit state
+		return
+	}
+	if success {
+		b.stats.ConsecutiveFailures = 0
+		if b.stats.State != model.CircuitClosed {
+			b.setState(model.CircuitClosed)
+		}
+		return
+	}
+	b.stats.ConsecutiveFailures++
+	if b.stats.State == model.CircuitHalfOpen ||
+		(b.stats.State == model.CircuitClosed && b.stats.ConsecutiveFailures >= b.policy.FailureThreshold) {
+		b.stats.Trips++
+		b.openedAt = time.Now()
+		b.setState(model.CircuitOpen)
+	}
+}
+
+func (b *circuitBreaker) snapshot() model.CircuitBreakerStats {
+	defer b.Unlock()
+	b.Lock()
+	return b.stats
+}
+
+// Sends the requests created by the given function applying the client circuit breaker and retry policy.
+// The response of the last attempt is returned, the ones of the failed attempts are closed.
+func (c *apiClient) send(ctx context.Context, method string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var attempts = maxAttempts(c.config.Retry, method)
+	for attempt := 1; ; attempt++ {
+		r, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		var trial bool
+		if c.breaker != nil {
+			if trial, err = c.breaker.allow(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := c.cli.Do(r)
+		if c.breaker != nil {
+			if err != nil && ctx.Err() != nil {
+				// Calls cancelled by the caller, or exceeding its deadline, are not server failures
+				c.breaker.release(trial)
+			} else {
+				c.breaker.record(trial, err == nil && resp.StatusCode < http.StatusInternalServerError)
+			}
+		}
+		var retry = attempt < attempts && ctx.Err() == nil &&
+			(err != nil || isRetryableStatus(c.config.Retry, resp.StatusCode))
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		var wait = backoff(c.config.Retry, attempt-1)
+		c.logger.Debugf("Retrying %s request in %v, attempt %v of %v ...", method, wait, attempt+1, attempts)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"github.com/hellgate75/go-network/api/builders"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/testsuite"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	var policy = &model.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	testsuite.AssertEquals(t, "First retry must wait the initial backoff", 100*time.Millisecond, backoff(policy, 0))
+	testsuite.AssertEquals(t, "Backoff must grow exponentially", 400*time.Millisecond, backoff(policy, 2))
+	testsuite.AssertEquals(t, "Backoff must be limited to max backoff", time.Second, backoff(policy, 10))
+	testsuite.AssertEquals(t, "Non idempotent calls must be retried", 5, maxAttempts(policy, "POST"))
+	policy.IdempotentOnly = true
+	testsuite.AssertEquals(t, "Non idempotent calls must not be retried", 1, maxAttempts(policy, "POST"))
+	testsuite.AssertEquals(t, "Idempotent calls must be retried", 5, maxAttempts(policy, "GET"))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var breaker = newCircuitBreaker(model.CircuitBreakerPolicy{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		trial, err := breaker.allow()
+		testsuite.AssertNil(t, "Closed circuit must allow calls", err)
+		breaker.record(trial, false)
+	}
+	testsuite.AssertEquals(t, "Circuit must open at failure threshold", model.CircuitOpen, breaker.snapshot().State)
+	_, err := breaker.allow()
+	testsuite.AssertEquals(t, "Open circuit must reject calls", model.ErrCircuitOpen, err)
+	time.Sleep(60 * time.Millisecond)
+	trial, err := breaker.allow()
+	testsuite.AssertNil(t, "Circuit must allow a trial call after open timeout", err)
+	testsuite.AssertEquals(t, "Call after open timeout must be the trial call", true, trial)
+	_, err = breaker.allow()
+	testsuite.AssertEquals(t, "Half open circuit must allow only one trial call", model.ErrCircuitOpen, err)
+	breaker.record(trial, true)
+	var stats = breaker.snapshot()
+	testsuite.AssertEquals(t, "Successful trial call must close the circuit", model.CircuitClosed, stats.State)
+	testsuite.AssertEquals(t, "Circuit must count trips", int64(1), stats.Trips)
+	testsuite.AssertEquals(t, "Circuit must count rejected calls", int64(2), stats.Rejected)
+}
+
+func TestCircuitBreakerTrialCall(t *testing.T) {
+	var breaker = newCircuitBreaker(model.CircuitBreakerPolicy{FailureThreshold: 1, OpenTimeout: 50 * time.Millisecond})
+	// Call started before the circuit opens, completing while it is half open
+	stale, _ := breaker.allow()
+	failing, _ := breaker.allow()
+	breaker.record(failing, false)
+	time.Sleep(60 * time.Millisecond)
+	trial, err := breaker.allow()
+	testsuite.AssertNil(t, "Circuit must allow a trial call after open timeout", err)
+	breaker.record(stale, true)
+	testsuite.AssertEquals(t, "Stale call must not close the half open circuit", model.CircuitHalfOpen, breaker.snapshot().State)
+	_, err = breaker.allow()
+	testsuite.AssertEquals(t, "Stale call must not allow another trial call", model.ErrCircuitOpen, err)
+	breaker.release(trial)
+	trial, err = breaker.allow()
+	testsuite.AssertNil(t, "Released trial call must allow a new trial call", err)
+	breaker.record(trial, false)
+	testsuite.AssertEquals(t, "Failed trial call must open the circuit", model.CircuitOpen, breaker.snapshot().State)
+}
+
+func TestCircuitBreakerIgnoresCallerContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	address, _ := net.ResolveTCPAddr("tcp", strings.TrimPrefix(server.URL, "http://"))
+	clientConfig, _ := builders.NewClientConfigBuilder().WithHost("http", "127.0.0.1", address.Port).
+		WithCircuitBreaker(model.CircuitBreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Minute}).
+		Build()
+	client := NewApiClient("Test Api Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.CallContext(ctx, "/slow", http.MethodGet, nil, nil, nil)
+	testsuite.AssertNotNil(t, "Expired context must abort the call", err)
+	var stats = client.BreakerStats()
+	testsuite.AssertEquals(t, "Caller deadline must not open the circuit", model.CircuitClosed, stats.State)
+	testsuite.AssertEquals(t, "Caller deadline must not count as failure", 0, stats.ConsecutiveFailures)
+}
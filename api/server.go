@@ -5,21 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/hellgate75/go-network/log"
 	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 )
 
-type Signal byte
-const (
-	shutdown	Signal = iota + 1
-	purge
-	exit
-)
-
 var (
+	// Maximum time Stop waits for the in-flight requests, before closing the connections
 	ServerWaitTimeout = 120 * time.Second
 )
 
@@ -28,18 +25,21 @@ type apiServer struct {
 	config			*model.ServerConfig
 	running			bool
 	router			*mux.Router
-	internal		chan Signal
-	commands		chan Signal
+	done			chan struct{}
+	shutdown		chan struct{}
 	logger			log.Logger
 	activeRequests	int64
 	handlers		map[string]*model.ApiCallHandler
+	webSockets		map[string]model.WebSocketHandler
 	httpServer		*http.Server
-	timer			*time.Ticker
+	address			net.Addr
 	serverMap		map[string]interface{}
+	middleware		[]model.ApiMiddleware
+	authenticators	[]model.Authenticator
 }
 
 func (server *apiServer) Init(config model.ServerConfig) (model.ApiServer, error) {
-	if server.running {
+	if server.Running() {
 		return server, errors.New(fmt.Sprint("ApiServer.Init() - Server is still running"))
 	}
 	server.config = &config
@@ -47,81 +47,166 @@ func (server *apiServer) Init(config model.ServerConfig) (model.ApiServer, error
 }
 
 func (server *apiServer) Start() error {
+	if server.config == nil {
+		server.logger.Fatal("ApiServer.Start() - Error: No server configuration provided")
+		return errors.New(fmt.Sprint("ApiServer.Start() - Error: No server configuration provided"))
+	}
+	var address = fmt.Sprintf("%s:%v", server.config.Host, server.config.Port)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		server.logger.Errorf("ApiServer.Start() - Server failed to start on: %s, due to error: %v", address, err)
+		return err
+	}
+	err = server.StartListener(listener)
+	if err != nil {
+		_ = listener.Close()
+	}
+	return err
+}
+
+func (server *apiServer) StartListener(listener net.Listener) error {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("ApiServer.Start() - Error: %v", r))
+			err = errors.New(fmt.Sprintf("ApiServer.StartListener() - Error: %v", r))
 			server.logger.Fatalf("%v", err)
 		}
 	}()
-	if server.running {
-		server.logger.Fatal("ApiServer.Start() - Error: Server already running")
-		return errors.New(fmt.Sprint("ApiServer.Start() - Error: Server already running"))
+	if listener == nil {
+		server.logger.Fatal("ApiServer.StartListener() - Error: Nil listener provided")
+		return errors.New(fmt.Sprint("ApiServer.StartListener() - Error: Nil listener provided"))
 	}
 	if server.config == nil {
-		server.logger.Fatal("ApiServer.Start() - Error: No server configuration provided")
-		return errors.New(fmt.Sprint("ApiServer.Start() - Error: No server configuration provided"))
+		server.logger.Fatal("ApiServer.StartListener() - Error: No server configuration provided")
+		return errors.New(fmt.Sprint("ApiServer.StartListener() - Error: No server configuration provided"))
 	}
-	server.internal = make(chan Signal)
-	server.commands = make(chan Signal)
-	var address = fmt.Sprintf("%s:%v", server.config.Host, server.config.Port)
-	server.httpServer = &http.Server{
-		Addr: address,
-		Handler: server.router,
+	server.Lock()
+	if server.running {
+		server.Unlock()
+		server.logger.Fatal("ApiServer.StartListener() - Error: Server already running")
+		return errors.New(fmt.Sprint("ApiServer.StartListener() - Error: Server already running"))
+	}
+	var shutdown = make(chan struct{})
+	var httpServer = &http.Server{
+		Addr: listener.Addr().String(),
+		Handler: http.HandlerFunc(server.serveHTTP),
 		TLSConfig: server.config.Config,
+		BaseContext: func(net.Listener) context.Context {
+			return context2.WithServerShutdown(context.Background(), shutdown)
+		},
 	}
+	// Upgraded connections are not tracked by the http server, so they are closed on shutdown
+	httpServer.RegisterOnShutdown(server.closeWebSockets)
+	server.httpServer = httpServer
+	server.address = listener.Addr()
+	server.done = make(chan struct{})
+	server.shutdown = shutdown
+	server.running = true
+	server.Unlock()
+	server.logger.Infof("ApiServer.StartListener() - Server started on: %s", listener.Addr())
+	go server.serve(httpServer, listener)
+	return err
+}
+
+// Serves the connections accepted by the listener, until the server is shut down
+func (server *apiServer) serve(httpServer *http.Server, listener net.Listener) {
+	var err error
 	if server.config.CertPath != "" && server.config.KeyPath != "" {
 		// TLS encryption
-		server.logger.Debugf("ApiServer.Start() - Running TLS encryption listener on: %s", address)
-		err = server.httpServer.ListenAndServeTLS(server.config.CertPath, server.config.KeyPath)
-
+		server.logger.Debugf("ApiServer.serve() - Running TLS encryption listener on: %s", listener.Addr())
+		err = httpServer.ServeTLS(listener, server.config.CertPath, server.config.KeyPath)
+	} else if server.config.Config != nil && server.config.Config.GetCertificate != nil {
+		// TLS encryption with the certificates provided by the Security Configuration (eg.: a certificate source)
+		server.logger.Debugf("ApiServer.serve() - Running TLS encryption listener with dynamic certificates on: %s", listener.Addr())
+		err = httpServer.ServeTLS(listener, "", "")
 	} else {
 		// No TLS encryption
-		server.logger.Debugf("ApiServer.Start() - Running non-TLS encryption listener on: %s", address)
-		err = server.httpServer.ListenAndServe()
+		server.logger.Debugf("ApiServer.serve() - Running non-TLS encryption listener on: %s", listener.Addr())
+		err = httpServer.Serve(listener)
 	}
-	if err == nil {
-		server.running = true
-		server.logger.Infof("ApiServer.Start() - Server started on: %s", address)
-	} else {
-		server.logger.Errorf("ApiServer.Start() - Server failed to start on: %s, due to error: %v", address, err)
+	if err == http.ErrServerClosed {
+		// Server has been shut down
+		return
 	}
-	return err
+	server.logger.Errorf("ApiServer.serve() - Server stopped serving on: %s, due to error: %v", listener.Addr(), err)
+	server.Lock()
+	defer server.Unlock()
+	if server.running && server.httpServer == httpServer {
+		server.running = false
+		server.httpServer = nil
+		server.address = nil
+		close(server.done)
+	}
+}
+
+func (server *apiServer) Address() net.Addr {
+	defer server.Unlock()
+	server.Lock()
+	return server.address
+}
+
+// Serves the requests tracking the in-flight ones, and limiting the body size
+func (server *apiServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	server.register()
+	defer server.deregister()
+	var limit = server.config.MaxBodySize
+	if limit == 0 {
+		limit = model.DefaultMaxBodySize
+	}
+	if limit > 0 {
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("Request body exceeds the maximum size of %v bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = context2.LimitBody(r.Body, limit)
+		r = r.WithContext(context2.WithMaxBodySize(r.Context(), limit))
+	}
+	server.router.ServeHTTP(w, r)
 }
 
 func (server *apiServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ServerWaitTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func (server *apiServer) Shutdown(ctx context.Context) error {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("ApiServer.Stop() - Error: %v", r))
+			err = errors.New(fmt.Sprintf("ApiServer.Shutdown() - Error: %v", r))
 			server.logger.Fatalf("%v", err)
 		}
 	}()
+	server.Lock()
 	if ! server.running {
-		err = errors.New(fmt.Sprint("ApiServer.Stop() - Error: Server is already stopped"))
+		server.Unlock()
+		err = errors.New(fmt.Sprint("ApiServer.Shutdown() - Error: Server is already stopped"))
 		server.logger.Errorf("%v", err)
 		return err
 	}
-	server.internal <- shutdown
-	go server.shutdownTimer()
 	server.running = false
-	if server.httpServer != nil {
-		err := server.httpServer.Shutdown(context.Background())
-		if err != nil {
-			server.logger.Errorf("ApiServer.evacuate() - Gently shutting down server error occurred: %v", err)
-			server.logger.Warnf("ApiServer.evacuate() - Try brute-force server close ...")
-			err = server.httpServer.Close()
-			if err != nil {
-				server.logger.Errorf("ApiServer.evacuate() - Brute close server error occurred: %v", err)
-			}
-			server.activeRequests = 0
+	var httpServer = server.httpServer
+	server.httpServer = nil
+	server.address = nil
+	close(server.shutdown)
+	server.Unlock()
+	defer close(server.done)
+	server.logger.Infof("ApiServer.Shutdown() - Waiting for %v in-flight requests ...", server.inFlight())
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		server.logger.Errorf("ApiServer.Shutdown() - Gently shutting down server error occurred: %v", err)
+		server.logger.Warnf("ApiServer.Shutdown() - Try brute-force server close ...")
+		if closeErr := httpServer.Close(); closeErr != nil {
+			server.logger.Errorf("ApiServer.Shutdown() - Brute close server error occurred: %v", closeErr)
 		}
-		server.httpServer = nil
 	}
 	return err
 }
 
 func (server *apiServer) Running() bool {
+	defer server.Unlock()
+	server.Lock()
 	return server.running
 }
 
@@ -137,66 +222,26 @@ func (server *apiServer) deregister() {
 	server.activeRequests--
 }
 
-func (server *apiServer) checkExit() bool {
-	if ! server.Running() && ! server.Working() {
-		server.internal <- exit
-		return true
-	}
-	return false
-}
-
-func (server *apiServer) shutdownTimer() {
-	server.timer = time.NewTicker(5 * time.Second)
-	defer func() {
-		server.timer.Stop()
-		server.timer = nil
-	}()
-	for {
-		select {
-		case <- server.timer.C:
-			if server.checkExit() {
-				server.evacuate()
-				return
-			}
-
-		}
-	}
-}
-
-func (server *apiServer) evacuate() {
-	close(server.internal)
-	server.internal = nil
-	close(server.commands)
-	server.commands = nil
+func (server *apiServer) inFlight() int64 {
+	defer server.Unlock()
+	server.Lock()
+	return server.activeRequests
 }
 
 func (server *apiServer) Working() bool {
-	return server.activeRequests > 0
+	return server.inFlight() > 0
 }
 
 func (server *apiServer) Wait() {
-	defer func() {
-		if r := recover(); r != nil {
-			server.logger.Fatalf("ApiServer.Wait() - Fatal Error: %v", r)
-		}
-	}()
-	server.logger.Debugf("ApiServer.Wait() - Waiting for server shutdown")
-	waitCycle:
-	for server.Running() || server.Working() {
-		select {
-			case sig := <- server.internal:
-				if sig == shutdown {
-					server.commands	<- purge
-				} else if sig == exit {
-					break waitCycle
-				}
-			case <- time.After(ServerWaitTimeout):
-				continue
-		}
+	server.Lock()
+	var done = server.done
+	server.Unlock()
+	if done == nil {
+		return
 	}
-	server.logger.Warnf("ApiServer.Wait() - Server shutdown in progress, exiting ...")
-	time.Sleep(10 * time.Second)
-	server.logger.Warnf("ApiServer.Wait() - exit")
+	server.logger.Debugf("ApiServer.Wait() - Waiting for server shutdown")
+	<-done
+	server.logger.Debugf("ApiServer.Wait() - exit")
 }
 
 func (server *apiServer) AddPath(handler model.ApiCallHandler) error {
@@ -214,12 +259,14 @@ func (server *apiServer) AddPath(handler model.ApiCallHandler) error {
 	} else if len(handler.Methods()) == 0 {
 		err = errors.New(fmt.Sprint("Provided handler has not method implementation"))
 		server.logger.Warnf("ApiServer.AddPath() - No Web Methods for Api handler in path %s", path)
-	} else if _, ok := server.handlers[path]; ok {
+	} else if server.hasPath(path) {
 		err = errors.New(fmt.Sprintf("Provided handler has duplicsted path: %s", path))
 		server.logger.Warnf("ApiServer.AddPath() - Duplicated Api handler for path %s", path)
 	} else {
 		handler.SetServerMap(&server.serverMap)
 		handler.SetLogger(server.logger)
+		handler.SetMiddleware(&server.middleware)
+		handler.SetAuthenticators(&server.authenticators)
 		server.router.HandleFunc(path, handler.HandleRequest).Methods(handler.Methods()...)
 		server.handlers[path]=&handler
 		server.logger.Debugf("ApiServer.AddPath() - Adding Api handler for path %s", path)
@@ -227,6 +274,81 @@ func (server *apiServer) AddPath(handler model.ApiCallHandler) error {
 	return err
 }
 
+func (server *apiServer) AddWebSocket(handler model.WebSocketHandler) error {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("ApiServer.AddWebSocket() - Error: %v", r))
+			server.logger.Fatalf("%v", err)
+		}
+	}()
+	var path = handler.GetPath()
+	if len(path) == 0 {
+		err = errors.New(fmt.Sprint("Provided handler has empty path"))
+		server.logger.Warn("ApiServer.AddWebSocket() - Empty Path for WebSocket handler")
+	} else if server.hasPath(path) {
+		err = errors.New(fmt.Sprintf("Provided handler has duplicsted path: %s", path))
+		server.logger.Warnf("ApiServer.AddWebSocket() - Duplicated WebSocket handler for path %s", path)
+	} else {
+		handler.SetServerMap(&server.serverMap)
+		handler.SetLogger(server.logger)
+		handler.SetMiddleware(&server.middleware)
+		handler.SetAuthenticators(&server.authenticators)
+		server.router.HandleFunc(path, handler.HandleRequest).Methods(http.MethodGet)
+		server.Lock()
+		server.webSockets[path] = handler
+		server.Unlock()
+		server.logger.Debugf("ApiServer.AddWebSocket() - Adding WebSocket handler for path %s", path)
+	}
+	return err
+}
+
+func (server *apiServer) hasPath(path string) bool {
+	defer server.Unlock()
+	server.Lock()
+	if _, ok := server.handlers[path]; ok {
+		return true
+	}
+	_, ok := server.webSockets[path]
+	return ok
+}
+
+// Closes the connections of all the WebSocket handlers, with the going away status
+func (server *apiServer) closeWebSockets() {
+	server.Lock()
+	var handlers = make([]model.WebSocketHandler, 0, len(server.webSockets))
+	for _, handler := range server.webSockets {
+		handlers = append(handlers, handler)
+	}
+	server.Unlock()
+	for _, handler := range handlers {
+		server.logger.Debugf("ApiServer.closeWebSockets() - Closing %v connections of path %s", handler.Hub().Count(), handler.GetPath())
+		handler.Hub().CloseAll(websocket.CloseGoingAway, "Server shutdown")
+	}
+}
+
+func (server *apiServer) Use(middleware ...model.ApiMiddleware) {
+	defer server.Unlock()
+	server.Lock()
+	for _, m := range middleware {
+		if m != nil {
+			server.middleware = append(server.middleware, m)
+		}
+	}
+	server.logger.Debugf("ApiServer.Use() - Server middleware count: %v", len(server.middleware))
+}
+
+func (server *apiServer) UseAuthentication(authenticators ...model.Authenticator) {
+	defer server.Unlock()
+	server.Lock()
+	for _, a := range authenticators {
+		if a != nil {
+			server.authenticators = append(server.authenticators, a)
+		}
+	}
+	server.logger.Debugf("ApiServer.UseAuthentication() - Server authenticators count: %v", len(server.authenticators))
+}
+
 func NewApiServer(appName string, verbosity log.LogLevel) model.ApiServer {
 	return &apiServer{
 		config: nil,
@@ -234,8 +356,10 @@ func NewApiServer(appName string, verbosity log.LogLevel) model.ApiServer {
 		router: mux.NewRouter(),
 		logger: log.NewLogger(appName, verbosity),
 		handlers: make(map[string]*model.ApiCallHandler),
+		webSockets: make(map[string]model.WebSocketHandler),
 		httpServer: nil,
-		timer: nil,
 		serverMap: make(map[string]interface{}),
+		middleware: make([]model.ApiMiddleware, 0),
+		authenticators: make([]model.Authenticator, 0),
 	}
 }
\ No newline at end of file
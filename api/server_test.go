@@ -0,0 +1,352 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/api/auth"
+	"github.com/hellgate75/go-network/api/builders"
+	"github.com/hellgate75/go-network/certs"
+	"github.com/hellgate75/go-network/common"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartAndShutdown(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/sample").
+		WithWebMethodHandling(http.MethodGet, builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+			c.ResponseWriter.WriteHeader(http.StatusNoContent)
+			return nil
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	testsuite.AssertEquals(t, "Server must be running after start", true, server.Running())
+	testsuite.AssertNotNil(t, "Server must be bound to an address", server.Address())
+	resp, err := http.Get(fmt.Sprintf("http://%s/sample", server.Address()))
+	testsuite.AssertNil(t, "Request error must be nil", err)
+	_ = resp.Body.Close()
+	testsuite.AssertEquals(t, "Request must reach the handler", http.StatusNoContent, resp.StatusCode)
+
+	// Bind errors are returned immediately
+	used, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", server.Address().(*net.TCPAddr).Port).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	other, _ := NewApiServer("Test Api Server", log.ERROR).Init(used)
+	testsuite.AssertNotNil(t, "Start on a used port must fail", other.Start())
+	testsuite.AssertEquals(t, "Failed server must not be running", false, other.Running())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	testsuite.AssertNil(t, "Shutdown error must be nil", server.Shutdown(ctx))
+	server.Wait()
+	testsuite.AssertEquals(t, "Server must not be running after shutdown", false, server.Running())
+	testsuite.AssertNil(t, "Server must not be bound after shutdown", server.Address())
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	var started = make(chan struct{}, 1)
+	var finished = make(chan struct{}, 1)
+	var start = func(action func(c context2.ApiCallContext) error) model.ApiServer {
+		config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+		testsuite.AssertNil(t, "Config error must be nil", err)
+		server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+		testsuite.AssertNil(t, "Init error must be nil", err)
+		handler, err := builders.NewApiCallHandlerBuilder().
+			WithPath("/sample").
+			WithWebMethodHandling(http.MethodGet, builders.NewApiActionBuilder().With(action).Build()).
+			Build()
+		testsuite.AssertNil(t, "Handler error must be nil", err)
+		testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+		testsuite.AssertNil(t, "Start error must be nil", server.Start())
+		return server
+	}
+	var call = func(server model.ApiServer) chan error {
+		var result = make(chan error, 1)
+		var url = fmt.Sprintf("http://%s/sample", server.Address())
+		go func() {
+			resp, err := http.Get(url)
+			if err == nil {
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					err = errors.New(resp.Status)
+				}
+			}
+			result <- err
+		}()
+		<-started
+		return result
+	}
+
+	// In-flight requests complete before the shutdown returns
+	server := start(func(c context2.ApiCallContext) error {
+		started <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		c.ResponseWriter.WriteHeader(http.StatusNoContent)
+		finished <- struct{}{}
+		return nil
+	})
+	var result = call(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	testsuite.AssertNil(t, "Shutdown error must be nil", server.Shutdown(ctx))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("In-flight request must complete before the shutdown returns")
+	}
+	select {
+	case err := <-result:
+		testsuite.AssertNil(t, "In-flight request error must be nil", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("In-flight request must receive the response")
+	}
+
+	// Remaining connections are closed at the deadline
+	server = start(func(c context2.ApiCallContext) error {
+		started <- struct{}{}
+		select {
+		case <-c.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return nil
+	})
+	result = call(server)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var begin = time.Now()
+	testsuite.AssertEquals(t, "Shutdown must return the context error at the deadline", context.DeadlineExceeded, server.Shutdown(ctx))
+	testsuite.AssertEquals(t, "Shutdown must not wait the running requests", true, time.Since(begin) < 2*time.Second)
+	select {
+	case err := <-result:
+		testsuite.AssertNotNil(t, "Request on a closed connection must fail", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Remaining connections must be closed at the deadline")
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).WithMaxBodySize(16).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/sample").
+		WithWebMethodHandling(http.MethodPut, builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+			var body map[string]string
+			if err := c.ParseBody(&body); err != nil {
+				return err
+			}
+			c.ResponseWriter.WriteHeader(http.StatusNoContent)
+			return nil
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+	var url = fmt.Sprintf("http://%s/sample", server.Address())
+	for body, status := range map[string]int{
+		`{"a":"b"}`:                 http.StatusNoContent,
+		`{"a":"a very long value"}`: http.StatusRequestEntityTooLarge,
+	} {
+		r, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(r)
+		testsuite.AssertNil(t, "Request error must be nil", err)
+		_ = resp.Body.Close()
+		testsuite.AssertEquals(t, "Response status must match the body size", status, resp.StatusCode)
+	}
+	// Chunked bodies have no length, so the limit applies while reading them
+	r, _ := http.NewRequest(http.MethodPut, url, ioutil.NopCloser(strings.NewReader(`{"a":"a very long value"}`)))
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(r)
+	testsuite.AssertNil(t, "Request error must be nil", err)
+	data, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	testsuite.AssertEquals(t, "Chunked body must be limited", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	testsuite.AssertEquals(t, "Response must report the server limit", "Request body exceeds the maximum size of 16 bytes\n", string(data))
+}
+
+func TestAuthenticationAndRoles(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	keys := auth.NewApiKeyAuthenticator("")
+	keys.AddKey("reader-key", "reader", "read")
+	keys.AddKey("writer-key", "writer", "read", "write")
+	server.UseAuthentication(keys)
+	var action = builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+		var name = "anonymous"
+		if c.Principal != nil {
+			name = c.Principal.Name
+		}
+		_, err := c.ResponseWriter.Write([]byte(name))
+		return err
+	}).Build()
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/sample").
+		WithWebMethodHandling(http.MethodGet, action).
+		WithWebMethodHandling(http.MethodPost, action).
+		WithRoles(http.MethodPost, "write").
+		WithMiddleware(func(next model.ApiActionFunction) model.ApiActionFunction {
+			return func(c context2.ApiCallContext) error {
+				if c.Principal != nil {
+					c.ResponseWriter.Header().Set("X-Principal", c.Principal.Name)
+				}
+				return next(c)
+			}
+		}).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+	var url = fmt.Sprintf("http://%s/sample", server.Address())
+	for _, test := range []struct {
+		method string
+		key    string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "", http.StatusOK, "anonymous"},
+		{http.MethodGet, "reader-key", http.StatusOK, "reader"},
+		{http.MethodGet, "unknown-key", http.StatusUnauthorized, ""},
+		{http.MethodPost, "", http.StatusUnauthorized, ""},
+		{http.MethodPost, "reader-key", http.StatusForbidden, ""},
+		{http.MethodPost, "writer-key", http.StatusOK, "writer"},
+	} {
+		r, _ := http.NewRequest(test.method, url, nil)
+		if test.key != "" {
+			r.Header.Set(auth.ApiKeyHeader, test.key)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		testsuite.AssertNil(t, "Request error must be nil", err)
+		data, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		testsuite.AssertEquals(t, fmt.Sprintf("%s with key '%s' status must match", test.method, test.key), test.status, resp.StatusCode)
+		if test.status == http.StatusOK {
+			testsuite.AssertEquals(t, "Action must see the principal", test.body, string(data))
+		}
+		if test.key == "reader-key" || test.key == "writer-key" {
+			testsuite.AssertEquals(t, "Handler middleware must see the principal", test.body, resp.Header.Get("X-Principal"))
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "mtls")
+	defer os.RemoveAll(dir)
+	ca, err := certs.NewAuthority("Test CA", certs.ECDSA, time.Hour)
+	testsuite.AssertNil(t, "Authority error must be nil", err)
+	serverCert, err := ca.IssueServer("localhost", "127.0.0.1")
+	testsuite.AssertNil(t, "Server certificate error must be nil", err)
+	serverFiles, err := serverCert.Write(dir, "localhost")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	var clientFiles = make(map[string]certs.Files)
+	for _, name := range []string{"billing", "unknown"} {
+		clientCert, err := ca.Issue(certs.Request{CommonName: name, Hosts: []string{name + ".acme.com"}, Usage: certs.ClientUsage, Algorithm: certs.RSA})
+		testsuite.AssertNil(t, "Client certificate error must be nil", err)
+		clientFiles[name], _ = clientCert.Write(dir, name)
+	}
+
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).
+		WithTLSCerts(serverFiles.CertPath, serverFiles.KeyPath).
+		WithClientCaCert(serverFiles.CaPath).
+		Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	testsuite.AssertEquals(t, "Client CA must require client certificates", tls.RequireAndVerifyClientCert, config.Config.ClientAuth)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	server.UseAuthentication(auth.NewCertificateAuthenticator(model.SubjectRoles(map[string][]string{
+		"billing": {"reader"},
+	})))
+	handler, err := builders.NewApiCallHandlerBuilder().
+		WithPath("/sample").
+		WithWebMethodHandling(http.MethodGet, builders.NewApiActionBuilder().With(func(c context2.ApiCallContext) error {
+			_, err := c.ResponseWriter.Write([]byte(c.Principal.Name + " " + c.PeerCertificate.DNSNames[0]))
+			return err
+		}).Build()).
+		WithRoles(http.MethodGet, "reader").
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+	var port = server.Address().(*net.TCPAddr).Port
+
+	for name, status := range map[string]int{"billing": http.StatusOK, "unknown": http.StatusForbidden} {
+		clientConfig, err := builders.NewClientConfigBuilder().WithHost("https", "127.0.0.1", port).
+			WithTLSCerts(clientFiles[name].CertPath, clientFiles[name].KeyPath).
+			WithRootCaCert(clientFiles[name].CaPath).
+			Build()
+		testsuite.AssertNil(t, "Client config error must be nil", err)
+		client := NewApiClient("Test Api Client", log.ERROR)
+		testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+		resp, err := client.Call("/sample", http.MethodGet, nil, nil, nil)
+		testsuite.AssertNil(t, "Request error must be nil", err)
+		data, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		testsuite.AssertEquals(t, name+" status must match its roles", status, resp.StatusCode)
+		if status == http.StatusOK {
+			testsuite.AssertEquals(t, "Action must see the certificate identity", "billing billing.acme.com", string(data))
+		}
+	}
+
+	// Clients without certificate fail the handshake
+	clientConfig, _ := builders.NewClientConfigBuilder().WithHost("https", "127.0.0.1", port).
+		WithRootCaCert(serverFiles.CaPath).
+		Build()
+	client := NewApiClient("Test Api Client", log.ERROR)
+	_ = client.Connect(clientConfig)
+	_, err = client.Call("/sample", http.MethodGet, nil, nil, nil)
+	testsuite.AssertNotNil(t, "Client without certificate must be rejected", err)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "reload")
+	defer os.RemoveAll(dir)
+	ca, _ := certs.NewAuthority("Test CA", certs.ECDSA, time.Hour)
+	first, _ := ca.IssueServer("localhost")
+	files, err := first.Write(dir, "localhost")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	source := common.NewCertificateSource(0)
+	defer source.Close()
+	testsuite.AssertNil(t, "Add error must be nil", source.Add(files.CertPath, files.KeyPath))
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).WithCertificateSource(source).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+	var served = func() string {
+		conn, err := tls.Dial("tcp", server.Address().String(), &tls.Config{ServerName: "localhost", RootCAs: ca.CertPool()})
+		testsuite.AssertNil(t, "Handshake error must be nil", err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+	testsuite.AssertEquals(t, "Source certificate must be served", first.Certificate.SerialNumber.String(), served())
+	second, _ := ca.IssueServer("localhost")
+	_, err = second.Write(dir, "localhost")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	var modTime = time.Now().Add(time.Minute)
+	_ = os.Chtimes(files.CertPath, modTime, modTime)
+	testsuite.AssertNil(t, "Reload error must be nil", source.Reload())
+	testsuite.AssertEquals(t, "Reloaded certificate must be served without restart", second.Certificate.SerialNumber.String(), served())
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	io2 "github.com/hellgate75/go-network/io"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/encoding"
+	"io"
+	"net/http"
+)
+
+// Makes a call with the given web method, encoding the request (when not nil) with the contentType mime type,
+// and returns the response decoded with the response Content-Type (or the accepts mime type when missing).
+// Status codes not in the 2xx range are returned as *model.ApiError, the response body is always closed.
+func Exchange[Req any, Resp any](ctx context.Context, client model.ApiClient, method string, path string, contentType encoding.MimeType, accepts encoding.MimeType, request *Req) (Resp, error) {
+	var response Resp
+	if client == nil {
+		return response, errors.New(fmt.Sprint("Nil Api Client"))
+	}
+	var body io.Reader
+	var requestMime *encoding.MimeType
+	if request != nil {
+		data, err := io2.Marshal(encoding.ParseMimeType(contentType), request)
+		if err != nil {
+			return response, err
+		}
+		body = bytes.NewBuffer(data)
+		requestMime = &contentType
+	}
+	var acceptsMime *encoding.MimeType
+	if accepts != "" {
+		acceptsMime = &accepts
+	}
+	resp, err := client.CallContext(ctx, path, method, requestMime, acceptsMime, body)
+	if err != nil {
+		return response, err
+	}
+	err = readResponse(resp, accepts, &response)
+	return response, err
+}
+
+// Makes a GET call, returning the json response
+func Get[Resp any](ctx context.Context, client model.ApiClient, path string) (Resp, error) {
+	return Exchange[struct{}, Resp](ctx, client, http.MethodGet, path, encoding.JsonMimeType, encoding.JsonMimeType, nil)
+}
+
+// Makes a POST call with the json encoded request, returning the json response
+func Post[Req any, Resp any](ctx context.Context, client model.ApiClient, path string, request Req) (Resp, error) {
+	return Exchange[Req, Resp](ctx, client, http.MethodPost, path, encoding.JsonMimeType, encoding.JsonMimeType, &request)
+}
+
+// Makes a PUT call with the json encoded request, returning the json response
+func Put[Req any, Resp any](ctx context.Context, client model.ApiClient, path string, request Req) (Resp, error) {
+	return Exchange[Req, Resp](ctx, client, http.MethodPut, path, encoding.JsonMimeType, encoding.JsonMimeType, &request)
+}
+
+// Makes a DELETE call, returning the json response
+func Delete[Resp any](ctx context.Context, client model.ApiClient, path string) (Resp, error) {
+	return Exchange[struct{}, Resp](ctx, client, http.MethodDelete, path, encoding.JsonMimeType, encoding.JsonMimeType, nil)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/hellgate75/go-network/api/auth"
+	"github.com/hellgate75/go-network/api/builders"
+	"github.com/hellgate75/go-network/log"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/testsuite"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type wsSample struct {
+	Value int `json:"value"`
+}
+
+func TestWebSocketEchoAndBroadcast(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	handler, err := builders.NewWebSocketHandlerBuilder().
+		WithPath("/ws").
+		WithPing(time.Second, 0).
+		With(func(c context2.WebSocketContext) error {
+			for {
+				var message wsSample
+				if err := c.ReadMessage(&message); err != nil {
+					return nil
+				}
+				message.Value++
+				if err := c.WriteMessage(&message); err != nil {
+					return err
+				}
+			}
+		}).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddWebSocket error must be nil", server.AddWebSocket(handler))
+	testsuite.AssertNotNil(t, "Duplicated path must be rejected", server.AddWebSocket(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/ws", server.Address()), nil)
+	testsuite.AssertNil(t, "Dial error must be nil", err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	testsuite.AssertNil(t, "Write error must be nil", conn.WriteJSON(&wsSample{Value: 1}))
+	var response wsSample
+	testsuite.AssertNil(t, "Read error must be nil", conn.ReadJSON(&response))
+	testsuite.AssertEquals(t, "Echoed message must be processed", 2, response.Value)
+
+	testsuite.AssertEquals(t, "Hub must contain the connection", 1, handler.Hub().Count())
+	sent, err := handler.Hub().Broadcast(&wsSample{Value: 10})
+	testsuite.AssertNil(t, "Broadcast error must be nil", err)
+	testsuite.AssertEquals(t, "Broadcast must reach the connection", 1, sent)
+	testsuite.AssertNil(t, "Broadcast read error must be nil", conn.ReadJSON(&response))
+	testsuite.AssertEquals(t, "Broadcast message must be received", 10, response.Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	testsuite.AssertNil(t, "Shutdown error must be nil", server.Shutdown(ctx))
+	_, _, err = conn.ReadMessage()
+	testsuite.AssertEquals(t, "Shutdown must close the connection as going away", true, websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+func TestWebSocketAuthentication(t *testing.T) {
+	config, err := builders.NewServerConfigBuilder().WithHost("127.0.0.1", 0).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewApiServer("Test Api Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	keys := auth.NewApiKeyAuthenticator("")
+	keys.AddKey("reader-key", "alice", "reader")
+	keys.AddKey("writer-key", "bob", "writer")
+	server.UseAuthentication(keys)
+	handler, err := builders.NewWebSocketHandlerBuilder().
+		WithPath("/ws").
+		WithRoles("writer").
+		With(func(c context2.WebSocketContext) error {
+			return c.WriteMessage(&wsSample{Value: len(c.Principal.Name)})
+		}).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddWebSocket error must be nil", server.AddWebSocket(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+
+	var url = fmt.Sprintf("ws://%s/ws", server.Address())
+	for key, status := range map[string]int{
+		"":           http.StatusUnauthorized,
+		"wrong-key":  http.StatusUnauthorized,
+		"reader-key": http.StatusForbidden,
+	} {
+		var header = http.Header{}
+		if key != "" {
+			header.Set(auth.ApiKeyHeader, key)
+		}
+		_, resp, err := websocket.DefaultDialer.Dial(url, header)
+		testsuite.AssertNotNil(t, "Upgrade must be refused", err)
+		testsuite.AssertEquals(t, "Upgrade must be answered with the authorization status", status, resp.StatusCode)
+	}
+	var header = http.Header{}
+	header.Set(auth.ApiKeyHeader, "writer-key")
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	testsuite.AssertNil(t, "Dial error must be nil", err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var response wsSample
+	testsuite.AssertNil(t, "Read error must be nil", conn.ReadJSON(&response))
+	testsuite.AssertEquals(t, "Function must see the principal", len("bob"), response.Value)
+}
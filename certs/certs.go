@@ -0,0 +1,300 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/io"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Key generation algorithm
+type KeyAlgorithm string
+
+const (
+	// ECDSA keys on the P-256 curve
+	ECDSA KeyAlgorithm = "ecdsa"
+	// RSA 2048 bits keys
+	RSA KeyAlgorithm = "rsa"
+)
+
+// Certificate extended key usage
+type Usage int
+
+const (
+	// TLS server certificate
+	ServerUsage Usage = 1 << iota
+	// TLS client certificate
+	ClientUsage
+)
+
+var (
+	// Default validity of the generated certificates
+	DefaultValidity = 365 * 24 * time.Hour
+	// Files permissions of the written certificates, the keys are always written with 0600 permissions
+	CertificateFilePerm os.FileMode = 0644
+)
+
+// Describe the request of a certificate
+type Request struct {
+	// Subject common name
+	CommonName string
+	// Subject organization (empty means none)
+	Organization string
+	// Subject alternative names: DNS names, IP addresses, email addresses and URIs (eg.: spiffe://acme.com/billing)
+	// are recognized by their format
+	Hosts []string
+	// Extended key usage (0 means ServerUsage)
+	Usage Usage
+	// Key algorithm (empty means ECDSA)
+	Algorithm KeyAlgorithm
+	// Certificate validity (0 means DefaultValidity)
+	Validity time.Duration
+}
+
+// Describe a generated certificate and its private key
+type Certificate struct {
+	// Parsed certificate
+	Certificate *x509.Certificate
+	// Private key
+	Key crypto.Signer
+	// PEM encoded certificate
+	CertPEM []byte
+	// PEM encoded private key (PKCS#8)
+	KeyPEM []byte
+	// Issuing authority, nil for the root authority certificate
+	Authority *Authority
+}
+
+// Files of a written certificate, ready to use with the config builders, eg.:
+// WithTLSCerts(files.CertPath, files.KeyPath).WithClientCaCert(files.CaPath)
+type Files struct {
+	// Certificate file full path
+	CertPath string
+	// Private key file full path
+	KeyPath string
+	// Issuing authority certificate file full path
+	CaPath string
+}
+
+// Self-signed certificate authority, issuing server and client certificates. It is meant for the local
+// development and the tests, not for production use
+type Authority struct {
+	Certificate
+}
+
+func generateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	switch algorithm {
+	case ECDSA, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported key algorithm %s", algorithm))
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+}
+
+// Returns the key identifier of the given public key
+func subjectKeyId(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var sum = sha1.Sum(der)
+	return sum[:], nil
+}
+
+// Creates the certificate of the given template, signed by the given parent (self-signed when nil)
+func create(template *x509.Certificate, key crypto.Signer, parent *Certificate) (Certificate, error) {
+	var err error
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return Certificate{}, err
+	}
+	if template.SubjectKeyId, err = subjectKeyId(key.Public()); err != nil {
+		return Certificate{}, err
+	}
+	var parentCert, parentKey = template, key
+	if parent != nil {
+		parentCert, parentKey = parent.Certificate, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, key.Public(), parentKey)
+	if err != nil {
+		return Certificate{}, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return Certificate{}, err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{
+		Certificate: cert,
+		Key:         key,
+		CertPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	}, nil
+}
+
+// Issues a certificate signed by the authority, as described by the given request
+func (a *Authority) Issue(request Request) (*Certificate, error) {
+	if request.CommonName == "" && len(request.Hosts) == 0 {
+		return nil, errors.New(fmt.Sprint("Certificate request needs a common name or hosts"))
+	}
+	key, err := generateKey(request.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var validity = request.Validity
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	var usage = request.Usage
+	if usage == 0 {
+		usage = ServerUsage
+	}
+	var now = time.Now()
+	var template = &x509.Certificate{
+		Subject:               pkix.Name{CommonName: request.CommonName},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		AuthorityKeyId:        a.Certificate.Certificate.SubjectKeyId,
+	}
+	if request.Organization != "" {
+		template.Subject.Organization = []string{request.Organization}
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if usage&ServerUsage != 0 {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if usage&ClientUsage != 0 {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	for _, host := range request.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if uri, err := url.Parse(host); err == nil && uri.Scheme != "" && uri.Host != "" {
+			template.URIs = append(template.URIs, uri)
+		} else if address, err := mail.ParseAddress(host); err == nil && address.Address == host {
+			template.EmailAddresses = append(template.EmailAddresses, host)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	cert, err := create(template, key, &a.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	cert.Authority = a
+	return &cert, nil
+}
+
+// Issues a server certificate for the given hosts, the first one is the common name
+func (a *Authority) IssueServer(hosts ...string) (*Certificate, error) {
+	var request = Request{Hosts: hosts, Usage: ServerUsage}
+	if len(hosts) > 0 {
+		request.CommonName = hosts[0]
+	}
+	return a.Issue(request)
+}
+
+// Issues a client certificate with the given common name and subject alternative names
+func (a *Authority) IssueClient(commonName string, hosts ...string) (*Certificate, error) {
+	return a.Issue(Request{CommonName: commonName, Hosts: hosts, Usage: ClientUsage})
+}
+
+// Returns a pool containing the authority certificate, trusting the certificates it issues
+func (a *Authority) CertPool() *x509.CertPool {
+	var pool = x509.NewCertPool()
+	pool.AddCert(a.Certificate.Certificate)
+	return pool
+}
+
+// Writes the authority certificate to the <name>.crt file of the given folder, created when missing,
+// and returns its full path
+func (a *Authority) WriteCertificate(dir string, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	var path = filepath.Join(dir, name+".crt")
+	return path, io.WriteFile(path, a.CertPEM, CertificateFilePerm, true)
+}
+
+// Returns the certificate and key pair, ready for a tls.Config
+func (c *Certificate) TLSCertificate() (tls.Certificate, error) {
+	return tls.X509KeyPair(c.CertPEM, c.KeyPEM)
+}
+
+// Writes the certificate and the private key to the <name>.crt and <name>.key files of the given folder, created
+// when missing, and the issuing authority certificate to the ca.crt file. Existing files are replaced
+func (c *Certificate) Write(dir string, name string) (Files, error) {
+	var files = Files{
+		CertPath: filepath.Join(dir, name+".crt"),
+		KeyPath:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return files, err
+	}
+	if err := io.WriteFile(files.CertPath, c.CertPEM, CertificateFilePerm, true); err != nil {
+		return files, err
+	}
+	if err := io.WriteFile(files.KeyPath, c.KeyPEM, 0600, true); err != nil {
+		return files, err
+	}
+	if c.Authority != nil {
+		var err error
+		if files.CaPath, err = c.Authority.WriteCertificate(dir, "ca"); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// Creates a self-signed root certificate authority with the given common name and key algorithm,
+// valid for the given time (0 means DefaultValidity)
+func NewAuthority(commonName string, algorithm KeyAlgorithm, validity time.Duration) (*Authority, error) {
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	var now = time.Now()
+	cert, err := create(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{cert}, nil
+}
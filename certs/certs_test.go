@@ -0,0 +1,60 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	for _, algorithm := range []KeyAlgorithm{ECDSA, RSA} {
+		ca, err := NewAuthority("Test CA", algorithm, time.Hour)
+		testsuite.AssertNil(t, "Authority error must be nil", err)
+		testsuite.AssertEquals(t, "Authority must be a CA", true, ca.Certificate.Certificate.IsCA)
+		cert, err := ca.Issue(Request{
+			CommonName: "billing",
+			Hosts:      []string{"billing.acme.com", "127.0.0.1", "ops@acme.com", "spiffe://acme.com/billing"},
+			Usage:      ServerUsage | ClientUsage,
+			Algorithm:  algorithm,
+		})
+		testsuite.AssertNil(t, "Issue error must be nil", err)
+		var leaf = cert.Certificate
+		testsuite.AssertEquals(t, "DNS names must be set", "billing.acme.com", leaf.DNSNames[0])
+		testsuite.AssertEquals(t, "IP addresses must be set", "127.0.0.1", leaf.IPAddresses[0].String())
+		testsuite.AssertEquals(t, "Email addresses must be set", "ops@acme.com", leaf.EmailAddresses[0])
+		testsuite.AssertEquals(t, "URIs must be set", "spiffe://acme.com/billing", leaf.URIs[0].String())
+		for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: ca.CertPool(), KeyUsages: []x509.ExtKeyUsage{usage}})
+			testsuite.AssertNil(t, "Certificate must be verified by the authority", err)
+		}
+		_, err = cert.TLSCertificate()
+		testsuite.AssertNil(t, "Key pair error must be nil", err)
+	}
+	ca, _ := NewAuthority("Test CA", ECDSA, 0)
+	server, _ := ca.IssueServer("localhost")
+	_, err := server.Certificate.Verify(x509.VerifyOptions{Roots: ca.CertPool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	testsuite.AssertNotNil(t, "Server certificate must not be valid for clients", err)
+	_, err = ca.Issue(Request{})
+	testsuite.AssertNotNil(t, "Empty request must be rejected", err)
+}
+
+func TestWrite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ca, _ := NewAuthority("Test CA", ECDSA, time.Hour)
+	cert, _ := ca.IssueClient("billing")
+	files, err := cert.Write(dir+"/client", "billing")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	_, err = tls.LoadX509KeyPair(files.CertPath, files.KeyPath)
+	testsuite.AssertNil(t, "Written key pair must be loaded", err)
+	info, err := os.Stat(files.KeyPath)
+	testsuite.AssertNil(t, "Key file must exist", err)
+	testsuite.AssertEquals(t, "Key file must be private", os.FileMode(0600), info.Mode().Perm())
+	data, err := ioutil.ReadFile(files.CaPath)
+	testsuite.AssertNil(t, "Authority file must exist", err)
+	testsuite.AssertByteArraysEquals(t, "Authority file must contain the authority certificate", ca.CertPEM, data)
+}
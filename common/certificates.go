@@ -0,0 +1,246 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Describe the outcome of a certificate reload
+type CertificateEvent struct {
+	// Certificate file full path
+	CertPath string
+	// Certificate key file full path
+	KeyPath string
+	// Reload error, nil when the new certificate is in use. On error the previous certificate stays in use
+	Err error
+}
+
+// Describes a function notified of each certificate reload
+type CertificateListener func(event CertificateEvent)
+
+type certificatePair struct {
+	certPath  string
+	keyPath   string
+	certState string
+	keyState  string
+	cert      *tls.Certificate
+	names     []string
+}
+
+// Source of the TLS server certificates, loaded from certificate and key files and reloaded when the files change,
+// without restarting the servers. Certificates are selected by the client requested server name (SNI), matching the
+// certificate DNS names (including wildcards) or common name, the first added certificate is the default one
+type CertificateSource struct {
+	sync.RWMutex
+	pairs     []*certificatePair
+	byName    map[string]*tls.Certificate
+	listeners []CertificateListener
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Returns the files state, changing when they are modified
+func fileState(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%v-%v", info.ModTime().UnixNano(), info.Size())
+}
+
+// Returns the names served by the given certificate
+func certificateNames(cert *tls.Certificate) ([]string, error) {
+	var leaf = cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+		cert.Leaf = leaf
+	}
+	var names = make([]string, 0)
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	return names, nil
+}
+
+func loadPair(pair *certificatePair) error {
+	pair.certState, pair.keyState = fileState(pair.certPath), fileState(pair.keyPath)
+	cert, err := tls.LoadX509KeyPair(pair.certPath, pair.keyPath)
+	if err != nil {
+		return err
+	}
+	names, err := certificateNames(&cert)
+	if err != nil {
+		return err
+	}
+	pair.cert, pair.names = &cert, names
+	return nil
+}
+
+// Rebuilds the server names index, the certificates added first win on the same name
+func (s *CertificateSource) index() {
+	s.byName = make(map[string]*tls.Certificate)
+	for i := len(s.pairs) - 1; i >= 0; i-- {
+		for _, name := range s.pairs[i].names {
+			s.byName[name] = s.pairs[i].cert
+		}
+	}
+}
+
+// Loads the given certificate and key files and adds them to the source. It reports the loading errors
+func (s *CertificateSource) Add(certPath string, keyPath string) error {
+	var pair = &certificatePair{
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+	if err := loadPair(pair); err != nil {
+		return errors.New(fmt.Sprintf("Unable to load certificate %s: %v", certPath, err))
+	}
+	defer s.Unlock()
+	s.Lock()
+	s.pairs = append(s.pairs, pair)
+	s.index()
+	return nil
+}
+
+// Adds a listener notified of each certificate reload, successful or failed
+func (s *CertificateSource) OnReload(listener CertificateListener) {
+	if listener == nil {
+		return
+	}
+	defer s.Unlock()
+	s.Lock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// Reloads the certificates whose files changed since the last load, and returns the first reload error.
+// Certificates failing to reload stay in use, until their files change again
+func (s *CertificateSource) Reload() error {
+	s.Lock()
+	var events = make([]CertificateEvent, 0)
+	var changed = false
+	for _, pair := range s.pairs {
+		if fileState(pair.certPath) == pair.certState && fileState(pair.keyPath) == pair.keyState {
+			continue
+		}
+		var reloaded = *pair
+		var err = loadPair(&reloaded)
+		if err == nil {
+			changed = true
+		} else {
+			// The previous certificate stays in use
+			err = errors.New(fmt.Sprintf("Unable to reload certificate %s: %v", pair.certPath, err))
+		}
+		*pair = reloaded
+		events = append(events, CertificateEvent{
+			CertPath: pair.certPath,
+			KeyPath:  pair.keyPath,
+			Err:      err,
+		})
+	}
+	if changed {
+		s.index()
+	}
+	var listeners = append(make([]CertificateListener, 0), s.listeners...)
+	s.Unlock()
+	var err error
+	for _, event := range events {
+		if event.Err != nil && err == nil {
+			err = event.Err
+		}
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+	return err
+}
+
+// Returns the certificate matching the client requested server name, or the default certificate.
+// It is the tls.Config GetCertificate function
+func (s *CertificateSource) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	defer s.RUnlock()
+	s.RLock()
+	if len(s.pairs) == 0 {
+		return nil, errors.New(fmt.Sprint("No certificate available"))
+	}
+	var name = strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := s.byName[name]; ok {
+			return cert, nil
+		}
+		if i := strings.Index(name, "."); i > 0 {
+			if cert, ok := s.byName["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return s.pairs[0].cert, nil
+}
+
+// Returns the default certificate, presented by the clients to the servers requesting it.
+// It is the tls.Config GetClientCertificate function
+func (s *CertificateSource) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	defer s.RUnlock()
+	s.RLock()
+	if len(s.pairs) == 0 {
+		// No certificate is sent
+		return &tls.Certificate{}, nil
+	}
+	return s.pairs[0].cert, nil
+}
+
+// Sets up the given configuration for serving the source certificates, in place of the static ones
+func (s *CertificateSource) ApplyTo(config *tls.Config) {
+	config.Certificates = nil
+	config.GetCertificate = s.GetCertificate
+	config.GetClientCertificate = s.GetClientCertificate
+}
+
+// Stops watching the certificate files
+func (s *CertificateSource) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *CertificateSource) watch(interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Errors are reported to the listeners
+			_ = s.Reload()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Creates an empty certificate source, checking the certificate files for changes at the given interval
+// (0 means no automatic check, certificates are reloaded calling Reload, eg.: on SIGHUP).
+// The source must be closed when it is no longer used
+func NewCertificateSource(interval time.Duration) *CertificateSource {
+	var source = &CertificateSource{
+		pairs:     make([]*certificatePair, 0),
+		byName:    make(map[string]*tls.Certificate),
+		listeners: make([]CertificateListener, 0),
+		done:      make(chan struct{}),
+	}
+	if interval > 0 {
+		go source.watch(interval)
+	}
+	return source
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var serial int64 = 0
+
+// Writes a self-signed certificate for the given names, with a modification time in the future, so each write
+// is detected as a change
+func writeSelfSigned(t *testing.T, dir string, file string, names ...string) int64 {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial++
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	testsuite.AssertNil(t, "Certificate error must be nil", err)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	var certPath, keyPath = filepath.Join(dir, file+".crt"), filepath.Join(dir, file+".key")
+	_ = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	var modTime = time.Now().Add(time.Duration(serial) * time.Second)
+	_ = os.Chtimes(certPath, modTime, modTime)
+	_ = os.Chtimes(keyPath, modTime, modTime)
+	return serial
+}
+
+func servedSerial(source *CertificateSource, serverName string) int64 {
+	cert, err := source.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return -1
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertificateSource(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certificates")
+	defer os.RemoveAll(dir)
+	var alpha = writeSelfSigned(t, dir, "alpha", "alpha.local", "*.alpha.local")
+	var beta = writeSelfSigned(t, dir, "beta", "beta.local")
+	var source = NewCertificateSource(0)
+	defer source.Close()
+	testsuite.AssertNil(t, "Add error must be nil", source.Add(filepath.Join(dir, "alpha.crt"), filepath.Join(dir, "alpha.key")))
+	testsuite.AssertNil(t, "Add error must be nil", source.Add(filepath.Join(dir, "beta.crt"), filepath.Join(dir, "beta.key")))
+	testsuite.AssertNotNil(t, "Missing files must be reported", source.Add(filepath.Join(dir, "gamma.crt"), filepath.Join(dir, "gamma.key")))
+	testsuite.AssertEquals(t, "Server name must select the certificate", beta, servedSerial(source, "BETA.local"))
+	testsuite.AssertEquals(t, "Wildcard must select the certificate", alpha, servedSerial(source, "api.alpha.local"))
+	testsuite.AssertEquals(t, "Unknown names must get the default certificate", alpha, servedSerial(source, "other.local"))
+
+	var events = make([]CertificateEvent, 0)
+	source.OnReload(func(event CertificateEvent) {
+		events = append(events, event)
+	})
+	testsuite.AssertNil(t, "Reload of unchanged files must succeed", source.Reload())
+	testsuite.AssertEquals(t, "Unchanged files must not be reloaded", 0, len(events))
+	var renewed = writeSelfSigned(t, dir, "beta", "beta.local")
+	testsuite.AssertNil(t, "Reload error must be nil", source.Reload())
+	testsuite.AssertEquals(t, "Renewed certificate must be served", renewed, servedSerial(source, "beta.local"))
+	testsuite.AssertEquals(t, "Reload must be notified", 1, len(events))
+	testsuite.AssertNil(t, "Successful reload event must have no error", events[0].Err)
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "beta.key"), []byte("broken"), 0600)
+	testsuite.AssertNotNil(t, "Broken key must be reported", source.Reload())
+	testsuite.AssertEquals(t, "Failed reload must be notified", 2, len(events))
+	testsuite.AssertNotNil(t, "Failed reload event must have the error", events[1].Err)
+	testsuite.AssertEquals(t, "Previous certificate must stay in use", renewed, servedSerial(source, "beta.local"))
+}
+
+func TestCertificateSourceWatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certificates")
+	defer os.RemoveAll(dir)
+	writeSelfSigned(t, dir, "alpha", "alpha.local")
+	var source = NewCertificateSource(10 * time.Millisecond)
+	defer source.Close()
+	testsuite.AssertNil(t, "Add error must be nil", source.Add(filepath.Join(dir, "alpha.crt"), filepath.Join(dir, "alpha.key")))
+	var reloaded = make(chan CertificateEvent, 1)
+	source.OnReload(func(event CertificateEvent) {
+		reloaded <- event
+	})
+	var renewed = writeSelfSigned(t, dir, "alpha", "alpha.local")
+	select {
+	case event := <-reloaded:
+		testsuite.AssertNil(t, "Watched reload error must be nil", event.Err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Changed files must be reloaded by the watcher")
+	}
+	testsuite.AssertEquals(t, "Renewed certificate must be served", renewed, servedSerial(source, ""))
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Describes a component that can be shut down gracefully (eg.: ApiServer, TcpServer and PipeNode)
+type GracefulShutdown interface {
+	// Stops the component, waiting for the in-flight work until the context is done
+	Shutdown(ctx context.Context) error
+}
+
+// Waits until the process receives one of the given signals (SIGTERM and SIGINT when none is given),
+// and returns the received signal
+func WaitForSignal(signals ...os.Signal) os.Signal {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+	var ch = make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+	return <-ch
+}
+
+// Shuts down the given components concurrently, each of them within the given timeout (0 means no timeout).
+// It returns the first error reported by the components
+func ShutdownAll(timeout time.Duration, components ...GracefulShutdown) error {
+	var ctx = context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var errs = make([]error, len(components))
+	var wg = sync.WaitGroup{}
+	for i, component := range components {
+		if component == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, component GracefulShutdown) {
+			defer wg.Done()
+			errs[i] = component.Shutdown(ctx)
+		}(i, component)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waits for SIGTERM or SIGINT, then shuts down the given components within the given timeout.
+// It returns the first error reported by the components
+func ShutdownOnSignal(timeout time.Duration, components ...GracefulShutdown) error {
+	WaitForSignal()
+	return ShutdownAll(timeout, components...)
+}
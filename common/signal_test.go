@@ -0,0 +1,36 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/hellgate75/go-network/testsuite"
+	"testing"
+	"time"
+)
+
+type sampleComponent struct {
+	duration time.Duration
+	stopped  bool
+}
+
+func (c *sampleComponent) Shutdown(ctx context.Context) error {
+	select {
+	case <-time.After(c.duration):
+		c.stopped = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestShutdownAll(t *testing.T) {
+	var fast, slow = &sampleComponent{duration: 10 * time.Millisecond}, &sampleComponent{duration: 50 * time.Millisecond}
+	err := ShutdownAll(time.Second, fast, nil, slow)
+	testsuite.AssertNil(t, "Shutdown within the timeout must succeed", err)
+	testsuite.AssertEquals(t, "All components must be stopped", true, fast.stopped && slow.stopped)
+	var stuck = &sampleComponent{duration: time.Minute}
+	var start = time.Now()
+	err = ShutdownAll(50*time.Millisecond, &sampleComponent{}, stuck)
+	testsuite.AssertEquals(t, "Shutdown beyond the timeout must report the deadline", true, errors.Is(err, context.DeadlineExceeded))
+	testsuite.AssertEquals(t, "Shutdown must return at the timeout", true, time.Now().Sub(start) < time.Second)
+}
@@ -2,16 +2,14 @@ package io
 
 import (
 	"encoding/base64"
-	"encoding/json"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"github.com/hellgate75/go-network/model/encoding"
-	"gopkg.in/yaml.v2"
 	"os"
 )
 
-// Unmarshal bytes and fill the given interface (pointer to structure) with given encoding type
+// Unmarshal bytes and fill the given interface (pointer to structure) with given encoding type,
+// using the codec registered for the encoding (see encoding.RegisterEncoding)
 func Unmarshal(data []byte, encodingValue encoding.Encoding, target interface{}) error {
 	var err error
 	defer func() {
@@ -19,24 +17,13 @@ func Unmarshal(data []byte, encodingValue encoding.Encoding, target interface{})
 			err = errors.New(fmt.Sprintf("io.Unmashal() - Error: %v", r))
 		}
 	}()
-	switch encodingValue {
-	case encoding.EncodingJSONFormat:
-		err = json.Unmarshal(data, target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Unmashal() - Error: %v", err))
-		}
-	case encoding.EncodingYAMLFormat:
-		err = yaml.Unmarshal(data, target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Unmashal() - Error: %v", err))
-		}
-	case encoding.EncodingXMLFormat:
-		err = xml.Unmarshal(data, target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Unmashal() - Error: %v", err))
-		}
-	default:
-		err = errors.New(fmt.Sprintf("io.Unmashal() - Error: Unknown encoding type <%v>", encodingValue))
+	codec, ok := encoding.GetCodec(encodingValue)
+	if !ok {
+		return errors.New(fmt.Sprintf("io.Unmashal() - Error: Unknown encoding type <%v>", encodingValue))
+	}
+	err = codec.Unmarshal(data, target)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("io.Unmashal() - Error: %v", err))
 	}
 	return err
 }
@@ -59,7 +46,8 @@ func UnmarshalFile(file string, encodingValue encoding.Encoding, target interfac
 }
 
 
-// Marshal given interface (pointer to structure) in bytes with given encoding type
+// Marshal given interface (pointer to structure) in bytes with given encoding type,
+// using the codec registered for the encoding (see encoding.RegisterEncoding)
 func Marshal(encodingValue encoding.Encoding, target interface{}) ([]byte, error) {
 	var err error
 	var data = make([]byte, 0)
@@ -68,24 +56,13 @@ func Marshal(encodingValue encoding.Encoding, target interface{}) ([]byte, error
 			err = errors.New(fmt.Sprintf("io.Marshal() - Error: %v", r))
 		}
 	}()
-	switch encodingValue {
-	case encoding.EncodingJSONFormat:
-		data, err = json.Marshal(target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Marshal() - Error: %v", err))
-		}
-	case encoding.EncodingYAMLFormat:
-		data, err = yaml.Marshal(target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Marshal() - Error: %v", err))
-		}
-	case encoding.EncodingXMLFormat:
-		data, err = xml.Marshal(target)
-		if err != nil {
-			err = errors.New(fmt.Sprintf("io.Marshal() - Error: %v", err))
-		}
-	default:
-		err = errors.New(fmt.Sprintf("io.Marshal() - Error: Unknown encoding type <%v>", encodingValue))
+	codec, ok := encoding.GetCodec(encodingValue)
+	if !ok {
+		return data, errors.New(fmt.Sprintf("io.Marshal() - Error: Unknown encoding type <%v>", encodingValue))
+	}
+	data, err = codec.Marshal(target)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("io.Marshal() - Error: %v", err))
 	}
 	return data, err
 }
@@ -3,8 +3,7 @@ package io
 import (
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/hellgate75/go-cron/io"
-	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/encoding"
 	"github.com/hellgate75/go-network/testsuite"
 	"io/ioutil"
 	"os"
@@ -27,7 +26,7 @@ func TestMarshalJson(t *testing.T) {
 		"Torelli",
 		45,
 	}
-	bytes, err := Marshal(model.EncodingJSONFormat, &tStruct)
+	bytes, err := Marshal(encoding.EncodingJSONFormat, &tStruct)
 	testsuite.AssertNil(t, "Marshal operation error must be nil", err)
 	testsuite.AssertByteArraysEquals(t, "Json data array must be same", testJsonDataBytes, bytes)
 
@@ -49,7 +48,7 @@ func TestUnmarshalJson(t *testing.T) {
 		Surname		string `json:"surname,omitempty"`
 		Age			int 	`json:"age,omitempty"`
 	}{}
-	err := Unmarshal(testJsonDataBytes, model.EncodingJSONFormat, &tStruct)
+	err := Unmarshal(testJsonDataBytes, encoding.EncodingJSONFormat, &tStruct)
 	testsuite.AssertNil(t, "Unmarshal operation error must be nil", err)
 	testsuite.AssertEquals(t, "Structure must be same: name", eStruct.Name, tStruct.Name)
 	testsuite.AssertEquals(t, "Structure must be same: surname", eStruct.Surname, tStruct.Surname)
@@ -66,7 +65,7 @@ func TestMarshalYaml(t *testing.T) {
 		"Torelli",
 		45,
 	}
-	bytes, err := Marshal(model.EncodingYAMLFormat, &tStruct)
+	bytes, err := Marshal(encoding.EncodingYAMLFormat, &tStruct)
 	testsuite.AssertNil(t, "Marshal operation error must be nil", err)
 	testsuite.AssertByteArraysEquals(t, "Yaml data array must be same", testYamlDataBytes, bytes)
 }
@@ -86,7 +85,7 @@ func TestUnmarshalYaml(t *testing.T) {
 		Surname		string `yaml:"surname,omitempty"`
 		Age			int 	`yaml:"age,omitempty"`
 	}{}
-	err := Unmarshal(testYamlDataBytes, model.EncodingYAMLFormat, &tStruct)
+	err := Unmarshal(testYamlDataBytes, encoding.EncodingYAMLFormat, &tStruct)
 	testsuite.AssertNil(t, "Unmarshal operation error must be nil", err)
 	testsuite.AssertEquals(t, "Structure must be same: name", eStruct.Name, tStruct.Name)
 	testsuite.AssertEquals(t, "Structure must be same: surname", eStruct.Surname, tStruct.Surname)
@@ -105,7 +104,7 @@ func TestMarshalXml(t *testing.T) {
 		"Torelli",
 		45,
 	}
-	bytes, err := Marshal(model.EncodingXMLFormat, &tStruct)
+	bytes, err := Marshal(encoding.EncodingXMLFormat, &tStruct)
 	testsuite.AssertNil(t, "Marshal operation error must be nil", err)
 	testsuite.AssertByteArraysEquals(t, "Xml data array must be same", testXmlDataBytes, bytes)
 }
@@ -117,7 +116,7 @@ func TestUnmarshalXml(t *testing.T) {
 		45,
 	}
 	var tStruct = sampleXML{}
-	err := Unmarshal(testXmlDataBytes, model.EncodingXMLFormat, &tStruct)
+	err := Unmarshal(testXmlDataBytes, encoding.EncodingXMLFormat, &tStruct)
 	testsuite.AssertNil(t, "Unmarshal operation error must be nil", err)
 	testsuite.AssertEquals(t, "Structure must be same: name", eStruct.Name, tStruct.Name)
 	testsuite.AssertEquals(t, "Structure must be same: surname", eStruct.Surname, tStruct.Surname)
@@ -125,7 +124,7 @@ func TestUnmarshalXml(t *testing.T) {
 }
 
 func generateFilePath() string {
-	dir := fmt.Sprintf("%s", io.HomeFolder())
+	dir := fmt.Sprintf("%s", HomeFolder())
 	if ! ExistsFile(dir) {
 		_ = CreateFolders(dir, 0777)
 	}
@@ -144,7 +143,7 @@ func TestMarshalFile(t *testing.T) {
 		"Torelli",
 		45,
 	}
-	err := MarshalToFile(path, 0777, model.EncodingJSONFormat, &tStruct)
+	err := MarshalToFile(path, 0777, encoding.EncodingJSONFormat, &tStruct)
 	testsuite.AssertNil(t, "Marshal operation error must be nil", err)
 	defer func() {
 		_ = os.Remove(path)
@@ -171,7 +170,7 @@ func TestUnMarshalFile(t *testing.T) {
 	}{}
 	err := ioutil.WriteFile(path, testJsonDataBytes, 0777)
 	testsuite.AssertNil(t, "File bytes write operation error must be nil", err)
-	err = UnmarshalFile(path, model.EncodingJSONFormat, &tStruct)
+	err = UnmarshalFile(path, encoding.EncodingJSONFormat, &tStruct)
 	testsuite.AssertNil(t, "Unmarshal operation error must be nil", err)
 	defer func() {
 		_ = os.Remove(path)
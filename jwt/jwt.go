@@ -0,0 +1,352 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/api/auth"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Authentication method of the JWT principals
+	JwtMethod = "jwt"
+	// Default token time to live
+	DefaultTTL = 15 * time.Minute
+	// Default tolerance of the clock differences between issuers and verifiers
+	DefaultClockSkew = 30 * time.Second
+)
+
+// Token audience, encoded as a single string or as an array
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// Reports if the audience contains the given value
+func (a Audience) Contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Registered claims of a token, and the roles claim
+type Claims struct {
+	// Token issuer
+	Issuer string `json:"iss,omitempty"`
+	// Token subject, the principal name
+	Subject string `json:"sub,omitempty"`
+	// Token recipients
+	Audience Audience `json:"aud,omitempty"`
+	// Expiration time, in Unix seconds
+	ExpiresAt int64 `json:"exp,omitempty"`
+	// Time before which the token is not valid, in Unix seconds
+	NotBefore int64 `json:"nbf,omitempty"`
+	// Issue time, in Unix seconds
+	IssuedAt int64 `json:"iat,omitempty"`
+	// Unique token identifier
+	Id string `json:"jti,omitempty"`
+	// Granted roles
+	Roles []string `json:"roles,omitempty"`
+	// All the token claims, including the registered ones
+	Values map[string]interface{} `json:"-"`
+}
+
+// Returns the principal identified by the claims
+func (c *Claims) Principal() *context.Principal {
+	return &context.Principal{
+		Name:   c.Subject,
+		Roles:  append(make([]string, 0), c.Roles...),
+		Method: JwtMethod,
+		Claims: c.Values,
+	}
+}
+
+// Token issuing and verification options
+type Options struct {
+	// Issuer set in the issued tokens, and required in the verified ones when not empty
+	Issuer string
+	// Audience set in the issued tokens, and required in the verified ones when not empty
+	Audience string
+	// Time to live of the issued tokens (0 means DefaultTTL)
+	TTL time.Duration
+	// Tolerance of the clock differences, applied to the verified tokens time claims (0 means DefaultClockSkew,
+	// negative values mean no tolerance)
+	ClockSkew time.Duration
+	// Realm sent in the 401 Unauthorized challenges
+	Realm string
+}
+
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ,omitempty"`
+	KeyId     string    `json:"kid,omitempty"`
+}
+
+// Issues and verifies the tokens signed with the keys of a key set. The same tokens authenticate the Api Server
+// requests, as a model.Authenticator, and the Tcp Server connections, as first frame validator
+type Tokens struct {
+	keys    *KeySet
+	options Options
+	now     func() time.Time
+}
+
+var (
+	reservedClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "roles"}
+	encoder        = base64.RawURLEncoding
+)
+
+// Issues a token for the given principal, signed with the key set signer. The token carries the principal
+// name as subject, the principal roles, and the principal claims not overridden by the registered ones
+func (t *Tokens) Issue(principal context.Principal) (string, error) {
+	var key = t.keys.Signer()
+	if key == nil {
+		return "", errors.New(fmt.Sprint("Key set has no signing key"))
+	}
+	var now = t.now()
+	var ttl = t.options.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	var values = make(map[string]interface{})
+	for name, value := range principal.Claims {
+		values[name] = value
+	}
+	for _, name := range reservedClaims {
+		delete(values, name)
+	}
+	values["sub"] = principal.Name
+	values["iat"] = now.Unix()
+	values["nbf"] = now.Unix()
+	values["exp"] = now.Add(ttl).Unix()
+	values["jti"] = model.GenerateSecureToken(16)
+	if t.options.Issuer != "" {
+		values["iss"] = t.options.Issuer
+	}
+	if t.options.Audience != "" {
+		values["aud"] = t.options.Audience
+	}
+	if len(principal.Roles) > 0 {
+		values["roles"] = principal.Roles
+	}
+	headerData, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyId: key.Id})
+	if err != nil {
+		return "", err
+	}
+	payloadData, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	var signingInput = encoder.EncodeToString(headerData) + "." + encoder.EncodeToString(payloadData)
+	signature, err := sign(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encoder.EncodeToString(signature), nil
+}
+
+// Verifies the given token signature, time claims, issuer and audience, and returns its claims
+func (t *Tokens) Verify(token string) (*Claims, error) {
+	var parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New(fmt.Sprint("Malformed token"))
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed token header: %v", err))
+	}
+	signature, err := encoder.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed token signature: %v", err))
+	}
+	var keys []*Key
+	if h.KeyId != "" {
+		if key, ok := t.keys.Key(h.KeyId); ok {
+			keys = []*Key{key}
+		}
+	} else {
+		keys = t.keys.keysOf(h.Algorithm)
+	}
+	var verified = false
+	for _, key := range keys {
+		// The key algorithm is never taken from the token, preventing the algorithm substitution
+		if key.Algorithm == h.Algorithm && verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New(fmt.Sprintf("Invalid token signature (alg: %s, kid: %s)", h.Algorithm, h.KeyId))
+	}
+	var claims = &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed token claims: %v", err))
+	}
+	if err := decodeSegment(parts[1], &claims.Values); err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed token claims: %v", err))
+	}
+	return claims, t.validate(claims)
+}
+
+func (t *Tokens) validate(claims *Claims) error {
+	var skew = t.options.ClockSkew
+	if skew == 0 {
+		skew = DefaultClockSkew
+	} else if skew < 0 {
+		skew = 0
+	}
+	var now = t.now()
+	if claims.ExpiresAt == 0 {
+		return errors.New(fmt.Sprint("Token has no expiration"))
+	}
+	if now.Add(-skew).Unix() >= claims.ExpiresAt {
+		return errors.New(fmt.Sprint("Token is expired"))
+	}
+	if claims.NotBefore > 0 && now.Add(skew).Unix() < claims.NotBefore {
+		return errors.New(fmt.Sprint("Token is not valid yet"))
+	}
+	if claims.IssuedAt > 0 && now.Add(skew).Unix() < claims.IssuedAt {
+		return errors.New(fmt.Sprint("Token is issued in the future"))
+	}
+	if t.options.Issuer != "" && claims.Issuer != t.options.Issuer {
+		return errors.New(fmt.Sprintf("Invalid token issuer %s", claims.Issuer))
+	}
+	if t.options.Audience != "" && !claims.Audience.Contains(t.options.Audience) {
+		return errors.New(fmt.Sprintf("Token audience %v does not contain %s", claims.Audience, t.options.Audience))
+	}
+	return nil
+}
+
+func (t *Tokens) Authenticate(r *http.Request) (*context.Principal, error) {
+	var token, ok = auth.BearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		// Tokens of other kinds are left to the other authenticators
+		return nil, nil
+	}
+	claims, err := t.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.Principal(), nil
+}
+
+func (t *Tokens) Challenge() string {
+	return auth.BearerChallenge(t.options.Realm)
+}
+
+// Validates the token sent as first frame of a Tcp connection, storing the principal in the connection map,
+// so it is available to the actions as TcpContext.Principal. It is an interceptors.FrameValidator:
+// interceptors.FirstFrame(tokens.ValidateFrame, timeout, 0)
+func (t *Tokens) ValidateFrame(frame []byte, connectionMap map[string]interface{}) error {
+	claims, err := t.Verify(strings.TrimSpace(string(frame)))
+	if err != nil {
+		return err
+	}
+	connectionMap[context.PrincipalKey] = claims.Principal()
+	return nil
+}
+
+// Returns a Tcp client handshake function, issuing a new token for the given principal on each connection
+func (t *Tokens) Handshake(principal context.Principal) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		token, err := t.Issue(principal)
+		return []byte(token), err
+	}
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := encoder.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func sign(key *Key, data []byte) ([]byte, error) {
+	var digest = sha256.Sum256(data)
+	switch key.Algorithm {
+	case HS256:
+		var mac = hmac.New(sha256.New, key.secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case RS256:
+		return rsa.SignPKCS1v15(rand.Reader, key.private.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case ES256:
+		r, s, err := ecdsa.Sign(rand.Reader, key.private.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// Fixed size concatenation of r and s, as required by the JWS specification
+		var signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported algorithm %s", key.Algorithm))
+}
+
+func verify(key *Key, data []byte, signature []byte) bool {
+	var digest = sha256.Sum256(data)
+	switch key.Algorithm {
+	case HS256:
+		var mac = hmac.New(sha256.New, key.secret)
+		mac.Write(data)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		return rsa.VerifyPKCS1v15(key.public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case ES256:
+		if len(signature) != 64 {
+			return false
+		}
+		var r, s = new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.public.(*ecdsa.PublicKey), digest[:], r, s)
+	}
+	return false
+}
+
+// Creates the tokens issuer and verifier using the keys of the given key set
+func NewTokens(keys *KeySet, options Options) (*Tokens, error) {
+	if keys == nil {
+		return nil, errors.New(fmt.Sprint("Nil key set"))
+	}
+	return &Tokens{
+		keys:    keys,
+		options: options,
+		now:     time.Now,
+	}, nil
+}
+
+var _ model.Authenticator = &Tokens{}
@@ -0,0 +1,171 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/hellgate75/go-network/api/auth"
+	"github.com/hellgate75/go-network/io"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/interceptors"
+	"github.com/hellgate75/go-network/tcp/stream"
+	"github.com/hellgate75/go-network/testsuite"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var principal = context.Principal{
+	Name:   "alice",
+	Roles:  []string{"admin"},
+	Claims: map[string]interface{}{"tenant": "acme", "sub": "mallory"},
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	hsKey, _ := NewHmacKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	rsKey, _ := NewKey("rs", rsaKey)
+	esKey, _ := NewKey("es", ecKey)
+	for _, key := range []*Key{hsKey, rsKey, esKey} {
+		keys, err := NewKeySet(key)
+		testsuite.AssertNil(t, "Key set error must be nil", err)
+		tokens, _ := NewTokens(keys, Options{Issuer: "go-network", Audience: "api"})
+		token, err := tokens.Issue(principal)
+		testsuite.AssertNil(t, "Issue error must be nil", err)
+		claims, err := tokens.Verify(token)
+		testsuite.AssertNil(t, string(key.Algorithm)+" token must be valid", err)
+		var p = claims.Principal()
+		testsuite.AssertEquals(t, "Principal claims must not override the subject", "alice", p.Name)
+		testsuite.AssertEquals(t, "Principal must have the roles", true, p.HasRole("admin"))
+		testsuite.AssertEquals(t, "Custom claims must be kept", "acme", p.Claims["tenant"])
+
+		var parts = strings.Split(token, ".")
+		other, _ := tokens.Issue(context.Principal{Name: "mallory", Roles: []string{"admin"}})
+		_, err = tokens.Verify(parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2])
+		testsuite.AssertNotNil(t, string(key.Algorithm)+" tampered token must be rejected", err)
+
+		verifier, _ := NewTokens(keys, Options{Audience: "tcp"})
+		_, err = verifier.Verify(token)
+		testsuite.AssertNotNil(t, "Token for another audience must be rejected", err)
+	}
+
+	// HS256 token signed with the RSA public key must not verify with the RSA key
+	keys, _ := NewKeySet(rsKey)
+	tokens, _ := NewTokens(keys, Options{})
+	publicDer, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forgedKey, _ := NewHmacKey("rs", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}))
+	forgedKeys, _ := NewKeySet(forgedKey)
+	forger, _ := NewTokens(forgedKeys, Options{})
+	forged, _ := forger.Issue(principal)
+	_, err := tokens.Verify(forged)
+	testsuite.AssertNotNil(t, "Algorithm substitution must be rejected", err)
+}
+
+func TestClockSkewAndRotation(t *testing.T) {
+	first, _ := NewHmacKey("first", []byte("first secret"))
+	keys, _ := NewKeySet(first)
+	tokens, _ := NewTokens(keys, Options{TTL: time.Minute, ClockSkew: 10 * time.Second})
+	token, _ := tokens.Issue(principal)
+	var now = time.Now()
+	tokens.now = func() time.Time { return now.Add(65 * time.Second) }
+	_, err := tokens.Verify(token)
+	testsuite.AssertNil(t, "Token expired within the clock skew must be valid", err)
+	tokens.now = func() time.Time { return now.Add(75 * time.Second) }
+	_, err = tokens.Verify(token)
+	testsuite.AssertNotNil(t, "Token expired beyond the clock skew must be rejected", err)
+	tokens.now = time.Now
+
+	second, _ := NewHmacKey("second", []byte("second secret"))
+	testsuite.AssertNil(t, "Add error must be nil", keys.Add(second, true))
+	rotated, _ := tokens.Issue(principal)
+	testsuite.AssertNotEquals(t, "New tokens must be signed with the new key", token, rotated)
+	_, err = tokens.Verify(token)
+	testsuite.AssertNil(t, "Tokens of the previous key must be valid after rotation", err)
+	keys.Remove("first")
+	_, err = tokens.Verify(token)
+	testsuite.AssertNotNil(t, "Tokens of the removed key must be rejected", err)
+	_, err = tokens.Verify(rotated)
+	testsuite.AssertNil(t, "Tokens of the new key must be valid", err)
+}
+
+func TestLoadFolder(t *testing.T) {
+	var dir = filepath.Join(os.TempDir(), "jwt-keys-"+time.Now().Format("150405.000000"))
+	testsuite.AssertNil(t, "Folder creation error must be nil", os.MkdirAll(dir, 0700))
+	defer os.RemoveAll(dir)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateDer, _ := x509.MarshalECPrivateKey(ecKey)
+	publicDer, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	testsuite.AssertNil(t, "Write error must be nil", io.WriteFile(filepath.Join(dir, "signer.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDer}), 0600, true))
+	testsuite.AssertNil(t, "Write error must be nil", io.WriteFile(filepath.Join(dir, "verifier.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}), 0600, true))
+	issuerKeys, _ := NewKeySet()
+	testsuite.AssertNil(t, "Load error must be nil", issuerKeys.LoadFolder(dir))
+	testsuite.AssertEquals(t, "Private key must be the signer", "signer", issuerKeys.Signer().Id)
+	verifierKey, err := LoadKey("signer", filepath.Join(dir, "verifier.pem"))
+	testsuite.AssertNil(t, "Load error must be nil", err)
+	verifierKeys, _ := NewKeySet(verifierKey)
+	testsuite.AssertEquals(t, "Public key must not sign", true, verifierKeys.Signer() == nil)
+
+	issuer, _ := NewTokens(issuerKeys, Options{})
+	verifier, _ := NewTokens(verifierKeys, Options{})
+	token, err := issuer.Issue(principal)
+	testsuite.AssertNil(t, "Issue error must be nil", err)
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	p, err := verifier.Authenticate(r)
+	testsuite.AssertNil(t, "Authenticate error must be nil", err)
+	testsuite.AssertEquals(t, "Request principal must be the subject", "alice", p.Name)
+	r.Header.Set("Authorization", "bearer "+token)
+	p, err = verifier.Authenticate(r)
+	testsuite.AssertNil(t, "Scheme must be case insensitive", err)
+	testsuite.AssertNotNil(t, "Lowercase scheme principal must not be nil", p)
+	testsuite.AssertEquals(t, "Challenge must be the bearer one", auth.BearerChallenge(""), verifier.Challenge())
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	handshake, _ := issuer.Handshake(principal)()
+	go func() {
+		_ = stream.WriteFrame(client, handshake, 0)
+	}()
+	var connectionMap = make(map[string]interface{})
+	_, err = interceptors.FirstFrame(verifier.ValidateFrame, time.Second, 0)(server, connectionMap)
+	testsuite.AssertNil(t, "First frame error must be nil", err)
+	var tcpContext = context.TcpContext{}.WithContext(context.WithConnectionMap(r.Context(), connectionMap))
+	testsuite.AssertEquals(t, "Connection principal must be the subject", "alice", tcpContext.Principal.Name)
+}
+
+func TestAuthenticationChain(t *testing.T) {
+	key, _ := NewHmacKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	keys, _ := NewKeySet(key)
+	tokens, _ := NewTokens(keys, Options{})
+	hmacTokens, _ := auth.NewHmacTokenAuthenticator([]byte("fedcba9876543210fedcba9876543210"), "api")
+	jwtToken, _ := tokens.Issue(principal)
+	hmacToken, _ := hmacTokens.Issue("bob", time.Minute)
+	for _, authenticators := range [][]model.Authenticator{{hmacTokens, tokens}, {tokens, hmacTokens}} {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+jwtToken)
+		p, err := model.Authenticate(r, authenticators...)
+		testsuite.AssertNil(t, "JWT must be accepted by the chain", err)
+		testsuite.AssertEquals(t, "JWT principal must be authenticated", "alice", p.Name)
+		r.Header.Set("Authorization", "Bearer "+hmacToken)
+		p, err = model.Authenticate(r, authenticators...)
+		testsuite.AssertNil(t, "HMAC token must be accepted by the chain", err)
+		testsuite.AssertEquals(t, "HMAC token principal must be authenticated", "bob", p.Name)
+		r.Header.Set("Authorization", "Bearer "+jwtToken[:len(jwtToken)-4]+"AAAA")
+		p, err = model.Authenticate(r, authenticators...)
+		testsuite.AssertNotNil(t, "Tampered token must be rejected by the chain", err)
+		testsuite.AssertEquals(t, "Tampered token must not authenticate", true, p == nil)
+	}
+}
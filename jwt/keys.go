@@ -0,0 +1,240 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JWT signature algorithm
+type Algorithm string
+
+const (
+	// HMAC with SHA-256
+	HS256 Algorithm = "HS256"
+	// RSASSA-PKCS1-v1_5 with SHA-256
+	RS256 Algorithm = "RS256"
+	// ECDSA with the P-256 curve and SHA-256
+	ES256 Algorithm = "ES256"
+)
+
+// Describe a key signing and/or verifying tokens
+type Key struct {
+	// Key identifier, sent in the token header kid field
+	Id string
+	// Signature algorithm
+	Algorithm Algorithm
+	// HMAC secret, for the HS256 algorithm
+	secret []byte
+	// Private key (nil for verification only keys)
+	private crypto.Signer
+	// Public key
+	public crypto.PublicKey
+}
+
+// Reports if the key can sign tokens
+func (k *Key) CanSign() bool {
+	return len(k.secret) > 0 || k.private != nil
+}
+
+// Creates a HS256 key with the given identifier and secret (at least 32 bytes are suggested)
+func NewHmacKey(id string, secret []byte) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, errors.New(fmt.Sprint("Empty HMAC secret"))
+	}
+	return &Key{
+		Id:        id,
+		Algorithm: HS256,
+		secret:    append(make([]byte, 0), secret...),
+	}, nil
+}
+
+// Creates a RS256 or ES256 key with the given identifier, from a RSA or ECDSA P-256 private or public key
+func NewKey(id string, key interface{}) (*Key, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Id: id, Algorithm: RS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{Id: id, Algorithm: RS256, public: k}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New(fmt.Sprintf("Unsupported elliptic curve %s", k.Curve.Params().Name))
+		}
+		return &Key{Id: id, Algorithm: ES256, private: k, public: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New(fmt.Sprintf("Unsupported elliptic curve %s", k.Curve.Params().Name))
+		}
+		return &Key{Id: id, Algorithm: ES256, public: k}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported key type %T", key))
+}
+
+// Parses the first key of the given PEM data: RSA or EC private keys (PKCS#1, SEC 1 or PKCS#8), public keys (PKIX)
+// and certificates are accepted
+func ParseKey(id string, data []byte) (*Key, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New(fmt.Sprintf("No key found in PEM data of key %s", id))
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error parsing PEM block %s of key %s: %v", block.Type, id, err))
+		}
+		return NewKey(id, key)
+	}
+}
+
+// Loads the key with the given identifier from the given PEM file
+func LoadKey(id string, path string) (*Key, error) {
+	data, err := io.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(id, data)
+}
+
+// Set of keys signing and verifying tokens, safe for concurrent use. Keys are rotated adding a new signing
+// key, while the previous ones keep verifying the tokens already issued until they are removed
+type KeySet struct {
+	sync.RWMutex
+	keys   map[string]*Key
+	signer *Key
+}
+
+// Adds or replaces the given key. Signing keys become the key set signer when signer is true,
+// or when the key set has no signer yet
+func (s *KeySet) Add(key *Key, signer bool) error {
+	if key == nil {
+		return errors.New(fmt.Sprint("Nil key"))
+	}
+	if signer && !key.CanSign() {
+		return errors.New(fmt.Sprintf("Key %s cannot sign tokens", key.Id))
+	}
+	defer s.Unlock()
+	s.Lock()
+	s.keys[key.Id] = key
+	if key.CanSign() && (signer || s.signer == nil) {
+		s.signer = key
+	}
+	return nil
+}
+
+// Removes the key with the given identifier, the tokens it signed are no longer valid
+func (s *KeySet) Remove(id string) {
+	defer s.Unlock()
+	s.Lock()
+	delete(s.keys, id)
+	if s.signer != nil && s.signer.Id == id {
+		s.signer = nil
+	}
+}
+
+// Returns the key with the given identifier
+func (s *KeySet) Key(id string) (*Key, bool) {
+	defer s.RUnlock()
+	s.RLock()
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// Returns the key signing the new tokens, or nil
+func (s *KeySet) Signer() *Key {
+	defer s.RUnlock()
+	s.RLock()
+	return s.signer
+}
+
+// Returns the keys of the given algorithm
+func (s *KeySet) keysOf(alg Algorithm) []*Key {
+	defer s.RUnlock()
+	s.RLock()
+	var keys = make([]*Key, 0)
+	for _, key := range s.keys {
+		if key.Algorithm == alg {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Loads the *.pem files of the given folder, using the file names without extension as key identifiers.
+// The private key of the most recently modified file becomes the signer, so keys are rotated dropping a new
+// private key file in the folder and loading it again
+func (s *KeySet) LoadFolder(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	type loaded struct {
+		key     *Key
+		modTime int64
+	}
+	var keys = make([]loaded, 0)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		key, err := LoadKey(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, loaded{key, info.ModTime().UnixNano()})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].modTime < keys[j].modTime
+	})
+	for _, k := range keys {
+		if err := s.Add(k.key, k.key.CanSign()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a key set with the given keys, the first signing key becomes the signer
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	var set = &KeySet{
+		keys: make(map[string]*Key),
+	}
+	for _, key := range keys {
+		if err := set.Add(key, false); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
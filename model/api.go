@@ -1,9 +1,14 @@
 package model
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	context2 "github.com/hellgate75/go-network/model/context"
 	"github.com/hellgate75/go-network/model/encoding"
 	"io"
+	"net"
 	"net/http"
 	"time"
 )
@@ -13,10 +18,17 @@ type ApiServer interface {
 	// Creates server configuration, and setup the network properties.
 	// It raises exception if the server is already running.
 	Init(config ServerConfig) (ApiServer, error)
-	// Starts API Server and serve requests
+	// Binds the configured host and port and serves the requests in background, bind errors are returned immediately
 	Start() error
-	// Stops API Server and stop requests
+	// Serves the requests in background on the given listener, closed when the server stops
+	StartListener(listener net.Listener) error
+	// Returns the address the server is bound to (useful when the configured port is 0), or nil when not running
+	Address() net.Addr
+	// Stops API Server and stop requests, waiting for the in-flight requests up to the package ServerWaitTimeout
 	Stop() error
+	// Stops accepting new connections and waits for the in-flight requests to complete, until the context is done,
+	// then closes the remaining connections and returns the context error
+	Shutdown(ctx context.Context) error
 	// Verifies API Server is running
 	Running() bool
 	// Verifies API Server is running
@@ -28,6 +40,18 @@ type ApiServer interface {
 	// It raises exception if the API call handler has not method call handling function
 	// or if the Path is duplicate
 	AddPath(ApiCallHandler) error
+	// Add a new WebSocket handler in the api router, upgrading the GET requests of its path.
+	// It raises exception if the Path is empty or duplicate
+	AddWebSocket(WebSocketHandler) error
+	// Add middleware applied to all the path call handlers, also the ones already added.
+	// Server middleware run in the given order, before the authentication, the handler middleware and the action
+	// function, so they have no access to the request principal. Middleware must be added before starting the server
+	Use(middleware ...ApiMiddleware)
+	// Add authenticators used, in the given order, for authenticating the requests of all the path call handlers
+	// and the upgrade requests of all the WebSocket handlers. The authenticated principal is available in the
+	// ApiCallContext and in the WebSocketContext, requests with invalid credentials are answered with the
+	// 401 Unauthorized status. Authenticators must be added before starting the server
+	UseAuthentication(authenticators ...Authenticator)
 }
 
 // Describes an API Client most features
@@ -40,6 +64,45 @@ type ApiClient interface {
 	// Makes a call
 	// Requests must be sent and object with preferred encoding configuration
 	Encode(path string, method string, contentType encoding.MimeType, accepts *encoding.MimeType, request interface{}, response interface{}) error
+	// Makes a call, bound to the given context for cancellation and deadlines
+	// Requests must be sent to the body Reader (preferred: bytes.Buffer)
+	CallContext(ctx context.Context, path string, method string, contentType *encoding.MimeType, accepts *encoding.MimeType, body io.Reader) (*http.Response, error)
+	// Makes a call, bound to the given context for cancellation and deadlines
+	// Requests must be sent and object with preferred encoding configuration
+	EncodeContext(ctx context.Context, path string, method string, contentType encoding.MimeType, accepts *encoding.MimeType, request interface{}, response interface{}) error
+	// Subscribes to the Server-Sent Events stream of the given path, sending the given last event identifier
+	// (empty means none), and calls the handler for each received event. When the stream ends the client reconnects,
+	// resuming from the last received event. It returns when the context is done, the handler returns an error,
+	// the server answers a status different from 200 (204 No Content stops the subscription without error)
+	Subscribe(ctx context.Context, path string, lastEventId string, handler ServerSentEventHandler) error
+	// Returns the circuit breaker statistics, the state is always closed when no circuit breaker is configured
+	BreakerStats() CircuitBreakerStats
+}
+
+// Describe the function handling the events received by a Server-Sent Events subscription
+type ServerSentEventHandler func(event context2.ServerSentEvent) error
+
+// Describes an error answered by the Api Rest Server, with a status code not in the 2xx range.
+// Code and Message are decoded from the response body, when it is encoded with a registered encoding,
+// otherwise Message contains the body text
+type ApiError struct {
+	// Response status code
+	StatusCode	int			`yaml:"-" json:"-" xml:"-"`
+	// Response status text
+	Status		string		`yaml:"-" json:"-" xml:"-"`
+	// Application error code
+	Code		string		`yaml:"code,omitempty" json:"code,omitempty" xml:"code,omitempty"`
+	// Error description
+	Message		string		`yaml:"message,omitempty" json:"message,omitempty" xml:"message,omitempty"`
+	// Raw response body
+	Body		[]byte		`yaml:"-" json:"-" xml:"-"`
+}
+
+func (e *ApiError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("Api Server error <%s> status %v: %s", e.Code, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Api Server error status %v: %s", e.StatusCode, e.Message)
 }
 
 // Describe client connection properties
@@ -54,8 +117,84 @@ type ClientConfig struct {
 	Timeout		time.Duration
 	// Remote API Server Security Configuration
 	Config 		*tls.Config
+	// Calls retry policy (nil means no retries)
+	Retry		*RetryPolicy
+	// Calls circuit breaker policy (nil means no circuit breaker)
+	Breaker		*CircuitBreakerPolicy
+}
+
+// Describe the retry policy of the Api Client calls: failed calls are repeated, waiting an exponential backoff
+// between the attempts. Connection errors and the retryable status codes are retried
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one (0 or 1 means no retries)
+	MaxAttempts				int
+	// Wait time before the first retry
+	InitialBackoff			time.Duration
+	// Maximum wait time between two attempts (0 means no limit)
+	MaxBackoff				time.Duration
+	// Backoff multiplier applied at each retry (0 means 2)
+	Multiplier				float64
+	// Random reduction of the backoff, as a fraction between 0 and 1 (eg.: 0.2 means up to 20% less)
+	Jitter					float64
+	// Response status codes causing a retry (empty means 429, 502, 503 and 504)
+	RetryableStatusCodes	[]int
+	// Retry only idempotent web methods (GET, HEAD, OPTIONS, TRACE, PUT and DELETE)
+	IdempotentOnly			bool
+}
+
+// Describe the circuit breaker policy of the Api Client calls: after the given number of consecutive failures
+// (connection errors or 5xx status codes) the circuit opens and calls fail immediately with ErrCircuitOpen, until
+// the open timeout expires and a single trial call is allowed to close the circuit again
+type CircuitBreakerPolicy struct {
+	// Consecutive failures opening the circuit
+	FailureThreshold	int
+	// Time the circuit stays open before allowing a trial call
+	OpenTimeout			time.Duration
 }
 
+// Circuit breaker state
+type CircuitState byte
+
+const (
+	// Calls are allowed
+	CircuitClosed CircuitState = iota
+	// Calls fail immediately
+	CircuitOpen
+	// A single trial call is allowed
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Describe the circuit breaker statistics, for metrics purposes
+type CircuitBreakerStats struct {
+	// Current state
+	State					CircuitState
+	// Current number of consecutive failures
+	ConsecutiveFailures		int
+	// Number of times the circuit opened
+	Trips					int64
+	// Number of calls rejected while the circuit was open
+	Rejected				int64
+	// Time of the last state change
+	Since					time.Time
+}
+
+var (
+	// Error returned by the Api Client calls while the circuit breaker is open
+	ErrCircuitOpen = errors.New("Circuit breaker is open")
+)
+
 
 // Describe server connection properties
 type ServerConfig struct {
@@ -69,4 +208,13 @@ type ServerConfig struct {
 	CertPath	string
 	// TLS Certificate Key file Full Path
 	KeyPath		string
+	// Maximum size of the requests body in bytes (0 means DefaultMaxBodySize, a negative value means no limit),
+	// larger requests are answered with the 413 Request Entity Too Large status
+	MaxBodySize	int64
 }
+
+const (
+	// Default maximum size of the Api Server requests body in bytes (10 MiB), applied when the server
+	// config MaxBodySize is 0
+	DefaultMaxBodySize int64 = 10 << 20
+)
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"errors"
+	"github.com/hellgate75/go-network/model/context"
+	"net/http"
+)
+
+var (
+	// Error returned when the request credentials are missing or invalid
+	ErrUnauthorized = errors.New("Request is not authenticated")
+	// Error returned when the request principal has not been granted the required roles
+	ErrForbidden = errors.New("Request principal is not authorized")
+)
+
+// Describes an authentication method of the Api Server requests
+type Authenticator interface {
+	// Returns the principal authenticated by the request credentials, or nil when the request carries no credentials
+	// for this authenticator, or credentials of a format it does not handle (eg.: a token of another kind), so the
+	// next authenticators can try them. Invalid credentials are reported with an error
+	Authenticate(r *http.Request) (*context.Principal, error)
+	// Returns the WWW-Authenticate header challenge sent with the 401 Unauthorized responses (eg.: Basic realm="api"),
+	// or empty
+	Challenge() string
+}
+
+// Authenticates the given request using the given authenticators in order: the first principal found is returned,
+// nil when the request carries no credentials. When no authenticator accepts the request credentials, the first
+// reported error is returned
+func Authenticate(r *http.Request, authenticators ...Authenticator) (*context.Principal, error) {
+	var rejection error
+	for _, authenticator := range authenticators {
+		if authenticator == nil {
+			continue
+		}
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			if rejection == nil {
+				rejection = err
+			}
+			continue
+		}
+		if principal != nil {
+			return principal, nil
+		}
+	}
+	return nil, rejection
+}
+
+// Answers the request with the 401 Unauthorized status, sending the authenticators challenges
+func SubmitUnauthorized(w http.ResponseWriter, authenticators ...Authenticator) {
+	for _, authenticator := range authenticators {
+		if authenticator == nil {
+			continue
+		}
+		if challenge := authenticator.Challenge(); challenge != "" {
+			w.Header().Add("WWW-Authenticate", challenge)
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// Describes a function mapping the verified client certificate of a TLS connection to the granted roles,
+// errors reject the client
+type CertificateMapper func(peer *context.PeerCertificate) ([]string, error)
+
+// Returns a certificate mapper granting the roles associated to the client certificate subject common name,
+// or to the whole subject (eg.: CN=billing,OU=services,O=Acme). Unknown subjects are granted no roles
+func SubjectRoles(roles map[string][]string) CertificateMapper {
+	return func(peer *context.PeerCertificate) ([]string, error) {
+		if granted, ok := roles[peer.Subject.CommonName]; ok && peer.Subject.CommonName != "" {
+			return granted, nil
+		}
+		return roles[peer.Subject.String()], nil
+	}
+}
@@ -1,17 +1,30 @@
 package context
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/hellgate75/go-network/io"
 	"github.com/hellgate75/go-network/log"
 	"github.com/hellgate75/go-network/model/encoding"
-	"io/ioutil"
 	"net/http"
 	"strings"
 )
 
+var (
+	// Error returned when the request body mime type has no registered encoding
+	ErrUnsupportedMediaType = errors.New("Unsupported request media type")
+	// Error returned when none of the mime types accepted by the client has a registered encoding
+	ErrNotAcceptable = errors.New("None of the accepted media types is available")
+	// Error returned parsing a request without body
+	ErrEmptyBody = errors.New("Request has no body")
+	// Error returned when the request body exceeds the server maximum body size
+	ErrRequestEntityTooLarge = errors.New("Request body is too large")
+	// Error returned reading a request body limited by LimitBody, once it exceeds the limit
+	ErrMaxBodySizeExceeded = errors.New("Request body exceeds the maximum body size")
+)
+
 // Defines the API Call Context, used as ApiAction single source of  truth information
 type ApiCallContext struct {
 	// Unique request identifier
@@ -34,6 +47,10 @@ type ApiCallContext struct {
 	HandlerMap *map[string]interface{}
 	// Reference to Api Server level cache map element
 	ServerMap *map[string]interface{}
+	// Authenticated request identity, nil for anonymous requests
+	Principal *Principal
+	// Verified client certificate of the TLS connection, nil when the client has not presented any
+	PeerCertificate *PeerCertificate
 	// Reference to Api Server level cache map element
 	Logger log.Logger
 }
@@ -51,29 +68,35 @@ func NewApiCallContext(w http.ResponseWriter,
 		RequestMap:       make(map[string]interface{}),
 		HandlerMap:       nil,
 		ServerMap:        nil,
+		PeerCertificate:  NewPeerCertificate(r.TLS),
 	}
 }
 
+// Returns the request body mime type, without parameters, or application/json when the Content-Type header is missing
 func getContentMime(header http.Header) encoding.MimeType {
-	tp := header.Get("content-type")
-	if tp == "" {
-		tp = header.Get("Content-Type")
-	}
+	tp := header.Get("Content-Type")
 	if tp == "" {
 		return encoding.JsonMimeType
 	}
-	return encoding.MimeType(tp)
+	if i := strings.Index(tp, ";"); i >= 0 {
+		tp = tp[:i]
+	}
+	return encoding.MimeType(strings.ToLower(strings.TrimSpace(tp)))
 }
 
+// Returns the registered mime type best matching the Accept header (or the legacy Accepts header), or empty
+// when no registered mime type is acceptable. Missing header means application/json
 func getResponseMime(header http.Header) encoding.MimeType {
-	tp := header.Get("accepts")
+	tp := header.Get("Accept")
 	if tp == "" {
 		tp = header.Get("Accepts")
 	}
-	if tp == "" {
-		return encoding.JsonMimeType
-	}
-	return encoding.MimeType(tp)
+	return encoding.NegotiateMimeType(tp, encoding.JsonMimeType)
+}
+
+// Returns the request context, cancelled when the client disconnects or the request is completed
+func (ctx *ApiCallContext) Context() context.Context {
+	return ctx.Request.Context()
 }
 
 func (ctx *ApiCallContext) RequestEncoding() encoding.Encoding {
@@ -84,34 +107,35 @@ func (ctx *ApiCallContext) ResponseEncoding() encoding.Encoding {
 	return encoding.ParseMimeType(ctx.ResponseMimeType)
 }
 
+// Reports if the request carries a body, whatever the web method is
 func (ctx *ApiCallContext) CanParseBody() bool {
-	return ctx.Method == "POST"
+	return hasBody(ctx.Request)
 }
 
+// Parses the request body with the encoding related to the request Content-Type. When no encoding is registered
+// for it, the request is answered with the 415 Unsupported Media Type status and ErrUnsupportedMediaType is returned.
+// When the body exceeds the server maximum body size, the request is answered with the 413 Request Entity Too Large
+// status and ErrRequestEntityTooLarge is returned
 func (ctx *ApiCallContext) ParseBody(requestBody interface{}) error {
-	if ctx.Method != "POST" {
-		return errors.New(fmt.Sprintf("Invalid web method: %s for requesting body parsing", ctx.Method))
+	if !ctx.CanParseBody() {
+		return ErrEmptyBody
 	}
-	var encodingValue = encoding.ParseMimeType(ctx.ContentMimeType)
-	if ctx.RequestEncoding() == encoding.EncodingUNKNOWNFormat {
-		return errors.New(fmt.Sprintf("Unable to discover an encoder for mime type: %v", ctx.ContentMimeType))
-	}
-	data, err := ioutil.ReadAll(ctx.Request.Body)
-	if err != nil {
-		return err
-	}
-	err = io.Unmarshal(data, encodingValue, requestBody)
-	return err
+	return ctx.decodeBody(requestBody)
 }
 
+// Writes the response body, with the given status code, using the encoding negotiated with the request
+// Accept header and sets the response Content-Type. When no registered encoding is acceptable, the request
+// is answered with the 406 Not Acceptable status and ErrNotAcceptable is returned
 func (ctx *ApiCallContext) WriteResponse(responseBody interface{}, code int) error {
 	if ctx.ResponseEncoding() == encoding.EncodingUNKNOWNFormat {
-		return errors.New(fmt.Sprintf("Unable to discover an encoder for mime type: %v", ctx.ResponseMimeType))
+		http.Error(ctx.ResponseWriter, fmt.Sprintf("None of the accepted media types is available: %v", ctx.Request.Header.Get("Accept")), http.StatusNotAcceptable)
+		return ErrNotAcceptable
 	}
 	data, err := io.Marshal(ctx.ResponseEncoding(), responseBody)
 	if err != nil {
 		return err
 	}
+	ctx.ResponseWriter.Header().Set("Content-Type", string(ctx.ResponseMimeType))
 	ctx.ResponseWriter.WriteHeader(code)
 	_, err = ctx.ResponseWriter.Write(data)
 	return err
@@ -0,0 +1,518 @@
+package context
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	io2 "github.com/hellgate75/go-network/io"
+	encoding2 "github.com/hellgate75/go-network/model/encoding"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Application error code of the requests answered with the 400 Bad Request status by Bind
+	ValidationErrorCode = "validation-error"
+)
+
+// Describe a single request value not satisfying the binding or validation rules
+type Violation struct {
+	// Request value location: path, query, header or body
+	In string `yaml:"in" json:"in" xml:"in"`
+	// Request value name
+	Field string `yaml:"field" json:"field" xml:"field"`
+	// Violation description
+	Message string `yaml:"message" json:"message" xml:"message"`
+}
+
+// Describe the error returned by Bind, listing the request values not satisfying the binding or validation rules.
+// It is the body of the 400 Bad Request responses, decoded by the Api Client as model.ApiError
+type ValidationError struct {
+	// Application error code
+	Code string `yaml:"code" json:"code" xml:"code"`
+	// Error description
+	Message string `yaml:"message" json:"message" xml:"message"`
+	// Request values violations
+	Violations []Violation `yaml:"violations" json:"violations" xml:"violations>violation"`
+}
+
+func (e *ValidationError) Error() string {
+	var messages = make([]string, 0)
+	for _, v := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%s %s: %s", v.In, v.Field, v.Message))
+	}
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(messages, ", "))
+}
+
+func (e *ValidationError) add(in, field, message string) {
+	e.Violations = append(e.Violations, Violation{In: in, Field: field, Message: message})
+}
+
+// Returns the path variable with the given name, defined in the handler path (eg.: /path/{name}), or empty
+func (ctx *ApiCallContext) PathVar(name string) string {
+	return mux.Vars(ctx.Request)[name]
+}
+
+// Returns all the path variables, defined in the handler path
+func (ctx *ApiCallContext) PathVars() map[string]string {
+	var vars = mux.Vars(ctx.Request)
+	if vars == nil {
+		return make(map[string]string)
+	}
+	return vars
+}
+
+// Returns the path variable with the given name as an integer
+func (ctx *ApiCallContext) PathVarInt(name string) (int64, error) {
+	return strconv.ParseInt(ctx.PathVar(name), 10, 64)
+}
+
+// Returns the first query parameter with the given name, or empty
+func (ctx *ApiCallContext) QueryParam(name string) string {
+	return ctx.Request.URL.Query().Get(name)
+}
+
+// Returns all the values of the query parameter with the given name
+func (ctx *ApiCallContext) QueryParams(name string) []string {
+	return ctx.Request.URL.Query()[name]
+}
+
+// Returns the query parameter with the given name as an integer, or the default value when it is missing
+func (ctx *ApiCallContext) QueryInt(name string, defaultValue int64) (int64, error) {
+	var value = ctx.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Returns the query parameter with the given name as a boolean, or the default value when it is missing
+func (ctx *ApiCallContext) QueryBool(name string, defaultValue bool) (bool, error) {
+	var value = ctx.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// Returns the first value of the request header with the given name, or empty
+func (ctx *ApiCallContext) Header(name string) string {
+	return ctx.Request.Header.Get(name)
+}
+
+// Fills the given struct pointer with the request values and validates it. The struct fields are filled
+// using the tags:
+//
+//	path:"name"      path variable
+//	query:"name"     query parameter (slice fields receive all the values)
+//	header:"Name"    request header
+//
+// When the request has a body, it is decoded first in the struct with the encoding related to the request
+// Content-Type. Field types can be strings, booleans, numbers, time.Duration, encoding.TextUnmarshaler
+// implementations, pointers (left nil when the value is missing) and slices of them.
+// The validate tag contains comma separated rules, applied to the top level fields:
+//
+//	required         value must be present (not zero)
+//	min=n, max=n     number limits, or string and slice length limits
+//	len=n            string and slice exact length
+//	oneof=a b c      value must be one of the space separated values
+//	pattern=regexp   string must match the regular expression (it must be the last rule)
+//
+// When values are invalid, the request is answered with the 400 Bad Request status and a *ValidationError body
+// (encoded with the negotiated response encoding, or JSON), and the *ValidationError is returned.
+func (ctx *ApiCallContext) Bind(target interface{}) error {
+	var value = reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("Bind target must be a struct pointer, found: %T", target))
+	}
+	var validation = &ValidationError{
+		Code:       ValidationErrorCode,
+		Message:    "Invalid request",
+		Violations: make([]Violation, 0),
+	}
+	if hasBody(ctx.Request) {
+		err := ctx.decodeBody(target)
+		if err == ErrUnsupportedMediaType || err == ErrRequestEntityTooLarge {
+			return err
+		}
+		if err != nil {
+			validation.add("body", "", err.Error())
+		}
+	}
+	var elem = value.Elem()
+	var query = ctx.Request.URL.Query()
+	var vars = mux.Vars(ctx.Request)
+	for i := 0; i < elem.NumField(); i++ {
+		var field = elem.Type().Field(i)
+		if field.PkgPath != "" {
+			// Unexported field
+			continue
+		}
+		var in, name = bindingSource(field)
+		var values []string
+		switch in {
+		case "path":
+			if v, ok := vars[name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[name]
+		case "header":
+			values = ctx.Request.Header.Values(name)
+		}
+		if len(values) > 0 {
+			if err := setField(elem.Field(i), values); err != nil {
+				validation.add(in, name, err.Error())
+				continue
+			}
+		}
+		if rules := field.Tag.Get("validate"); rules != "" {
+			for _, message := range validate(elem.Field(i), rules, len(values) > 0) {
+				validation.add(in, name, message)
+			}
+		}
+	}
+	if len(validation.Violations) > 0 {
+		ctx.writeValidationError(validation)
+		return validation
+	}
+	return nil
+}
+
+// Returns the request value location and name of the given field, by default the body with the json name
+func bindingSource(field reflect.StructField) (string, string) {
+	for _, in := range []string{"path", "query", "header"} {
+		if name := field.Tag.Get(in); name != "" {
+			return in, name
+		}
+	}
+	var name = strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		name = field.Name
+	}
+	return "body", name
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+// Decodes the request body in the given target with the encoding related to the request Content-Type. When no
+// encoding is registered for it, the request is answered with the 415 Unsupported Media Type status and
+// ErrUnsupportedMediaType is returned
+func (ctx *ApiCallContext) decodeBody(target interface{}) error {
+	var encodingValue = encoding2.ParseMimeType(ctx.ContentMimeType)
+	if encodingValue == encoding2.EncodingUNKNOWNFormat {
+		http.Error(ctx.ResponseWriter, fmt.Sprintf("Unsupported media type: %v", ctx.ContentMimeType), http.StatusUnsupportedMediaType)
+		return ErrUnsupportedMediaType
+	}
+	data, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return ctx.bodyError(err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return io2.Unmarshal(data, encodingValue, target)
+}
+
+// Request body reader failing with ErrMaxBodySizeExceeded once more than the limit bytes are read
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// One more byte than the remaining ones is read, to detect the bodies exceeding the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		b.err = err
+		return n, err
+	}
+	n = int(b.remaining)
+	b.remaining = 0
+	b.err = ErrMaxBodySizeExceeded
+	return n, b.err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// Returns a reader of the given request body failing with ErrMaxBodySizeExceeded when more than limit bytes are read
+func LimitBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitedBody{
+		body:      body,
+		remaining: limit,
+	}
+}
+
+type maxBodySizeKey struct{}
+
+// Returns a copy of the given context carrying the server maximum body size
+func WithMaxBodySize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, maxBodySizeKey{}, size)
+}
+
+// Returns the server maximum body size carried by the given context, or 0
+func MaxBodySizeFrom(ctx context.Context) int64 {
+	if ctx == nil {
+		return 0
+	}
+	size, _ := ctx.Value(maxBodySizeKey{}).(int64)
+	return size
+}
+
+// Answers the request with the 413 Request Entity Too Large status and returns ErrRequestEntityTooLarge, when
+// the given body read error is caused by the server maximum body size, otherwise returns the given error.
+// The connection is closed after the response, the rest of the body is not read.
+func (ctx *ApiCallContext) bodyError(err error) error {
+	if errors.Is(err, ErrMaxBodySizeExceeded) {
+		ctx.ResponseWriter.Header().Set("Connection", "close")
+		http.Error(ctx.ResponseWriter, fmt.Sprintf("Request body exceeds the maximum size of %v bytes", MaxBodySizeFrom(ctx.Request.Context())), http.StatusRequestEntityTooLarge)
+		return ErrRequestEntityTooLarge
+	}
+	return err
+}
+
+func (ctx *ApiCallContext) writeValidationError(validation *ValidationError) {
+	var enc = ctx.ResponseEncoding()
+	var mimeType = ctx.ResponseMimeType
+	if enc == encoding2.EncodingUNKNOWNFormat {
+		enc = encoding2.EncodingJSONFormat
+		mimeType = encoding2.JsonMimeType
+	}
+	data, err := io2.Marshal(enc, validation)
+	if err != nil {
+		http.Error(ctx.ResponseWriter, validation.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx.ResponseWriter.Header().Set("Content-Type", string(mimeType))
+	ctx.ResponseWriter.WriteHeader(http.StatusBadRequest)
+	_, _ = ctx.ResponseWriter.Write(data)
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// Sets the given field from the given request values
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshalerType) &&
+		!reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+		var slice = reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setValue(slice.Index(i), v); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+// Sets the given value parsing the given text
+func setValue(value reflect.Value, text string) error {
+	if value.Kind() == reflect.Ptr {
+		var ptr = reflect.New(value.Type().Elem())
+		if err := setValue(ptr.Elem(), text); err != nil {
+			return err
+		}
+		value.Set(ptr)
+		return nil
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid duration: %s", text))
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid boolean: %s", text))
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid integer: %s", text))
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid unsigned integer: %s", text))
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, value.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid number: %s", text))
+		}
+		value.SetFloat(n)
+	default:
+		return errors.New(fmt.Sprintf("unsupported field type: %v", value.Type()))
+	}
+	return nil
+}
+
+var (
+	patterns     = make(map[string]*regexp.Regexp)
+	patternsLock = sync.Mutex{}
+)
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	defer patternsLock.Unlock()
+	patternsLock.Lock()
+	if re, ok := patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns[pattern] = re
+	return re, nil
+}
+
+// Applies the given validation rules to the given value, and returns the violations messages. Zero values
+// not present in the request are considered missing, so only the required rule applies to them
+func validate(value reflect.Value, rules string, present bool) []string {
+	var messages = make([]string, 0)
+	var required = hasRule(rules, "required")
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if required {
+				messages = append(messages, "value is required")
+			}
+			// Missing optional values are not validated
+			return messages
+		}
+		value = value.Elem()
+	}
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "pattern=") {
+			rule, rules = rules, ""
+		} else if i := strings.Index(rules, ","); i >= 0 {
+			rule, rules = rules[:i], rules[i+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+		var name, arg = strings.TrimSpace(rule), ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, arg = name[:i], name[i+1:]
+		}
+		if name != "required" && value.IsZero() && !present {
+			// Missing values are not validated
+			continue
+		}
+		if message := applyRule(value, name, arg); message != "" {
+			messages = append(messages, message)
+			if name == "required" {
+				break
+			}
+		}
+	}
+	return messages
+}
+
+func hasRule(rules string, name string) bool {
+	for _, rule := range strings.Split(rules, ",") {
+		if strings.TrimSpace(rule) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the violation message of the given rule, or empty when the value satisfies it
+func applyRule(value reflect.Value, name string, arg string) string {
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return "value is required"
+		}
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid %s rule: %s", name, arg)
+		}
+		var size float64
+		var what = "value"
+		switch value.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			size, what = float64(value.Len()), "length"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			size = float64(value.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			size = float64(value.Uint())
+		case reflect.Float32, reflect.Float64:
+			size = value.Float()
+		default:
+			return fmt.Sprintf("%s rule not supported by type %v", name, value.Type())
+		}
+		if name == "min" && size < limit {
+			return fmt.Sprintf("%s must be at least %s", what, arg)
+		}
+		if name == "max" && size > limit {
+			return fmt.Sprintf("%s must be at most %s", what, arg)
+		}
+		if name == "len" && size != limit {
+			return fmt.Sprintf("%s must be %s", what, arg)
+		}
+	case "oneof":
+		var text = fmt.Sprint(value.Interface())
+		for _, allowed := range strings.Fields(arg) {
+			if text == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value must be one of: %s", arg)
+	case "pattern":
+		if value.Kind() != reflect.String {
+			return fmt.Sprintf("pattern rule not supported by type %v", value.Type())
+		}
+		re, err := compilePattern(arg)
+		if err != nil {
+			return fmt.Sprintf("invalid pattern rule: %s", arg)
+		}
+		if !re.MatchString(value.String()) {
+			return fmt.Sprintf("value must match: %s", arg)
+		}
+	default:
+		return fmt.Sprintf("unknown validation rule: %s", name)
+	}
+	return ""
+}
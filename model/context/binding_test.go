@@ -0,0 +1,97 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindSample struct {
+	Id      int64         `path:"id" validate:"min=1"`
+	Page    *int          `query:"page" validate:"min=1,max=100"`
+	Tags    []string      `query:"tag" validate:"max=2"`
+	Timeout time.Duration `query:"timeout"`
+	Tenant  string        `header:"X-Tenant" validate:"required,pattern=^[a-z]+$"`
+	Name    string        `json:"name" validate:"required,oneof=first second"`
+}
+
+// Serves the given request with a router, so the path variables are available, and returns the bind result
+func bindRequest(r *http.Request, target *bindSample) (*httptest.ResponseRecorder, error) {
+	var recorder = httptest.NewRecorder()
+	var err error
+	var router = mux.NewRouter()
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var ctx = NewApiCallContext(w, r)
+		err = ctx.Bind(target)
+	})
+	router.ServeHTTP(recorder, r)
+	return recorder, err
+}
+
+func TestBind(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodPut, "/items/12?page=3&tag=a&tag=b&timeout=5s", strings.NewReader(`{"name":"first"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	var sample bindSample
+	_, err := bindRequest(r, &sample)
+	testsuite.AssertNil(t, "Bind error must be nil", err)
+	testsuite.AssertEquals(t, "Path variable must be bound", int64(12), sample.Id)
+	testsuite.AssertEquals(t, "Query parameter must be bound", 3, *sample.Page)
+	testsuite.AssertEquals(t, "Repeated query parameter must be bound", "a,b", strings.Join(sample.Tags, ","))
+	testsuite.AssertEquals(t, "Duration must be parsed", 5*time.Second, sample.Timeout)
+	testsuite.AssertEquals(t, "Header must be bound", "acme", sample.Tenant)
+	testsuite.AssertEquals(t, "Body must be decoded", "first", sample.Name)
+}
+
+func TestBindViolations(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/items/0?page=x&tag=a&tag=b&tag=c", nil)
+	r.Header.Set("X-Tenant", "Acme")
+	var sample bindSample
+	recorder, err := bindRequest(r, &sample)
+	testsuite.AssertNotNil(t, "Bind error must not be nil", err)
+	testsuite.AssertEquals(t, "Request must be answered as bad request", http.StatusBadRequest, recorder.Code)
+	var validation ValidationError
+	testsuite.AssertNil(t, "Response must be a validation error", json.Unmarshal(recorder.Body.Bytes(), &validation))
+	testsuite.AssertEquals(t, "Validation error code must be set", ValidationErrorCode, validation.Code)
+	var fields = make([]string, 0)
+	for _, v := range validation.Violations {
+		fields = append(fields, v.In+":"+v.Field)
+	}
+	testsuite.AssertEquals(t, "All violations must be listed", "path:id,query:page,query:tag,header:X-Tenant,body:name", strings.Join(fields, ","))
+}
+
+func TestLimitBody(t *testing.T) {
+	for body, size := range map[string]int64{
+		`{"name":"first"}`:            16,
+		`{"name":"first","more":"x"}`: 16,
+	} {
+		var r = httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Body = LimitBody(r.Body, size)
+		r = r.WithContext(WithMaxBodySize(r.Context(), size))
+		var recorder = httptest.NewRecorder()
+		var ctx = NewApiCallContext(recorder, r)
+		var target map[string]string
+		err := ctx.ParseBody(&target)
+		if int64(len(body)) <= size {
+			testsuite.AssertNil(t, "Body within the limit must be decoded", err)
+			testsuite.AssertEquals(t, "Body within the limit must be decoded", "first", target["name"])
+			continue
+		}
+		testsuite.AssertEquals(t, "Body over the limit must be rejected", ErrRequestEntityTooLarge, err)
+		testsuite.AssertEquals(t, "Body over the limit must be answered with 413", http.StatusRequestEntityTooLarge, recorder.Code)
+		testsuite.AssertEquals(t, "Connection must be closed after the response", "close", recorder.Header().Get("Connection"))
+		testsuite.AssertEquals(t, "Response must report the limit", "Request body exceeds the maximum size of 16 bytes\n", recorder.Body.String())
+	}
+	var body = LimitBody(ioutil.NopCloser(strings.NewReader("0123456789")), 4)
+	data, err := ioutil.ReadAll(body)
+	testsuite.AssertEquals(t, "Limited reader must fail with the sentinel error", true, errors.Is(err, ErrMaxBodySizeExceeded))
+	testsuite.AssertEquals(t, "Limited reader must return the bytes within the limit", "0123", string(data))
+}
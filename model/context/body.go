@@ -0,0 +1,214 @@
+package context
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model/encoding"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Newline delimited JSON stream mime type, each line is a JSON document
+	NDJsonMimeType encoding.MimeType = "application/x-ndjson"
+	// Multipart form mime type
+	MultipartFormMimeType encoding.MimeType = "multipart/form-data"
+)
+
+var (
+	// Maximum size in bytes of the multipart form values, kept in memory
+	MaxMultipartValuesSize int64 = 1 << 20
+)
+
+// Decodes the request body item by item, calling the handler for each of them, without reading the whole body
+// in memory. Newline delimited JSON bodies (application/x-ndjson) contain an item per line, and JSON bodies
+// (application/json) contain an array of items. Other mime types are answered with the 415 Unsupported Media Type
+// status and ErrUnsupportedMediaType is returned. Decoding stops at the first error returned by the handler.
+func ParseStream[T any](ctx *ApiCallContext, handler func(item T) error) error {
+	if !ctx.CanParseBody() {
+		return ErrEmptyBody
+	}
+	var err error
+	switch ctx.ContentMimeType {
+	case NDJsonMimeType:
+		err = decodeLines(ctx.Request.Body, handler)
+	case encoding.JsonMimeType:
+		err = decodeArray(ctx.Request.Body, handler)
+	default:
+		http.Error(ctx.ResponseWriter, fmt.Sprintf("Unsupported media type: %v", ctx.ContentMimeType), http.StatusUnsupportedMediaType)
+		return ErrUnsupportedMediaType
+	}
+	return ctx.bodyError(err)
+}
+
+// Decodes a JSON document per line, blank lines are skipped
+func decodeLines[T any](reader io.Reader, handler func(item T) error) error {
+	var scanner = bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var line = 0
+	for scanner.Scan() {
+		line++
+		var data = bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return errors.New(fmt.Sprintf("Error decoding line %v: %v", line, err))
+		}
+		if err := handler(item); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Decodes the items of a JSON array
+func decodeArray[T any](reader io.Reader, handler func(item T) error) error {
+	var decoder = json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New(fmt.Sprint("JSON stream must be an array"))
+	}
+	for index := 0; decoder.More(); index++ {
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			return errors.New(fmt.Sprintf("Error decoding item %v: %v", index, err))
+		}
+		if err := handler(item); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// Describe a file uploaded with a multipart form, and stored on disk
+type UploadedFile struct {
+	// Form field name
+	Field string
+	// File name sent by the client, without directories
+	FileName string
+	// File content type sent by the client
+	ContentType string
+	// Stored file path
+	Path string
+	// File size in bytes
+	Size int64
+}
+
+// Describe a parsed multipart form
+type MultipartForm struct {
+	// Form values
+	Values map[string][]string
+	// Uploaded files
+	Files []UploadedFile
+}
+
+// Returns the first value of the form field with the given name, or empty
+func (f *MultipartForm) Value(name string) string {
+	if values := f.Values[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Removes the stored files, returning the first error occurred
+func (f *MultipartForm) RemoveFiles() error {
+	var err error
+	for _, file := range f.Files {
+		if removeErr := os.Remove(file.Path); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// Parses the multipart/form-data request body, streaming the uploaded files to new files in the given directory
+// (empty means the system temporary directory), without reading them in memory. The form values are limited
+// to MaxMultipartValuesSize bytes, while the whole body is limited by the server maximum body size. Stored files
+// must be moved or removed by the caller, on error they are removed.
+func (ctx *ApiCallContext) ParseMultipart(dir string) (*MultipartForm, error) {
+	if ctx.ContentMimeType != MultipartFormMimeType {
+		http.Error(ctx.ResponseWriter, fmt.Sprintf("Unsupported media type: %v", ctx.ContentMimeType), http.StatusUnsupportedMediaType)
+		return nil, ErrUnsupportedMediaType
+	}
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var form = &MultipartForm{
+		Values: make(map[string][]string),
+		Files:  make([]UploadedFile, 0),
+	}
+	var valuesSize int64 = 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			_ = form.RemoveFiles()
+			return nil, ctx.bodyError(err)
+		}
+		var name = part.FormName()
+		if name == "" {
+			_ = part.Close()
+			continue
+		}
+		if part.FileName() == "" {
+			var buff = bytes.NewBuffer(make([]byte, 0))
+			n, err := io.Copy(buff, io.LimitReader(part, MaxMultipartValuesSize-valuesSize+1))
+			_ = part.Close()
+			if err != nil {
+				_ = form.RemoveFiles()
+				return nil, ctx.bodyError(err)
+			}
+			valuesSize += n
+			if valuesSize > MaxMultipartValuesSize {
+				_ = form.RemoveFiles()
+				http.Error(ctx.ResponseWriter, fmt.Sprintf("Form values exceed the maximum size of %v bytes", MaxMultipartValuesSize), http.StatusRequestEntityTooLarge)
+				return nil, ErrRequestEntityTooLarge
+			}
+			form.Values[name] = append(form.Values[name], buff.String())
+			continue
+		}
+		file, err := storePart(part, dir)
+		_ = part.Close()
+		if file.Path != "" {
+			form.Files = append(form.Files, file)
+		}
+		if err != nil {
+			_ = form.RemoveFiles()
+			return nil, ctx.bodyError(err)
+		}
+	}
+}
+
+// Copies the given file part to a new file in the given directory
+func storePart(part *multipart.Part, dir string) (UploadedFile, error) {
+	var file = UploadedFile{
+		Field:       part.FormName(),
+		FileName:    filepath.Base(part.FileName()),
+		ContentType: part.Header.Get("Content-Type"),
+	}
+	out, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return file, err
+	}
+	file.Path = out.Name()
+	file.Size, err = io.Copy(out, part)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return file, err
+}
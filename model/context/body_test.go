@@ -0,0 +1,55 @@
+package context
+
+import (
+	"bytes"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type streamItem struct {
+	Value int `json:"value"`
+}
+
+func TestParseStream(t *testing.T) {
+	for mimeType, body := range map[string]string{
+		"application/x-ndjson": "{\"value\":1}\n\n{\"value\":2}\n{\"value\":3}\n",
+		"application/json":     "[{\"value\":1},{\"value\":2},{\"value\":3}]",
+	} {
+		var r = httptest.NewRequest(http.MethodPatch, "/items", strings.NewReader(body))
+		r.Header.Set("Content-Type", mimeType)
+		var ctx = NewApiCallContext(httptest.NewRecorder(), r)
+		var sum = 0
+		err := ParseStream(&ctx, func(item streamItem) error {
+			sum += item.Value
+			return nil
+		})
+		testsuite.AssertNil(t, "Stream error must be nil for "+mimeType, err)
+		testsuite.AssertEquals(t, "All items must be decoded for "+mimeType, 6, sum)
+	}
+}
+
+func TestParseMultipart(t *testing.T) {
+	var body = bytes.NewBuffer(make([]byte, 0))
+	var writer = multipart.NewWriter(body)
+	_ = writer.WriteField("description", "sample upload")
+	part, _ := writer.CreateFormFile("file", "../sample.txt")
+	_, _ = part.Write([]byte("sample content"))
+	_ = writer.Close()
+	var r = httptest.NewRequest(http.MethodPut, "/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	var ctx = NewApiCallContext(httptest.NewRecorder(), r)
+	form, err := ctx.ParseMultipart(t.TempDir())
+	testsuite.AssertNil(t, "Multipart error must be nil", err)
+	testsuite.AssertEquals(t, "Form value must be read", "sample upload", form.Value("description"))
+	testsuite.AssertEquals(t, "One file must be stored", 1, len(form.Files))
+	testsuite.AssertEquals(t, "File name must not contain directories", "sample.txt", form.Files[0].FileName)
+	data, err := ioutil.ReadFile(form.Files[0].Path)
+	testsuite.AssertNil(t, "Stored file read error must be nil", err)
+	testsuite.AssertEquals(t, "Stored file must contain the uploaded content", "sample content", string(data))
+	testsuite.AssertNil(t, "Files removal error must be nil", form.RemoveFiles())
+}
@@ -0,0 +1,214 @@
+package context
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	io2 "github.com/hellgate75/go-network/io"
+	"github.com/hellgate75/go-network/model/encoding"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Server-Sent Events stream mime type
+	EventStreamMimeType encoding.MimeType = "text/event-stream"
+	// Header carrying the identifier of the last event received by a reconnecting client
+	LastEventIdHeader = "Last-Event-ID"
+)
+
+// Describe a single Server-Sent Event
+type ServerSentEvent struct {
+	// Event identifier, sent back by the client reconnecting in the Last-Event-ID header (empty means not set)
+	Id string
+	// Event type (empty means the default message type)
+	Event string
+	// Event data, it must be UTF-8 text
+	Data []byte
+	// Client reconnection delay (0 means not set)
+	Retry time.Duration
+}
+
+// Decodes the event data with the given encoding
+func (e ServerSentEvent) Decode(enc encoding.Encoding, target interface{}) error {
+	return io2.Unmarshal(e.Data, enc, target)
+}
+
+// Server-Sent Events stream writing the events on a response, safe for concurrent writers
+type EventStream struct {
+	sync.Mutex
+	// Identifier of the last event received by the client, when it is reconnecting, otherwise empty
+	LastEventId string
+	writer      http.ResponseWriter
+	flusher     http.Flusher
+	ctx         context.Context
+	cancel      context.CancelFunc
+	enc         encoding.Encoding
+}
+
+// Switches the response to a Server-Sent Events stream, with the 200 status code, encoding the events data with the
+// given encoding (encoding.EncodingJSONFormat when unknown). The stream ends when the client disconnects, the server
+// starts shutting down or the action returns
+func (ctx *ApiCallContext) EventStream(enc encoding.Encoding) (*EventStream, error) {
+	flusher, ok := ctx.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, errors.New(fmt.Sprint("Response writer does not support flushing"))
+	}
+	if enc == encoding.EncodingUNKNOWNFormat {
+		enc = encoding.EncodingJSONFormat
+	}
+	var header = ctx.ResponseWriter.Header()
+	header.Set("Content-Type", string(EventStreamMimeType))
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// Disables the proxies response buffering
+	header.Set("X-Accel-Buffering", "no")
+	ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// Streams never complete by themselves, so they end when the server starts shutting down
+	var streamCtx, cancel = context.WithCancel(ctx.Request.Context())
+	if shutdown := ServerShutdownFrom(streamCtx); shutdown != nil {
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-streamCtx.Done():
+			}
+		}()
+	}
+	return &EventStream{
+		LastEventId: ctx.Request.Header.Get(LastEventIdHeader),
+		writer:      ctx.ResponseWriter,
+		flusher:     flusher,
+		ctx:         streamCtx,
+		cancel:      cancel,
+		enc:         enc,
+	}, nil
+}
+
+type serverShutdownKey struct{}
+
+// Returns a copy of the given context carrying the channel closed when the server starts shutting down
+func WithServerShutdown(ctx context.Context, shutdown <-chan struct{}) context.Context {
+	return context.WithValue(ctx, serverShutdownKey{}, shutdown)
+}
+
+// Returns the channel closed when the server starts shutting down carried by the given context, or nil
+func ServerShutdownFrom(ctx context.Context) <-chan struct{} {
+	if ctx == nil {
+		return nil
+	}
+	ch, _ := ctx.Value(serverShutdownKey{}).(<-chan struct{})
+	return ch
+}
+
+// Returns the stream context, cancelled when the client disconnects, the server starts shutting down
+// or the stream is closed
+func (s *EventStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *EventStream) write(data []byte) error {
+	defer s.Unlock()
+	s.Lock()
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Encodes the given data with the stream encoding and sends it as an event with the given type and identifier
+// (empty means not set)
+func (s *EventStream) Send(event string, id string, data interface{}) error {
+	encoded, err := io2.Marshal(s.enc, data)
+	if err != nil {
+		return err
+	}
+	return s.SendEvent(ServerSentEvent{
+		Id:    id,
+		Event: event,
+		Data:  encoded,
+	})
+}
+
+// Sends the given event, its data is split in a data field per line
+func (s *EventStream) SendEvent(event ServerSentEvent) error {
+	if !utf8.Valid(event.Data) {
+		return errors.New(fmt.Sprint("Server-Sent Event data must be UTF-8 text"))
+	}
+	if strings.ContainsAny(event.Id+event.Event, "\r\n") {
+		return errors.New(fmt.Sprint("Server-Sent Event identifier and type must be single line"))
+	}
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	if event.Id != "" {
+		buff.WriteString(fmt.Sprintf("id: %s\n", event.Id))
+	}
+	if event.Event != "" {
+		buff.WriteString(fmt.Sprintf("event: %s\n", event.Event))
+	}
+	if event.Retry > 0 {
+		buff.WriteString(fmt.Sprintf("retry: %v\n", event.Retry.Milliseconds()))
+	}
+	var data = strings.ReplaceAll(strings.ReplaceAll(string(event.Data), "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		buff.WriteString(fmt.Sprintf("data: %s\n", line))
+	}
+	buff.WriteString("\n")
+	return s.write(buff.Bytes())
+}
+
+// Ends the stream, the following writes fail. The response is completed when the action returns
+func (s *EventStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+// Sends a comment, ignored by the clients, used for keeping the connection alive
+func (s *EventStream) Comment(text string) error {
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	for _, line := range strings.Split(text, "\n") {
+		buff.WriteString(fmt.Sprintf(": %s\n", strings.TrimSuffix(line, "\r")))
+	}
+	buff.WriteString("\n")
+	return s.write(buff.Bytes())
+}
+
+// Sends an empty comment at the given interval, until the client disconnects or the returned stop function is called.
+// The heartbeat must be stopped before the action returns
+func (s *EventStream) Heartbeat(interval time.Duration) (stop func()) {
+	var done = make(chan struct{})
+	var stopped = make(chan struct{})
+	var once = sync.Once{}
+	go func() {
+		defer close(stopped)
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("") != nil {
+					return
+				}
+			case <-done:
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
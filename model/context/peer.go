@@ -0,0 +1,81 @@
+package context
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+)
+
+const (
+	// Connection map key of the verified client certificate of the Tcp Server TLS connections
+	PeerCertificateKey = "peer-certificate"
+	// Authentication method of the client certificate principals
+	CertificateMethod = "mtls"
+)
+
+// Describe the verified certificate presented by a TLS client
+type PeerCertificate struct {
+	// Verified certificate chain, from the client certificate to the trusted root CA
+	Chain []*x509.Certificate
+	// Client certificate subject
+	Subject pkix.Name
+	// Client certificate DNS names
+	DNSNames []string
+	// Client certificate email addresses
+	EmailAddresses []string
+	// Client certificate IP addresses
+	IPAddresses []net.IP
+	// Client certificate URIs (eg.: SPIFFE identifiers)
+	URIs []*url.URL
+}
+
+// Returns the client certificate
+func (p *PeerCertificate) Certificate() *x509.Certificate {
+	return p.Chain[0]
+}
+
+// Returns the principal identified by the client certificate, with the given roles. The principal name
+// is the subject common name, or the whole subject when it has no common name
+func (p *PeerCertificate) Principal(roles ...string) *Principal {
+	var name = p.Subject.CommonName
+	if name == "" {
+		name = p.Subject.String()
+	}
+	var uris = make([]string, 0)
+	for _, uri := range p.URIs {
+		uris = append(uris, uri.String())
+	}
+	return &Principal{
+		Name:   name,
+		Roles:  append(make([]string, 0), roles...),
+		Method: CertificateMethod,
+		Claims: map[string]interface{}{
+			"subject": p.Subject.String(),
+			"issuer":  p.Certificate().Issuer.String(),
+			"serial":  p.Certificate().SerialNumber.String(),
+			"dns":     p.DNSNames,
+			"email":   p.EmailAddresses,
+			"uri":     uris,
+		},
+	}
+}
+
+// Returns the verified client certificate of the given TLS connection state, or nil when the connection
+// is not encrypted or the client has not presented a verified certificate
+func NewPeerCertificate(state *tls.ConnectionState) *PeerCertificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	var chain = state.VerifiedChains[0]
+	var cert = chain[0]
+	return &PeerCertificate{
+		Chain:          chain,
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+	}
+}
@@ -0,0 +1,47 @@
+package context
+
+const (
+	// Connection map key of the principal authenticated by the Tcp Server connection interceptors
+	PrincipalKey = "principal"
+)
+
+// Describe the authenticated identity of a request
+type Principal struct {
+	// Principal name (eg.: user name, client identifier, token subject)
+	Name string
+	// Granted roles
+	Roles []string
+	// Authentication method (eg.: api-key, bearer, basic)
+	Method string
+	// Additional authentication attributes (eg.: token claims)
+	Claims map[string]interface{}
+}
+
+// Reports if the principal has been granted the given role
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports if the principal has been granted at least one of the given roles, or no role is given
+func (p *Principal) HasAnyRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if p.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package context
 
 import (
+	"context"
 	io2 "github.com/hellgate75/go-network/io"
 	"github.com/hellgate75/go-network/log"
 	"github.com/hellgate75/go-network/model/encoding"
@@ -25,12 +26,20 @@ type TcpContext struct {
 	RequestEncoding encoding.Encoding
 	// Request level cache map element
 	RequestMap map[string]interface{}
+	// Connection level cache map element, filled by the server connection interceptors
+	ConnectionMap map[string]interface{}
 	// Reference to Handler level cache map element
 	HandlerMap *map[string]interface{}
 	// Reference to Api Server level cache map element
 	ServerMap *map[string]interface{}
+	// Authenticated connection identity, stored by the connection interceptors, nil for anonymous connections
+	Principal *Principal
+	// Verified client certificate of the TLS connection, nil when the client has not presented any
+	PeerCertificate *PeerCertificate
 	// Reference to Api Server level cache map element
 	Logger log.Logger
+	// Connection context
+	ctx context.Context
 }
 
 func NewTcpContext(conn net.Conn, reader io.Reader, serverEncoding encoding.Encoding) TcpContext {
@@ -48,6 +57,41 @@ func NewTcpContext(conn net.Conn, reader io.Reader, serverEncoding encoding.Enco
 	}
 }
 
+// Returns the connection context, cancelled when the client disconnects.
+// It never returns nil, in case no context has been provided context.Background() is returned
+func (ctx *TcpContext) Context() context.Context {
+	if ctx.ctx == nil {
+		return context.Background()
+	}
+	return ctx.ctx
+}
+
+// Returns a copy of the Tcp context with the connection context changed to the given one,
+// and the connection map changed to the one carried by the given context
+func (ctx TcpContext) WithContext(c context.Context) TcpContext {
+	ctx.ctx = c
+	ctx.ConnectionMap = ConnectionMapFrom(c)
+	ctx.Principal, _ = ctx.ConnectionMap[PrincipalKey].(*Principal)
+	ctx.PeerCertificate, _ = ctx.ConnectionMap[PeerCertificateKey].(*PeerCertificate)
+	return ctx
+}
+
+type connectionMapKey struct{}
+
+// Returns a copy of the given context carrying the given connection level cache map element
+func WithConnectionMap(ctx context.Context, connectionMap map[string]interface{}) context.Context {
+	return context.WithValue(ctx, connectionMapKey{}, connectionMap)
+}
+
+// Returns the connection level cache map element carried by the given context, or nil
+func ConnectionMapFrom(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(connectionMapKey{}).(map[string]interface{})
+	return m
+}
+
 func (ctx *TcpContext) ParseRequest(requestBody interface{}) error {
 	data, err := ioutil.ReadAll(ctx.RequestReader)
 	if err != nil {
@@ -0,0 +1,373 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	io2 "github.com/hellgate75/go-network/io"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model/encoding"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// Error returned reading or writing messages on a WebSocket connection closed by the peer or by the server
+	ErrWebSocketClosed = errors.New("WebSocket connection is closed")
+)
+
+// Describe the WebSocket connection properties
+type WebSocketOptions struct {
+	// Maximum time for writing a message (0 means no timeout)
+	WriteTimeout time.Duration
+	// Interval between two pings sent to the peer (0 means no pings)
+	PingInterval time.Duration
+	// Maximum time waiting for any message or pong after a ping, before closing the connection (0 means twice the ping interval)
+	PongTimeout time.Duration
+	// Number of received messages buffered before blocking the connection reads (0 means 16)
+	ReadBuffer int
+}
+
+// Single message received from a WebSocket connection
+type WebSocketMessage struct {
+	// Message type: websocket.TextMessage or websocket.BinaryMessage
+	Type int
+	// Message content
+	Data []byte
+}
+
+// WebSocket connection shared by the context copies and the hub: the received messages are read by
+// a dedicated routine, so the pongs are handled while the action is not reading, and the writes are
+// serialized because the connection supports a single concurrent writer
+type webSocketSession struct {
+	sync.Mutex
+	writeLock sync.Mutex
+	conn      *websocket.Conn
+	options   WebSocketOptions
+	messages  chan WebSocketMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	err       error
+}
+
+// Reads the messages until the connection fails or is closed, then cancels the connection context
+func (s *webSocketSession) readMessages() {
+	defer close(s.messages)
+	defer s.cancel()
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.Lock()
+			s.err = err
+			s.Unlock()
+			return
+		}
+		s.extendReadDeadline()
+		select {
+		case s.messages <- WebSocketMessage{Type: messageType, Data: data}:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *webSocketSession) extendReadDeadline() {
+	if s.options.PingInterval > 0 {
+		_ = s.conn.SetReadDeadline(time.Now().Add(s.options.PongTimeout))
+	}
+}
+
+// Sends the pings until the connection context is done
+func (s *webSocketSession) ping() {
+	var ticker = time.NewTicker(s.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var deadline = time.Now().Add(s.options.PongTimeout)
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				s.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *webSocketSession) write(messageType int, data []byte) error {
+	defer s.writeLock.Unlock()
+	s.writeLock.Lock()
+	if s.ctx.Err() != nil {
+		return ErrWebSocketClosed
+	}
+	if s.options.WriteTimeout > 0 {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(s.options.WriteTimeout))
+	}
+	err := s.conn.WriteMessage(messageType, data)
+	if err != nil {
+		s.cancel()
+	}
+	return err
+}
+
+// Sends the close message, when the code is not websocket.CloseAbnormalClosure, and closes the connection
+func (s *webSocketSession) close(code int, reason string) {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		if code != websocket.CloseAbnormalClosure {
+			var deadline = time.Now().Add(time.Second)
+			if s.options.WriteTimeout > 0 {
+				deadline = time.Now().Add(s.options.WriteTimeout)
+			}
+			_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+		}
+		_ = s.conn.Close()
+	})
+}
+
+// Describe WebSocket connection context, used as WebSocket action single source of truth information
+// for the whole connection life
+type WebSocketContext struct {
+	// Unique connection identifier
+	Id string
+	// Request path
+	Path string
+	// Upgraded connection request component
+	Request *http.Request
+	// Remote host address
+	RemoteAddress net.Addr
+	// Messages encoding
+	Encoding encoding.Encoding
+	// Connection level cache map element
+	ConnectionMap map[string]interface{}
+	// Reference to Handler level cache map element
+	HandlerMap *map[string]interface{}
+	// Reference to Api Server level cache map element
+	ServerMap *map[string]interface{}
+	// Hub of the handler connections, used for broadcasting messages
+	Hub *WebSocketHub
+	// Principal authenticated on the upgrade request, or nil when the request is not authenticated
+	Principal *Principal
+	// Reference to Api Server level cache map element
+	Logger  log.Logger
+	session *webSocketSession
+}
+
+// Creates the context of an upgraded connection, and starts reading the messages and sending the pings
+// accordingly to the given options. The connection must be closed calling the context Close method.
+func NewWebSocketContext(conn *websocket.Conn, r *http.Request, enc encoding.Encoding, options WebSocketOptions) WebSocketContext {
+	if options.PingInterval > 0 && options.PongTimeout <= 0 {
+		options.PongTimeout = 2 * options.PingInterval
+	}
+	if options.ReadBuffer <= 0 {
+		options.ReadBuffer = 16
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	var session = &webSocketSession{
+		conn:     conn,
+		options:  options,
+		messages: make(chan WebSocketMessage, options.ReadBuffer),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	session.extendReadDeadline()
+	conn.SetPongHandler(func(string) error {
+		session.extendReadDeadline()
+		return nil
+	})
+	go session.readMessages()
+	if options.PingInterval > 0 {
+		go session.ping()
+	}
+	return WebSocketContext{
+		Id:            GenerateUUUID(),
+		Path:          r.URL.Path,
+		Request:       r,
+		RemoteAddress: conn.RemoteAddr(),
+		Encoding:      enc,
+		ConnectionMap: make(map[string]interface{}),
+		HandlerMap:    nil,
+		ServerMap:     nil,
+		session:       session,
+	}
+}
+
+// Returns the connection context, cancelled when the connection is closed.
+// It never returns nil, in case no connection is available context.Background() is returned
+func (ctx *WebSocketContext) Context() context.Context {
+	if ctx.session == nil {
+		return context.Background()
+	}
+	return ctx.session.ctx
+}
+
+// Reads the next message, waiting until it is received or the connection is closed
+func (ctx *WebSocketContext) ReadRawMessage() (WebSocketMessage, error) {
+	if ctx.session == nil {
+		return WebSocketMessage{}, ErrWebSocketClosed
+	}
+	message, ok := <-ctx.session.messages
+	if !ok {
+		return WebSocketMessage{}, ErrWebSocketClosed
+	}
+	return message, nil
+}
+
+// Reads the next message and decodes it with the context encoding
+func (ctx *WebSocketContext) ReadMessage(message interface{}) error {
+	raw, err := ctx.ReadRawMessage()
+	if err != nil {
+		return err
+	}
+	return io2.Unmarshal(raw.Data, ctx.Encoding, message)
+}
+
+// Writes the given data as a message of the given type: websocket.TextMessage or websocket.BinaryMessage
+func (ctx *WebSocketContext) WriteRawMessage(messageType int, data []byte) error {
+	if ctx.session == nil {
+		return ErrWebSocketClosed
+	}
+	return ctx.session.write(messageType, data)
+}
+
+// Encodes the given message with the context encoding and writes it, as a text message when the encoded
+// data is valid UTF-8 text, otherwise as a binary message
+func (ctx *WebSocketContext) WriteMessage(message interface{}) error {
+	data, err := io2.Marshal(ctx.Encoding, message)
+	if err != nil {
+		return err
+	}
+	return ctx.WriteRawMessage(messageTypeOf(data), data)
+}
+
+// Closes the connection sending the close message with the given status code (eg.: websocket.CloseNormalClosure)
+// and reason. Closing a connection again has no effect
+func (ctx *WebSocketContext) Close(code int, reason string) error {
+	if ctx.session == nil {
+		return ErrWebSocketClosed
+	}
+	ctx.session.close(code, reason)
+	return nil
+}
+
+// Returns the error that closed the connection reads, or nil when it is still open
+func (ctx *WebSocketContext) Err() error {
+	if ctx.session == nil {
+		return ErrWebSocketClosed
+	}
+	defer ctx.session.Unlock()
+	ctx.session.Lock()
+	return ctx.session.err
+}
+
+func messageTypeOf(data []byte) int {
+	if utf8.Valid(data) {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// Group of WebSocket connections, used for pushing messages to all of them. It can be shared by multiple handlers
+type WebSocketHub struct {
+	sync.RWMutex
+	connections map[string]*WebSocketContext
+}
+
+// Adds the given connection to the hub
+func (hub *WebSocketHub) Join(ctx *WebSocketContext) {
+	defer hub.Unlock()
+	hub.Lock()
+	hub.connections[ctx.Id] = ctx
+}
+
+// Removes the given connection from the hub
+func (hub *WebSocketHub) Leave(ctx *WebSocketContext) {
+	defer hub.Unlock()
+	hub.Lock()
+	delete(hub.connections, ctx.Id)
+}
+
+// Returns the number of connections in the hub
+func (hub *WebSocketHub) Count() int {
+	defer hub.RUnlock()
+	hub.RLock()
+	return len(hub.connections)
+}
+
+func (hub *WebSocketHub) snapshot() []*WebSocketContext {
+	defer hub.RUnlock()
+	hub.RLock()
+	var connections = make([]*WebSocketContext, 0, len(hub.connections))
+	for _, ctx := range hub.connections {
+		connections = append(connections, ctx)
+	}
+	return connections
+}
+
+// Sends the given message to the hub connection with the given identifier
+func (hub *WebSocketHub) Send(id string, message interface{}) error {
+	hub.RLock()
+	ctx, ok := hub.connections[id]
+	hub.RUnlock()
+	if !ok {
+		return errors.New(fmt.Sprintf("WebSocket connection %s is not in the hub", id))
+	}
+	return ctx.WriteMessage(message)
+}
+
+// Sends the given message to all the hub connections, concurrently. The message is encoded once for each
+// connections encoding, encoding errors are returned. Connections failing the write are closed, and the number
+// of connections receiving the message is returned
+func (hub *WebSocketHub) Broadcast(message interface{}) (int, error) {
+	var connections = hub.snapshot()
+	var encoded = make(map[encoding.Encoding][]byte)
+	for _, ctx := range connections {
+		if _, ok := encoded[ctx.Encoding]; ok {
+			continue
+		}
+		data, err := io2.Marshal(ctx.Encoding, message)
+		if err != nil {
+			return 0, err
+		}
+		encoded[ctx.Encoding] = data
+	}
+	var sent = 0
+	var lock = sync.Mutex{}
+	var wg = sync.WaitGroup{}
+	for _, ctx := range connections {
+		wg.Add(1)
+		go func(ctx *WebSocketContext) {
+			defer wg.Done()
+			var data = encoded[ctx.Encoding]
+			if err := ctx.WriteRawMessage(messageTypeOf(data), data); err != nil {
+				_ = ctx.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+			lock.Lock()
+			sent++
+			lock.Unlock()
+		}(ctx)
+	}
+	wg.Wait()
+	return sent, nil
+}
+
+// Closes all the hub connections with the given status code (eg.: websocket.CloseGoingAway) and reason
+func (hub *WebSocketHub) CloseAll(code int, reason string) {
+	for _, ctx := range hub.snapshot() {
+		_ = ctx.Close(code, reason)
+	}
+}
+
+// Creates a new empty WebSocket connections hub
+func NewWebSocketHub() *WebSocketHub {
+	return &WebSocketHub{
+		connections: make(map[string]*WebSocketContext),
+	}
+}
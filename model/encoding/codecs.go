@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	RegisterEncoding(EncodingJSONFormat, NewCodec(json.Marshal, json.Unmarshal), JsonMimeType)
+	RegisterEncoding(EncodingYAMLFormat, NewCodec(yaml.Marshal, yaml.Unmarshal), YamlMimeType, "application/yaml", "application/x-yaml", "text/x-yaml")
+	RegisterEncoding(EncodingXMLFormat, NewCodec(xml.Marshal, xml.Unmarshal), XmlMimeType, "text/xml")
+	RegisterEncoding(EncodingProtobufFormat, NewCodec(protobufMarshal, protobufUnmarshal), ProtobufMimeType, "application/protobuf", "application/vnd.google.protobuf")
+}
+
+func protobufMessage(target interface{}) (proto.Message, error) {
+	msg, ok := target.(proto.Message)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Protobuf encoding requires a proto.Message, found: %T", target))
+	}
+	return msg, nil
+}
+
+func protobufMarshal(target interface{}) ([]byte, error) {
+	msg, err := protobufMessage(target)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+func protobufUnmarshal(data []byte, target interface{}) error {
+	msg, err := protobufMessage(target)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -1,5 +1,10 @@
 package encoding
 
+import (
+	"strings"
+	"sync"
+)
+
 // Mime Type
 type MimeType string
 
@@ -13,6 +18,7 @@ const (
 	YamlMimeType MimeType = "text/yaml"
 	ZipArchiveMimeType MimeType = "application/zip"
 	BinaryStreamMimeType MimeType = "application/octet-stream"
+	ProtobufMimeType MimeType = "application/x-protobuf"
 
 	// Unknown encoding format
 	EncodingUNKNOWNFormat = Encoding("")
@@ -22,34 +28,167 @@ const (
 	EncodingYAMLFormat = Encoding("yaml")
 	// Xml format encoding
 	EncodingXMLFormat = Encoding("xml")
+	// Protocol Buffers format encoding, it requires proto.Message values (pointers to generated structures)
+	EncodingProtobufFormat = Encoding("protobuf")
 )
 
 func (enc Encoding) String() string {
 	return string(enc)
 }
 
+// Describe the marshalling and unmarshalling implementation of an encoding format
+type Codec interface {
+	// Marshal given interface (pointer to structure) in bytes
+	Marshal(target interface{}) ([]byte, error)
+	// Unmarshal bytes and fill the given interface (pointer to structure)
+	Unmarshal(data []byte, target interface{}) error
+}
+
+type codec struct {
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}
+
+func (c *codec) Marshal(target interface{}) ([]byte, error) {
+	return c.marshal(target)
+}
+
+func (c *codec) Unmarshal(data []byte, target interface{}) error {
+	return c.unmarshal(data, target)
+}
+
+// Creates a codec from the marshal and unmarshal functions of an encoding library (eg.: json.Marshal, json.Unmarshal)
+func NewCodec(marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) Codec {
+	return &codec{
+		marshal:   marshal,
+		unmarshal: unmarshal,
+	}
+}
+
+type registration struct {
+	codec     Codec
+	mimeTypes []MimeType
+}
+
+var (
+	registryLock  sync.RWMutex
+	registry      = make(map[Encoding]*registration)
+	encodingOrder = make([]Encoding, 0)
+	mimeTypeIndex = make(map[MimeType]Encoding)
+)
+
+// Returns the given mime type without parameters (eg.: charset), trimmed and lower case
+func normalizeMimeType(s MimeType) MimeType {
+	var value = string(s)
+	if i := strings.Index(value, ";"); i >= 0 {
+		value = value[:i]
+	}
+	return MimeType(strings.ToLower(strings.TrimSpace(value)))
+}
+
+// Registers the codec of the given encoding and the mime types related to it, the first mime type is
+// the one used by default for the encoding. Registering an encoding again replaces its codec and adds
+// the new mime types, a mime type already registered is moved to the given encoding.
+// Registered encodings are available to io.Marshal, io.Unmarshal, ParseEncoding and ParseMimeType.
+func RegisterEncoding(enc Encoding, codec Codec, mimeTypes ...MimeType) {
+	if enc == EncodingUNKNOWNFormat || codec == nil {
+		return
+	}
+	defer registryLock.Unlock()
+	registryLock.Lock()
+	reg, ok := registry[enc]
+	if !ok {
+		reg = &registration{mimeTypes: make([]MimeType, 0)}
+		registry[enc] = reg
+		encodingOrder = append(encodingOrder, enc)
+	}
+	reg.codec = codec
+	for _, mimeType := range mimeTypes {
+		mimeType = normalizeMimeType(mimeType)
+		if mimeType == "" {
+			continue
+		}
+		if previous, ok := mimeTypeIndex[mimeType]; ok && previous != enc {
+			registry[previous].mimeTypes = removeMimeType(registry[previous].mimeTypes, mimeType)
+		}
+		if previous, ok := mimeTypeIndex[mimeType]; !ok || previous != enc {
+			reg.mimeTypes = append(reg.mimeTypes, mimeType)
+		}
+		mimeTypeIndex[mimeType] = enc
+	}
+}
+
+func removeMimeType(mimeTypes []MimeType, mimeType MimeType) []MimeType {
+	var out = make([]MimeType, 0)
+	for _, m := range mimeTypes {
+		if m != mimeType {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Returns the codec registered for the given encoding
+func GetCodec(enc Encoding) (Codec, bool) {
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	if reg, ok := registry[enc]; ok {
+		return reg.codec, true
+	}
+	return nil, false
+}
+
+// Returns the default mime type of the given encoding, or empty if the encoding is not registered
+func GetMimeType(enc Encoding) MimeType {
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	if reg, ok := registry[enc]; ok && len(reg.mimeTypes) > 0 {
+		return reg.mimeTypes[0]
+	}
+	return ""
+}
+
+// Returns the registered encodings, in registration order
+func Encodings() []Encoding {
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	return append(make([]Encoding, 0), encodingOrder...)
+}
+
+// Returns the registered mime types, in encoding registration order
+func MimeTypes() []MimeType {
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	var out = make([]MimeType, 0)
+	for _, enc := range encodingOrder {
+		out = append(out, registry[enc].mimeTypes...)
+	}
+	return out
+}
+
+// Returns the registered encoding with the given name, case insensitive, or EncodingUNKNOWNFormat
 func ParseEncoding(s string) Encoding {
-	switch s {
-	case "json", "JSON":
-		return EncodingJSONFormat
-	case "yaml", "YAML":
-		return EncodingYAMLFormat
-	case "xml", "XML":
-		return EncodingXMLFormat
-	default:
-		return EncodingUNKNOWNFormat
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	s = strings.TrimSpace(s)
+	if _, ok := registry[Encoding(s)]; ok {
+		return Encoding(s)
+	}
+	for _, enc := range encodingOrder {
+		if strings.EqualFold(string(enc), s) {
+			return enc
+		}
 	}
+	return EncodingUNKNOWNFormat
 }
 
+// Returns the registered encoding related to the given mime type, or EncodingUNKNOWNFormat.
+// Mime type parameters (eg.: application/json; charset=utf-8) are ignored
 func ParseMimeType(s MimeType) Encoding {
-	switch s {
-	case JsonMimeType:
-		return EncodingJSONFormat
-	case YamlMimeType:
-		return EncodingYAMLFormat
-	case XmlMimeType:
-		return EncodingXMLFormat
-	default:
-		return EncodingUNKNOWNFormat
+	defer registryLock.RUnlock()
+	registryLock.RLock()
+	if enc, ok := mimeTypeIndex[normalizeMimeType(s)]; ok {
+		return enc
 	}
+	return EncodingUNKNOWNFormat
 }
@@ -0,0 +1,86 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"github.com/hellgate75/go-network/testsuite"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestBuiltinEncodings(t *testing.T) {
+	testsuite.AssertEquals(t, "Json mime type must be parsed", EncodingJSONFormat, ParseMimeType(JsonMimeType))
+	testsuite.AssertEquals(t, "Yaml alternative mime type must be parsed", EncodingYAMLFormat, ParseMimeType("application/x-yaml"))
+	testsuite.AssertEquals(t, "Xml mime type must be case insensitive", EncodingXMLFormat, ParseMimeType("Text/XML"))
+	testsuite.AssertEquals(t, "Encoding name must be case insensitive", EncodingJSONFormat, ParseEncoding("JSON"))
+	testsuite.AssertEquals(t, "Unknown mime type must not be parsed", EncodingUNKNOWNFormat, ParseMimeType(ZipArchiveMimeType))
+	testsuite.AssertEquals(t, "Json default mime type must be same", JsonMimeType, GetMimeType(EncodingJSONFormat))
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	var reverse = Encoding("reverse")
+	RegisterEncoding(reverse, NewCodec(func(target interface{}) ([]byte, error) {
+		s, ok := target.(*string)
+		if !ok {
+			return nil, errors.New("Unsupported type")
+		}
+		var data = []byte(*s)
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return data, nil
+	}, func(data []byte, target interface{}) error {
+		var out = make([]byte, len(data))
+		for i := range data {
+			out[len(data)-1-i] = data[i]
+		}
+		*(target.(*string)) = string(out)
+		return nil
+	}), "application/x-reverse", "text/x-reverse")
+	testsuite.AssertEquals(t, "Registered mime type must be parsed", reverse, ParseMimeType("application/x-reverse"))
+	testsuite.AssertEquals(t, "Registered alternative mime type must be parsed", reverse, ParseMimeType("text/x-reverse"))
+	testsuite.AssertEquals(t, "Registered encoding must be parsed", reverse, ParseEncoding("REVERSE"))
+	testsuite.AssertEquals(t, "Registered default mime type must be the first one", MimeType("application/x-reverse"), GetMimeType(reverse))
+	codec, ok := GetCodec(reverse)
+	testsuite.AssertEquals(t, "Registered codec must be available", true, ok)
+	var value = "sample"
+	data, err := codec.Marshal(&value)
+	testsuite.AssertNil(t, "Marshal error must be nil", err)
+	testsuite.AssertEquals(t, "Marshal must use the registered codec", true, bytes.Equal([]byte("elpmas"), data))
+	var target string
+	err = codec.Unmarshal(data, &target)
+	testsuite.AssertNil(t, "Unmarshal error must be nil", err)
+	testsuite.AssertEquals(t, "Unmarshal must use the registered codec", value, target)
+	RegisterEncoding(Encoding("other"), codec, "text/x-reverse")
+	testsuite.AssertEquals(t, "Mime type registered again must move to the new encoding", Encoding("other"), ParseMimeType("text/x-reverse"))
+	testsuite.AssertEquals(t, "Previous encoding must keep its default mime type", MimeType("application/x-reverse"), GetMimeType(reverse))
+}
+
+func TestProtobufEncoding(t *testing.T) {
+	testsuite.AssertEquals(t, "Protobuf mime type must be parsed", EncodingProtobufFormat, ParseMimeType(ProtobufMimeType))
+	codec, ok := GetCodec(EncodingProtobufFormat)
+	testsuite.AssertEquals(t, "Protobuf codec must be available", true, ok)
+	data, err := codec.Marshal(wrapperspb.String("sample"))
+	testsuite.AssertNil(t, "Marshal error must be nil", err)
+	var target = &wrapperspb.StringValue{}
+	err = codec.Unmarshal(data, target)
+	testsuite.AssertNil(t, "Unmarshal error must be nil", err)
+	testsuite.AssertEquals(t, "Message must be same", "sample", target.GetValue())
+	_, err = codec.Marshal(&struct{ Name string }{"sample"})
+	testsuite.AssertNotNil(t, "Marshal of a non protobuf message must fail", err)
+}
+
+func TestNegotiateMimeType(t *testing.T) {
+	testsuite.AssertEquals(t, "Mime type parameters must be ignored", EncodingJSONFormat, ParseMimeType("application/json; charset=utf-8"))
+	testsuite.AssertEquals(t, "Empty header must choose the default mime type", JsonMimeType, NegotiateMimeType("", JsonMimeType))
+	testsuite.AssertEquals(t, "Highest quality value must win", JsonMimeType, NegotiateMimeType("application/xml;q=0.9, application/json", JsonMimeType))
+	testsuite.AssertEquals(t, "Highest quality value must win over the default", XmlMimeType, NegotiateMimeType("application/json;q=0.5, application/xml", JsonMimeType))
+	testsuite.AssertEquals(t, "Any mime type must choose the default", JsonMimeType, NegotiateMimeType("text/html, */*;q=0.8", JsonMimeType))
+	testsuite.AssertEquals(t, "Excluded default must not be chosen", XmlMimeType, NegotiateMimeType("application/json;q=0, application/*", JsonMimeType))
+	testsuite.AssertEquals(t, "Type wildcard must match a registered mime type", YamlMimeType, NegotiateMimeType("text/*", JsonMimeType))
+	testsuite.AssertEquals(t, "Unsupported mime types must not be chosen", MimeType(""), NegotiateMimeType("text/html, image/png", JsonMimeType))
+	var ranges = ParseAccept("text/*;q=0.5, application/json; charset=utf-8, */*;q=0.1")
+	testsuite.AssertEquals(t, "Accept ranges must be sorted by quality", JsonMimeType, ranges[0].MimeType)
+	testsuite.AssertEquals(t, "Accept range parameters must be parsed", "utf-8", ranges[0].Params["charset"])
+	testsuite.AssertEquals(t, "Accept range quality must be parsed", 0.5, ranges[1].Quality)
+}
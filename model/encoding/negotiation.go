@@ -0,0 +1,151 @@
+package encoding
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Describe a media range of an Accept header
+type AcceptRange struct {
+	// Accepted mime type, it can contain wildcards (eg.: */* or application/*)
+	MimeType MimeType
+	// Quality value, between 0 and 1 (0 means not acceptable)
+	Quality float64
+	// Media range parameters, except the quality value
+	Params map[string]string
+}
+
+func (r AcceptRange) specificity() int {
+	var value = string(r.MimeType)
+	switch {
+	case value == "*/*":
+		return 0
+	case strings.HasSuffix(value, "/*"):
+		return 1
+	case len(r.Params) > 0:
+		return 3
+	}
+	return 2
+}
+
+// Checks if the given mime type belongs to the media range
+func (r AcceptRange) Matches(mimeType MimeType) bool {
+	var value = string(normalizeMimeType(mimeType))
+	var accepted = string(r.MimeType)
+	if accepted == "*/*" || accepted == value {
+		return true
+	}
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(accepted, "*"))
+	}
+	return false
+}
+
+// Parses an Accept header value in the list of media ranges, sorted by preference: quality value first,
+// then the most specific range and finally the header order
+func ParseAccept(header string) []AcceptRange {
+	var ranges = make([]AcceptRange, 0)
+	for _, item := range strings.Split(header, ",") {
+		var parts = strings.Split(item, ";")
+		var mimeType = normalizeMimeType(MimeType(parts[0]))
+		if mimeType == "" {
+			continue
+		}
+		if mimeType == "*" {
+			mimeType = "*/*"
+		}
+		var r = AcceptRange{MimeType: mimeType, Quality: 1, Params: make(map[string]string)}
+		for _, param := range parts[1:] {
+			var kv = strings.SplitN(param, "=", 2)
+			var key = strings.ToLower(strings.TrimSpace(kv[0]))
+			var value = ""
+			if len(kv) > 1 {
+				value = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+			}
+			if key == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+					r.Quality = q
+				}
+				continue
+			}
+			if key != "" {
+				r.Params[key] = value
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Quality != ranges[j].Quality {
+			return ranges[i].Quality > ranges[j].Quality
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// Returns the quality value given by the media ranges to the mime type: the most specific matching range wins
+func quality(ranges []AcceptRange, mimeType MimeType) float64 {
+	var q = -1.0
+	var specificity = -1
+	for _, r := range ranges {
+		if r.Matches(mimeType) && r.specificity() > specificity {
+			q = r.Quality
+			specificity = r.specificity()
+		}
+	}
+	return q
+}
+
+// Chooses the registered mime type best matching the given Accept header value, or empty if none is acceptable.
+// An empty header accepts any mime type. The given default mime type is preferred when it matches a wildcard range
+// (eg.: */*), then the default mime types of the registered encodings and finally the alternative ones,
+// in registration order.
+func NegotiateMimeType(accept string, defaultMimeType MimeType) MimeType {
+	// Default mime types of the encodings are preferred to the alternative ones
+	var candidates = make([]MimeType, 0)
+	for _, enc := range Encodings() {
+		if mimeType := GetMimeType(enc); mimeType != "" {
+			candidates = append(candidates, mimeType)
+		}
+	}
+	candidates = append(candidates, MimeTypes()...)
+	defaultMimeType = normalizeMimeType(defaultMimeType)
+	if strings.TrimSpace(accept) == "" {
+		if defaultMimeType != "" && ParseMimeType(defaultMimeType) != EncodingUNKNOWNFormat {
+			return defaultMimeType
+		}
+		if len(candidates) > 0 {
+			return candidates[0]
+		}
+		return ""
+	}
+	if defaultMimeType != "" {
+		candidates = append([]MimeType{defaultMimeType}, candidates...)
+	}
+	var ranges = ParseAccept(accept)
+	var best MimeType = ""
+	var bestQuality = 0.0
+	for _, r := range ranges {
+		if r.Quality <= 0 || r.Quality < bestQuality {
+			continue
+		}
+		if r.specificity() >= 2 {
+			// Explicit mime type
+			if q := quality(ranges, r.MimeType); q > bestQuality && ParseMimeType(r.MimeType) != EncodingUNKNOWNFormat {
+				best, bestQuality = r.MimeType, q
+			}
+			continue
+		}
+		for _, candidate := range candidates {
+			if !r.Matches(candidate) || ParseMimeType(candidate) == EncodingUNKNOWNFormat {
+				continue
+			}
+			if q := quality(ranges, candidate); q > bestQuality {
+				best, bestQuality = candidate, q
+				break
+			}
+		}
+	}
+	return best
+}
@@ -1,6 +1,9 @@
 package model
 
-import "crypto/tls"
+import (
+	"context"
+	"crypto/tls"
+)
 
 type PipeType byte
 
@@ -27,8 +30,11 @@ type PipeNode interface {
 	Type() PipeType
 	// Starts Pipe Node and serve requests
 	Start() error
-	// Stops Pipe Node and stop requests
+	// Stops Pipe Node and stop requests, waiting for the in-flight requests up to the package ServerWaitTimeout
 	Stop() error
+	// Stops accepting new connections and waits for the in-flight requests to complete, until the context is done,
+	// then closes the remaining connections and returns the context error
+	Shutdown(ctx context.Context) error
 	// Verify Pipe Node is running
 	Running() bool
 	// Wait for Pipe Node is down
@@ -60,6 +60,10 @@ type ApiCallHandler interface {
 	SetServerMap(m *map[string]interface{})
 	// Set the server logger
 	SetLogger(logger log.Logger)
+	// Set reference to the server middleware list, applied before the handler middleware
+	SetMiddleware(middleware *[]ApiMiddleware)
+	// Set reference to the server authenticators list, used for authenticating the requests
+	SetAuthenticators(authenticators *[]Authenticator)
 }
 
 // Interface that describes the callback action of an API call
@@ -72,6 +76,42 @@ type ApiAction interface {
 // Describe execution function for API rest connections
 type ApiActionFunction func(context.ApiCallContext) error
 
+// Describe a middleware wrapping the execution function of API rest connections: it can act before and after
+// calling the next function, change the context passed to it or answer the request without calling it
+type ApiMiddleware func(next ApiActionFunction) ApiActionFunction
+
+// Composes the given middleware around the given function: the first middleware is the outermost one,
+// so it runs first before calling the next function and last after its completion
+func ChainApiMiddleware(function ApiActionFunction, middleware ...ApiMiddleware) ApiActionFunction {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i] != nil {
+			function = middleware[i](function)
+		}
+	}
+	return function
+}
+
+// Defines an handler of the WebSocket connections upgraded on a path
+type WebSocketHandler interface {
+	// Upgrade the request connection using http.Request, http.ResponseWriter, and handle the WebSocket connection
+	HandleRequest(http.ResponseWriter, *http.Request)
+	// Returns the path filter for this WebSocket handler
+	GetPath() string
+	// Returns the hub of the handler connections, used for broadcasting messages
+	Hub() *context.WebSocketHub
+	// Set reference to server map or leave map nil, if not used
+	SetServerMap(m *map[string]interface{})
+	// Set the server logger
+	SetLogger(logger log.Logger)
+	// Set reference to the server middleware list, applied to the upgrade request before the handler middleware
+	SetMiddleware(middleware *[]ApiMiddleware)
+	// Set reference to the server authenticators list, used for authenticating the upgrade requests
+	SetAuthenticators(authenticators *[]Authenticator)
+}
+
+// Describe execution function for WebSocket connections: it is called once the connection is upgraded,
+// and the connection is closed when it returns
+type WebSocketFunction func(context.WebSocketContext) error
 
 // Defines an handler for an multiple actionsin a request
 type TcpCallHandler interface {
@@ -87,6 +127,8 @@ type TcpCallHandler interface {
 	SetLogger(logger log.Logger)
 	// Set encoding used by the server
 	SetEncoding(enc encoding.Encoding)
+	// Set reference to the server interceptor list, applied before the handler interceptors
+	SetInterceptors(interceptors *[]TcpInterceptor)
 }
 
 // Interface that describes the callback action of an Tcp request
@@ -100,3 +142,23 @@ type TcpAction interface {
 
 // Describe execution function for tcp connections
 type TcpActionFunction func(context.TcpContext) error
+
+// Describe an interceptor wrapping the execution function of tcp actions: it can act before and after
+// calling the next function, change the context passed to it or skip it
+type TcpInterceptor func(next TcpActionFunction) TcpActionFunction
+
+// Describe an interceptor invoked when the server accepts a new connection, before any request is read.
+// It can store connection level information in the connection map, available in the TcpContext, and
+// return the given connection or a wrapping one. Returning an error the connection is rejected and closed
+type TcpConnectionInterceptor func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error)
+
+// Composes the given interceptors around the given function: the first interceptor is the outermost one,
+// so it runs first before calling the next function and last after its completion
+func ChainTcpInterceptors(function TcpActionFunction, interceptors ...TcpInterceptor) TcpActionFunction {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if interceptors[i] != nil {
+			function = interceptors[i](function)
+		}
+	}
+	return function
+}
@@ -1,12 +1,25 @@
 package model
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"github.com/hellgate75/go-network/model/encoding"
 	"io"
+	"os"
 	"time"
 )
 
+// Tcp message framing protocol
+type FramingMode byte
+
+const (
+	// Raw stream mode: messages are written as they are, and boundaries are guessed by the reader
+	RawFraming FramingMode = iota
+	// Length-prefixed mode: each message is sent as a 4 bytes big-endian length header followed by the payload
+	LengthPrefixedFraming
+)
+
 // Describes an Tcp Server most features
 type TcpServer interface {
 	// Creates server configuration, and setup the network properties.
@@ -14,8 +27,11 @@ type TcpServer interface {
 	Init(config TcpServerConfig) (TcpServer, error)
 	// Starts Tcp Server and serve requests
 	Start() error
-	// Stops Tcp Server and stop requests
+	// Stops Tcp Server and stop requests, waiting for the in-flight requests up to the package ServerWaitTimeout
 	Stop() error
+	// Stops accepting new connections and waits for the in-flight requests to complete, until the context is done,
+	// then closes the remaining connections and returns the context error
+	Shutdown(ctx context.Context) error
 	// Verifies Tcp Server is running
 	Running() bool
 	// Verifies Tcp Server is running
@@ -27,16 +43,26 @@ type TcpServer interface {
 	// It raises exception if the API call handler has not method call handling function
 	// or if the Path is duplicate
 	AddPath(TcpCallHandler) error
+	// Add interceptors applied to the actions of all the call handlers, also the ones already added.
+	// Server interceptors run in the given order, before the handler interceptors and the action function.
+	// Interceptors must be added before starting the server
+	Use(interceptors ...TcpInterceptor)
+	// Add interceptors invoked, in the given order, on each accepted connection before reading any request.
+	// Interceptors must be added before starting the server
+	UseOnAccept(interceptors ...TcpConnectionInterceptor)
 }
 
-// Describes an Tcp Client most features
+// Describes an Tcp Client most features. Heartbeat, half-open connections detection and automatic reconnection
+// work only with the LengthPrefixedFraming protocol, in raw mode they are not active
 type TcpClient interface {
 	// Configure a new Connection using server base path
 	Connect(config TcpClientConfig) error
-	// Close client connection
+	// Close client connection, stopping heartbeat and automatic reconnection
 	Close() error
 	// check if client connection is open
 	IsOpen() bool
+	// Returns the current connection state
+	State() ConnectionState
 	// Make a call
 	// Request must be sent to the body Reader (preferred: bytes.Buffer)
 	Send(body io.Reader, response interface{}, timeout time.Duration) error
@@ -45,6 +71,136 @@ type TcpClient interface {
 	Encode(request interface{}, response interface{}, timeout time.Duration) error
 	// Wait for a client answer, for the maximum timeout of forever in case the timeout is zero
 	ReadRemote(timeout time.Duration, response interface{}) error
+	// Make a call, bound to the given context for cancellation and deadlines
+	// Request must be sent to the body Reader (preferred: bytes.Buffer)
+	SendContext(ctx context.Context, body io.Reader, response interface{}) error
+	// Make a call, bound to the given context for cancellation and deadlines
+	// Request must be sent and object with preferred encoding configuration
+	EncodeContext(ctx context.Context, request interface{}, response interface{}) error
+	// Wait for a client answer, until the given context is done
+	ReadRemoteContext(ctx context.Context, response interface{}) error
+	// Make a call to the named server action, tagging the request with a unique identifier echoed by the
+	// server response, so multiple goroutines can make concurrent calls over the same connection.
+	// It requires the LengthPrefixedFraming protocol and waits for the response until the context is done.
+	// Failures reported by the server are returned as *TcpError
+	Call(ctx context.Context, action string, request interface{}, response interface{}) error
+}
+
+// Describes a pool of Tcp Clients connected to the same server, reusing the connections across the calls
+type TcpClientPool interface {
+	// Borrows a connected client from the pool, dialing a new one if no idle client is available.
+	// When the maximum number of open clients is reached it waits for a released client until the context is done.
+	// Borrowed clients must be given back with Release
+	Borrow(ctx context.Context) (TcpClient, error)
+	// Gives back a borrowed client to the pool, closed clients are discarded
+	Release(client TcpClient) error
+	// Makes a call to the named server action with a borrowed client, released after the call
+	Call(ctx context.Context, action string, request interface{}, response interface{}) error
+	// Returns the pool counters
+	Stats() TcpClientPoolStats
+	// Closes the idle clients and stops the pool, borrowed clients are closed when released
+	Close() error
+}
+
+// Describe the Tcp Client pool properties
+type TcpClientPoolConfig struct {
+	// Number of idle clients the pool keeps connected
+	MinIdle			int
+	// Maximum number of idle clients, extra released clients are closed (0 means no limit)
+	MaxIdle			int
+	// Maximum number of open clients, idle and borrowed (0 means no limit)
+	MaxOpen			int
+	// Idle time after which an idle client is closed, keeping MinIdle clients (0 means no limit)
+	IdleTimeout		time.Duration
+	// Time after which a client is closed, when idle or released (0 means no limit)
+	MaxLifetime		time.Duration
+	// Function verifying an idle client before it is borrowed, unhealthy clients are closed (nil means the
+	// client must be open and connected)
+	HealthCheck		func(client TcpClient) error
+}
+
+// Describe the Tcp Client pool counters
+type TcpClientPoolStats struct {
+	// Number of open clients, idle and borrowed
+	Open			int
+	// Number of idle clients
+	Idle			int
+	// Number of borrowed clients
+	InUse			int
+	// Total number of dialed clients
+	Dialed			int64
+	// Total number of clients closed by idle timeout, max lifetime or health check
+	Evicted			int64
+	// Total number of borrow calls that waited for a released client
+	Waits			int64
+}
+
+// Tcp Server error code
+type TcpErrorCode string
+
+const (
+	// The requested action is not registered on the server
+	UnknownActionError TcpErrorCode = "unknown-action"
+)
+
+// Describes an error reported by the Tcp Server in answer to a call
+type TcpError struct {
+	// Error code
+	Code		TcpErrorCode
+	// Requested action name
+	Action		string
+	// Error description
+	Message		string
+}
+
+func (e *TcpError) Error() string {
+	return fmt.Sprintf("Tcp Server error <%s> for action '%s': %s", e.Code, e.Action, e.Message)
+}
+
+// Tcp Client connection state
+type ConnectionState byte
+
+const (
+	// Client is not connected
+	Disconnected ConnectionState = iota
+	// Client is connecting for the first time
+	Connecting
+	// Client is connected to the server
+	Connected
+	// Client lost the connection and it is connecting again
+	Reconnecting
+	// Client connection has been closed by the user
+	Closed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	case Closed:
+		return "closed"
+	}
+	return "disconnected"
+}
+
+// Describe a function notified of each client connection state change
+type ConnectionStateListener func(previous ConnectionState, current ConnectionState)
+
+// Describe the automatic reconnection of a client that lost the connection. Wait time between the
+// attempts starts from InitialBackoff and it is multiplied by Multiplier at each attempt, up to MaxBackoff
+type ReconnectPolicy struct {
+	// Maximum number of reconnection attempts (0 means no limit)
+	MaxAttempts		int
+	// Wait time before the first attempt
+	InitialBackoff	time.Duration
+	// Maximum wait time between the attempts (0 means no limit)
+	MaxBackoff		time.Duration
+	// Wait time multiplier (0 means 2)
+	Multiplier		float64
 }
 
 // Describe client connection properties
@@ -55,20 +211,45 @@ type TcpClientConfig struct {
 	Host 		string
 	// Remote Tcp Server Port
 	Port 		int
-	// Remote Tcp Server connection timeout (0 means not set)
+	// Remote Tcp Server call timeout, applied to each raw mode call (0 means not set)
 	Timeout		time.Duration
 	// Remote Tcp Server Security Configuration
 	Config 		*tls.Config
 	// Encoding
 	Encoding		encoding.Encoding
+	// Message framing protocol (default: RawFraming)
+	Framing			FramingMode
+	// Maximum size of a single frame payload in bytes (0 means stream.DefaultMaxFrameSize)
+	MaxFrameSize	uint32
+	// Server action of the framed requests sent with Send, Encode, SendContext and EncodeContext, it is
+	// required by the LengthPrefixedFraming protocol and by the datagram client (Call names the action on each request)
+	Action			string
+	// Remote Tcp Server dial timeout (0 means no timeout)
+	DialTimeout		time.Duration
+	// TCP keep-alive probes period (0 means the system default, negative values disable keep-alive)
+	KeepAlive		time.Duration
+	// Interval between the heartbeat messages, it requires LengthPrefixedFraming (0 means no heartbeat)
+	HeartbeatInterval	time.Duration
+	// Maximum wait time of a heartbeat answer, before the connection is considered lost (0 means HeartbeatInterval)
+	HeartbeatTimeout	time.Duration
+	// Automatic reconnection policy, it requires LengthPrefixedFraming (nil means no reconnection)
+	Reconnect		*ReconnectPolicy
+	// Listener notified of each connection state change (nil means no listener)
+	OnStateChange	ConnectionStateListener
+	// Connection pool properties, used by the Tcp Client pool (nil means the pool defaults)
+	Pool			*TcpClientPoolConfig
+	// Function returning the length-prefixed frame sent on each new connection, before any request
+	// (eg.: an authentication token for the interceptors.FirstFrame connection interceptor), nil means no frame
+	Handshake		func() ([]byte, error)
 }
 
 
 // Describe server connection properties
 type TcpServerConfig struct {
-	// Connection network type (default: tcp)
+	// Connection network type: tcp, tcp4, tcp6, unix or unixpacket (default: tcp), the datagram server supports
+	// udp, udp4 and udp6
 	Network		string
-	// Host name or ip address (eg. my-host.acme.com or 127,0,0,1 or empty or 0.0.0.0)
+	// Host name or ip address (eg. my-host.acme.com or 127,0,0,1 or empty or 0.0.0.0), or socket file path for unix networks
 	Host 		string
 	// Tcp Server Port
 	Port 		int
@@ -76,4 +257,10 @@ type TcpServerConfig struct {
 	Config 		*tls.Config
 	// Encoding
 	Encoding		encoding.Encoding
-}
+	// Message framing protocol (default: RawFraming)
+	Framing			FramingMode
+	// Maximum size of a single frame payload in bytes (0 means stream.DefaultMaxFrameSize)
+	MaxFrameSize	uint32
+	// Unix socket file permissions (0 means the process umask default)
+	SocketMode		os.FileMode
+}
\ No newline at end of file
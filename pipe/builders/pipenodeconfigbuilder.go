@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"github.com/hellgate75/go-network/common"
 	"github.com/hellgate75/go-network/model"
 	"golang.org/x/crypto/acme/autocert"
 	"io/ioutil"
@@ -31,6 +32,9 @@ type PipeNodeConfigBuilder interface {
 	WithClientCaCert(certificate string) PipeNodeConfigBuilder
 	// Set up the certificate manager for the auto-scan of certificates for a folder
 	WithCertificateManager(dir string) PipeNodeConfigBuilder
+	// Set up the source of the server certificates, reloaded when their files change and selected by the client
+	// requested server name (SNI), in place of the TLS certificates and the certificate manager, it enables the Tls encryption
+	WithCertificateSource(source *common.CertificateSource) PipeNodeConfigBuilder
 	// Add more root CA certificate files to the certificate list to the builder workflow
 	MoreClientCaCerts(certificate string) PipeNodeConfigBuilder
 	// Add more client CA certificate files to the certificate list to the builder workflow
@@ -75,6 +79,7 @@ type pipeNodeConfigBuilder struct{
 	renegotiation            tls.RenegotiationSupport
 	cache                    tls.ClientSessionCache
 	preferServerCipherSuites bool
+	certSource               *common.CertificateSource
 }
 
 func (b *pipeNodeConfigBuilder) UseTlsEncryption(use bool) PipeNodeConfigBuilder {
@@ -172,7 +177,7 @@ func (b *pipeNodeConfigBuilder) MoreTLSCerts(certificate string, key string) Pip
 
 func (b *pipeNodeConfigBuilder) WithRootCaCert(certificate string) PipeNodeConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -183,7 +188,7 @@ func (b *pipeNodeConfigBuilder) WithRootCaCert(certificate string) PipeNodeConfi
 
 func (b *pipeNodeConfigBuilder) WithClientCaCert(certificate string) PipeNodeConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -194,7 +199,7 @@ func (b *pipeNodeConfigBuilder) WithClientCaCert(certificate string) PipeNodeCon
 
 func (b *pipeNodeConfigBuilder) MoreClientCaCerts(certificate string) PipeNodeConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -205,7 +210,7 @@ func (b *pipeNodeConfigBuilder) MoreClientCaCerts(certificate string) PipeNodeCo
 
 func (b *pipeNodeConfigBuilder) MoreRootCaCerts(certificate string) PipeNodeConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -214,6 +219,12 @@ func (b *pipeNodeConfigBuilder) MoreRootCaCerts(certificate string) PipeNodeConf
 	return b
 }
 
+func (b *pipeNodeConfigBuilder) WithCertificateSource(source *common.CertificateSource) PipeNodeConfigBuilder {
+	b.certSource = source
+	b.useTls = true
+	return b
+}
+
 func (b *pipeNodeConfigBuilder) WithCertificateManager(dir string) PipeNodeConfigBuilder {
 	b.certManager = &autocert.Manager{
 		Prompt: autocert.AcceptTOS,
@@ -280,6 +291,9 @@ func (b *pipeNodeConfigBuilder) Build() (model.PipeNodeConfig, error) {
 			Renegotiation: b.renegotiation,
 		}
 	}
+	if tlsConfig != nil && b.certSource != nil {
+		b.certSource.ApplyTo(tlsConfig)
+	}
 	return model.PipeNodeConfig{
 		Network: b.network,
 		InHost: b.inAddress,
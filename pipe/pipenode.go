@@ -1,6 +1,7 @@
 package pipe
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -12,15 +13,8 @@ import (
 	"time"
 )
 
-type Signal byte
-
-const (
-	shutdown	Signal = iota + 1
-	purge
-	exit
-)
-
 var (
+	// Maximum time Stop waits for the in-flight messages, before closing the connections
 	ServerWaitTimeout = 120 * time.Second
 	ServerClientResetTimeout = 500 * time.Millisecond
 )
@@ -30,14 +24,16 @@ type pipeNode struct {
 	running				bool
 	inChan				chan model.PipeMessage
 	outChan				chan model.PipeMessage
-	internal			chan Signal
-	commands			chan Signal
+	done				chan struct{}
+	halt				chan struct{}
+	changes				chan struct{}
 	logger				log.Logger
-	timer				*time.Ticker
 	activeRequests		int64
 	activeClients		int64
+	connections			map[net.Conn]struct{}
 	requestsMutex		sync.Mutex
 	clientsMutex		sync.Mutex
+	stateMutex			sync.Mutex
 	tcpListener			*net.Listener
 	outputAddress		string
 	inChanCreated		bool
@@ -45,7 +41,7 @@ type pipeNode struct {
 }
 
 func (pipe *pipeNode) Init(config model.PipeNodeConfig) (model.PipeNode, error) {
-	if pipe.running {
+	if pipe.Running() {
 		return pipe, errors.New(fmt.Sprint("PipeNode.Init() - Server is still running"))
 	}
 	pipe.config = &config
@@ -64,7 +60,7 @@ func (pipe *pipeNode) Start() error {
 			pipe.logger.Fatalf("PipeNode.Start() -  Error: %v", err)
 		}
 	}()
-	if pipe.running {
+	if pipe.Running() {
 		pipe.logger.Fatal("PipeNode.Start() - Error: Server already running")
 		return errors.New(fmt.Sprint("PipeNode.Start() - Error: Server already running"))
 	}
@@ -76,25 +72,31 @@ func (pipe *pipeNode) Start() error {
 		pipe.logger.Fatalf("PipeNode.Start() - Error: Invalid Pipe Node Type %v", pipe.config.Type)
 		return errors.New(fmt.Sprintf("PipeNode.Start() - Error: Invalid Pipe Node Type %v", pipe.config.Type))
 	}
-	pipe.internal = make(chan Signal)
-	pipe.commands = make(chan Signal)
+	pipe.stateMutex.Lock()
+	pipe.done = make(chan struct{})
+	pipe.halt = make(chan struct{})
+	pipe.changes = make(chan struct{}, 1)
+	pipe.connections = make(map[net.Conn]struct{})
+	pipe.stateMutex.Unlock()
 	if pipe.config.Type == model.InputPipe || pipe.config.Type == model.InputOutputPipe {
 		go func() {
 			var address = fmt.Sprintf("%s:%v", pipe.config.InHost, pipe.config.InPort)
 			var l net.Listener
+			var err error
 			if pipe.config.Config != nil {
 				l, err = tls.Listen("tcp", address, pipe.config.Config)
 			} else {
 				l, err = net.Listen("tcp", address)
 			}
 			if err == nil {
+				pipe.stateMutex.Lock()
 				pipe.running = true
-				pipe.logger.Infof("PipeNode.Start() - Server started on: %s", address)
 				pipe.tcpListener = &l
-				go pipe.acceptClients()
+				pipe.stateMutex.Unlock()
+				pipe.logger.Infof("PipeNode.Start() - Server started on: %s", address)
+				go pipe.acceptClients(l)
 			} else {
 				pipe.logger.Errorf("PipeNode.Start() - Server failed to start on: %s, due to error: %v", address, err)
-				pipe.tcpListener = nil
 			}
 		}()
 	}
@@ -123,7 +125,11 @@ func (pipe *pipeNode) handleConnection(conn net.Conn) {
 	}()
 	data, err := ioutil.ReadAll(conn)
 	if err == nil {
-		pipe.outChan <- model.PipeMessage(data)
+		select {
+		case pipe.outChan <- model.PipeMessage(data):
+		case <-pipe.halt:
+			pipe.logger.Warnf("PipeNode.handleConnection() - Message from client %+v discarded by shutdown", addr)
+		}
 	} else {
 		pipe.logger.Warnf("PipeNode.handleConnection() - Unread message from client %+v, Error %v", addr, err)
 	}
@@ -143,14 +149,17 @@ func (pipe *pipeNode) callClient(message model.PipeMessage) {
 	}
 	if err != nil {
 		pipe.logger.Errorf("PipeNode.callClient() - Error connecting with client %s: %v", pipe.outputAddress, err)
+		pipe.deregisterClient()
 		return
 	}
+	pipe.track(conn)
 	defer func() {
 		time.Sleep(1 * time.Second)
 		err = conn.Close()
 		if err != nil {
 			pipe.logger.Errorf("PipeNode.callClient() - Error disconnecting from client %s: %v", pipe.outputAddress, err)
 		}
+		pipe.untrack(conn)
 		pipe.deregisterClient()
 	}()
 	_, err = conn.Write([]byte(message))
@@ -161,18 +170,16 @@ func (pipe *pipeNode) callClient(message model.PipeMessage) {
 }
 
 func (pipe *pipeNode) readFromInputChannel() {
-	if ! pipe.running {
-		pipe.running = true
-	}
+	pipe.setRunning(true)
 	pipe.inChan = make(chan model.PipeMessage)
 	pipe.inChanCreated = true
 	ClientCycle:
-	for pipe.running {
+	for pipe.Running() {
 		select {
 		case msg := <- pipe.inChan:
 			go pipe.callClient(msg)
 		case <- time.After(ServerClientResetTimeout):
-			if ! pipe.running {
+			if ! pipe.Running() {
 				break ClientCycle
 			}
 			continue
@@ -180,7 +187,7 @@ func (pipe *pipeNode) readFromInputChannel() {
 	}
 }
 
-func (pipe *pipeNode) acceptClients() {
+func (pipe *pipeNode) acceptClients(listener net.Listener) {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
@@ -188,41 +195,28 @@ func (pipe *pipeNode) acceptClients() {
 			pipe.logger.Fatalf("PipeNode.acceptClients() - Error: %v", err)
 		}
 	}()
-	if pipe.tcpListener != nil {
-		pipe.outChan = make(chan model.PipeMessage)
-		pipe.outChanCreated = true
-		for pipe.running{
-			var conn net.Conn
-			conn, err = (*pipe.tcpListener).Accept()
-			if err != nil{
-				pipe.logger.Errorf("PipeNode.acceptClients() - Acceptance Error: %v", err)
-				continue
-			}
-			pipe.logger.Debugf("PipeNode.acceptClients() - Handling request from: %+v ...", conn.RemoteAddr())
-			go pipe.handleConnection(conn)
-		}
-	} else {
-		pipe.logger.Fatalf("PipeNode.acceptClients() - Invalid listener - Stopping server ...")
-		err = pipe.Stop()
-		pipe.logger.Error(err)
-	}
-}
-
-func (pipe *pipeNode) shutdownTimer() {
-	pipe.timer = time.NewTicker(5 * time.Second)
-	defer func() {
-		pipe.timer.Stop()
-		pipe.timer = nil
-	}()
-	for {
-		select {
-		case <- pipe.timer.C:
-			if pipe.checkExit() {
-				pipe.evacuate()
+	pipe.outChan = make(chan model.PipeMessage)
+	pipe.outChanCreated = true
+	for pipe.Running() {
+		var conn net.Conn
+		conn, err = listener.Accept()
+		if err != nil{
+			if ! pipe.Running() {
 				return
 			}
-
+			pipe.logger.Errorf("PipeNode.acceptClients() - Acceptance Error: %v", err)
+			continue
 		}
+		pipe.logger.Debugf("PipeNode.acceptClients() - Handling request from: %+v ...", conn.RemoteAddr())
+		pipe.track(conn)
+		pipe.registerRequest()
+		go func(conn net.Conn) {
+			defer func() {
+				pipe.untrack(conn)
+				pipe.deregisterRequest()
+			}()
+			pipe.handleConnection(conn)
+		}(conn)
 	}
 }
 
@@ -233,9 +227,10 @@ func (pipe *pipeNode) registerRequest() {
 }
 
 func (pipe *pipeNode) deregisterRequest() {
-	defer pipe.requestsMutex.Unlock()
 	pipe.requestsMutex.Lock()
 	pipe.activeRequests--
+	pipe.requestsMutex.Unlock()
+	pipe.notifyChange()
 }
 
 func (pipe *pipeNode) registerClient() {
@@ -245,67 +240,116 @@ func (pipe *pipeNode) registerClient() {
 }
 
 func (pipe *pipeNode) deregisterClient() {
-	defer pipe.clientsMutex.Unlock()
 	pipe.clientsMutex.Lock()
 	pipe.activeClients--
+	pipe.clientsMutex.Unlock()
+	pipe.notifyChange()
 }
 
-func (pipe *pipeNode) working() bool {
-	return pipe.activeRequests > 0 && pipe.activeClients > 0
+func (pipe *pipeNode) track(conn net.Conn) {
+	defer pipe.stateMutex.Unlock()
+	pipe.stateMutex.Lock()
+	pipe.connections[conn] = struct{}{}
 }
 
-func (pipe *pipeNode) checkExit() bool {
-	if ! pipe.Running() && ! pipe.working() {
-		pipe.internal <- exit
-		return true
+func (pipe *pipeNode) untrack(conn net.Conn) {
+	pipe.stateMutex.Lock()
+	delete(pipe.connections, conn)
+	pipe.stateMutex.Unlock()
+	pipe.notifyChange()
+}
+
+// Wakes up the shutdown in progress, waiting for in-flight messages
+func (pipe *pipeNode) notifyChange() {
+	select {
+	case pipe.changes <- struct{}{}:
+	default:
 	}
-	return false
+}
+
+func (pipe *pipeNode) working() bool {
+	pipe.requestsMutex.Lock()
+	var requests = pipe.activeRequests
+	pipe.requestsMutex.Unlock()
+	pipe.clientsMutex.Lock()
+	var clients = pipe.activeClients
+	pipe.clientsMutex.Unlock()
+	return requests > 0 || clients > 0
+}
+
+func (pipe *pipeNode) setRunning(running bool) {
+	defer pipe.stateMutex.Unlock()
+	pipe.stateMutex.Lock()
+	pipe.running = running
 }
 
 func (pipe *pipeNode) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ServerWaitTimeout)
+	defer cancel()
+	return pipe.Shutdown(ctx)
+}
+
+func (pipe *pipeNode) Shutdown(ctx context.Context) error {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("PipeNode.Stop() - Error: %v", r))
-			pipe.logger.Fatalf("PipeNode.Stop() -  Error: %v", err)
+			err = errors.New(fmt.Sprintf("PipeNode.Shutdown() - Error: %v", r))
+			pipe.logger.Fatalf("PipeNode.Shutdown() -  Error: %v", err)
 		}
 	}()
+	pipe.stateMutex.Lock()
 	if ! pipe.running {
-		err = errors.New(fmt.Sprint("PipeNode.Stop() - Error: Server is already stopped"))
-		pipe.logger.Errorf("PipeNode.Stop() -  %v", err)
+		pipe.stateMutex.Unlock()
+		err = errors.New(fmt.Sprint("PipeNode.Shutdown() - Error: Server is already stopped"))
+		pipe.logger.Errorf("PipeNode.Shutdown() -  %v", err)
 		return err
 	}
-	pipe.internal <- shutdown
-	go pipe.shutdownTimer()
 	pipe.running = false
 	if pipe.tcpListener != nil {
-		err := (*pipe.tcpListener).Close()
+		err = (*pipe.tcpListener).Close()
 		if err != nil {
-			pipe.logger.Errorf("PipeNode.Stop() - Gently shutting down server error occurred: %v", err)
-			pipe.logger.Warnf("PipeNode.Stop() - Try brute-force server close ...")
-			pipe.activeRequests = 0
-			pipe.activeClients = 0
+			pipe.logger.Errorf("PipeNode.Shutdown() - Closing listener error occurred: %v", err)
 		}
 		pipe.tcpListener = nil
 	}
+	pipe.stateMutex.Unlock()
+	defer close(pipe.done)
+	for pipe.working() || pipe.connectionsCount() > 0 {
+		select {
+		case <-pipe.changes:
+		case <-ctx.Done():
+			pipe.logger.Warnf("PipeNode.Shutdown() - Deadline reached, closing remaining connections ...")
+			close(pipe.halt)
+			pipe.stateMutex.Lock()
+			for conn := range pipe.connections {
+				_ = conn.Close()
+			}
+			pipe.stateMutex.Unlock()
+			return ctx.Err()
+		}
+	}
+	pipe.evacuate()
 	return err
 }
 
+func (pipe *pipeNode) connectionsCount() int {
+	defer pipe.stateMutex.Unlock()
+	pipe.stateMutex.Lock()
+	return len(pipe.connections)
+}
+
 func (pipe *pipeNode) Running() bool {
+	defer pipe.stateMutex.Unlock()
+	pipe.stateMutex.Lock()
 	return pipe.running
 }
 
+// Closes the input pipe channel, once no message can be sent on it
 func (pipe *pipeNode) evacuate() {
-	close(pipe.internal)
-	pipe.internal = nil
-	close(pipe.commands)
-	pipe.commands = nil
-	if pipe.config.Type == model.InputPipe || pipe.config.Type == model.InputOutputPipe {
-		close(pipe.inChan)
+	if pipe.config.Type == model.OutputPipe || pipe.config.Type == model.InputOutputPipe {
 		pipe.inChanCreated = false
-		pipe.inChan = nil
 	}
-	if pipe.config.Type == model.OutputPipe || pipe.config.Type == model.InputOutputPipe {
+	if (pipe.config.Type == model.InputPipe || pipe.config.Type == model.InputOutputPipe) && pipe.outChan != nil {
 		close(pipe.outChan)
 		pipe.outChanCreated = false
 		pipe.outChan = nil
@@ -314,13 +358,13 @@ func (pipe *pipeNode) evacuate() {
 
 func (pipe *pipeNode) isOperating() bool {
 	if pipe.config.Type == model.InputOutputPipe {
-		return pipe.running && pipe.inChanCreated && pipe.outChanCreated
+		return pipe.Running() && pipe.inChanCreated && pipe.outChanCreated
 	} else if pipe.config.Type == model.InputPipe {
-		return pipe.running && pipe.outChanCreated
+		return pipe.Running() && pipe.outChanCreated
 	} else if pipe.config.Type == model.OutputPipe {
-		return pipe.running && pipe.inChanCreated
+		return pipe.Running() && pipe.inChanCreated
 	}
-	return pipe.running
+	return pipe.Running()
 }
 
 func (pipe *pipeNode) UntilStarted() {
@@ -337,28 +381,15 @@ func (pipe *pipeNode) UntilStarted() {
 }
 
 func (pipe *pipeNode) Wait() {
-	defer func() {
-		if r := recover(); r != nil {
-			pipe.logger.Fatalf("PipeNode.Wait() - Fatal Error: %v", r)
-		}
-	}()
-	pipe.logger.Debugf("PipeNode.Wait() - Waiting for server shutdown")
-waitCycle:
-	for pipe.Running() || pipe.working() {
-		select {
-		case sig := <- pipe.internal:
-			if sig == shutdown {
-				pipe.commands	<- purge
-			} else if sig == exit {
-				break waitCycle
-			}
-		case <- time.After(ServerWaitTimeout):
-			continue
-		}
+	pipe.stateMutex.Lock()
+	var done = pipe.done
+	pipe.stateMutex.Unlock()
+	if done == nil {
+		return
 	}
-	pipe.logger.Warnf("PipeNode.Wait() - Server shutdown in progress, exiting ...")
-	time.Sleep(10 * time.Second)
-	pipe.logger.Warnf("PipeNode.Wait() - exit")
+	pipe.logger.Debugf("PipeNode.Wait() - Waiting for server shutdown")
+	<-done
+	pipe.logger.Debugf("PipeNode.Wait() - exit")
 }
 
 func (pipe *pipeNode) GetOutputPipeChannel() chan<- model.PipeMessage {
@@ -374,5 +405,6 @@ func NewPipeNode(appName string, verbosity log.LogLevel) model.PipeNode {
 		logger: log.NewLogger(appName, verbosity),
 		requestsMutex: sync.Mutex{},
 		clientsMutex: sync.Mutex{},
+		stateMutex: sync.Mutex{},
 	}
 }
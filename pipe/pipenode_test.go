@@ -0,0 +1,91 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/pipe/builders"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// Starts an input Pipe Node on a free local port
+func startInputPipe(t *testing.T) (model.PipeNode, string) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var port = l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+	config, err := builders.NewPipeNodeConfigBuilder().WithInHost("", port).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	node, err := NewPipeNode("Test Pipe Node", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	testsuite.AssertNil(t, "Start error must be nil", node.Start())
+	node.UntilStarted()
+	return node, fmt.Sprintf("127.0.0.1:%v", port)
+}
+
+// Connects to the pipe node and sends a partial message, waiting for the connection to be accepted
+func sendPartialMessage(t *testing.T, address string) *net.TCPConn {
+	conn, err := net.Dial("tcp", address)
+	testsuite.AssertNil(t, "Dial error must be nil", err)
+	_, err = conn.Write([]byte("in-flight "))
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	time.Sleep(100 * time.Millisecond)
+	return conn.(*net.TCPConn)
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	// In-flight messages complete before the shutdown returns
+	node, address := startInputPipe(t)
+	var messages = make(chan model.PipeMessage, 1)
+	go func() {
+		for message := range node.GetInputPipeChannel() {
+			messages <- message
+		}
+	}()
+	conn := sendPartialMessage(t, address)
+	var result = make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go func() {
+		result <- node.Shutdown(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-result:
+		t.Fatal("Shutdown must wait for the in-flight messages")
+	default:
+	}
+	_, _ = conn.Write([]byte("message"))
+	_ = conn.CloseWrite()
+	select {
+	case err := <-result:
+		testsuite.AssertNil(t, "Shutdown error must be nil", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Shutdown must return once the in-flight messages are complete")
+	}
+	select {
+	case message := <-messages:
+		testsuite.AssertEquals(t, "In-flight message must be delivered", "in-flight message", string(message))
+	case <-time.After(2 * time.Second):
+		t.Fatal("In-flight message must be delivered")
+	}
+	_ = conn.Close()
+	testsuite.AssertEquals(t, "Pipe node must not be running after shutdown", false, node.Running())
+
+	// Remaining connections are closed at the deadline
+	node, address = startInputPipe(t)
+	conn = sendPartialMessage(t, address)
+	defer conn.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	testsuite.AssertEquals(t, "Shutdown must return the context error at the deadline", context.DeadlineExceeded, node.Shutdown(ctx))
+	testsuite.AssertEquals(t, "Shutdown must not wait the running messages", true, time.Since(start) < 2*time.Second)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err := ioutil.ReadAll(conn)
+	testsuite.AssertNil(t, "Remaining connections must be closed at the deadline", err)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	context2 "context"
 	"errors"
 	"fmt"
 	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
 	"github.com/hellgate75/go-network/model/context"
 	"github.com/hellgate75/go-network/model/encoding"
 	"github.com/hellgate75/go-network/tcp"
@@ -19,6 +21,7 @@ func TestTcpServer() {
 		NewTcpServerConfigBuilder().
 		WithNetwork("tcp").
 		WithEncoding(encoding.EncodingJSONFormat).
+		WithFraming(model.LengthPrefixedFraming, 0).
 		WithHost("", 9998).
 		Build()
 	if err != nil {
@@ -76,6 +79,7 @@ func TestTcpClient() {
 		WithHost("localhost", 9998).
 		WithNetwork("tcp").
 		WithEncoding(encoding.EncodingJSONFormat).
+		WithFraming(model.LengthPrefixedFraming, 0).
 		Build()
 	if err != nil {
 		panic(err)
@@ -93,6 +97,8 @@ func TestTcpClient() {
 	sample := sampleStruct()
 	time.Sleep(1 * time.Second)
 	logger.Infof("Request data: %v", sample)
-	err = tcpClient.Encode(&sample, &empty, 0 * time.Second)
+	ctx, cancel := context2.WithTimeout(context2.Background(), 5 * time.Second)
+	defer cancel()
+	err = tcpClient.Call(ctx, "read-sample-data", &sample, &empty)
 	logger.Infof("Response data: %+v", empty)
 }
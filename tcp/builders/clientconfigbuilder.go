@@ -8,6 +8,7 @@ import (
 	"github.com/hellgate75/go-network/model/encoding"
 	"golang.org/x/crypto/acme/autocert"
 	"io/ioutil"
+	"time"
 )
 
 // Helper for building a model.TcpClientConfig instance
@@ -18,8 +19,30 @@ type TcpClientConfigBuilder interface {
 	WithNetwork(network string) TcpClientConfigBuilder
 	// Associate a custom encoding than the default jason format -> responding to 'application/json' Mime type
 	WithEncoding(enc encoding.Encoding) TcpClientConfigBuilder
+	// Associate a message framing protocol than the default raw stream one, and the maximum frame payload
+	// size in bytes (0 means the stream.DefaultMaxFrameSize)
+	WithFraming(framing model.FramingMode, maxFrameSize uint32) TcpClientConfigBuilder
+	// Associate the server action of the requests sent with Send and Encode, it is required by
+	// the length-prefixed framing protocol and by the datagram client
+	WithAction(action string) TcpClientConfigBuilder
 	// Associate an host and a port to the builder workflow
 	WithHost(address string, port int) TcpClientConfigBuilder
+	// Set up the dial timeout, by default there is no timeout
+	WithDialTimeout(timeout time.Duration) TcpClientConfigBuilder
+	// Set up the TCP keep-alive probes period, by default the system one is used (negative values disable keep-alive)
+	WithKeepAlive(period time.Duration) TcpClientConfigBuilder
+	// Set up the heartbeat messages interval and the answer timeout (0 means the interval), it requires
+	// the length-prefixed framing protocol
+	WithHeartbeat(interval time.Duration, timeout time.Duration) TcpClientConfigBuilder
+	// Set up the automatic reconnection when the connection is lost, it requires the length-prefixed framing protocol
+	WithReconnect(policy model.ReconnectPolicy) TcpClientConfigBuilder
+	// Set up the listener notified of each connection state change
+	WithStateListener(listener model.ConnectionStateListener) TcpClientConfigBuilder
+	// Set up the connection pool properties, used by the Tcp Client pool
+	WithPool(pool model.TcpClientPoolConfig) TcpClientConfigBuilder
+	// Set up the function returning the frame sent on each new connection, before any request
+	// (eg.: an authentication token), it works with any framing protocol
+	WithHandshake(handshake func() ([]byte, error)) TcpClientConfigBuilder
 	// Associate certificate and key files full path to the builder workflow
 	WithTLSCerts(certificate string, key string) TcpClientConfigBuilder
 	// Add some more certificate files to the certificate list to the builder workflow
@@ -45,7 +68,8 @@ type TcpClientConfigBuilder interface {
 	WithClientSessionCache(cache tls.ClientSessionCache) TcpClientConfigBuilder
 	// Add more Cipher suites to the preset values : tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 	// tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-	// tls.TLS_RSA_WITH_AES_256_CBC_SHA
+	// tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	// tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
 	MoreCipherSuites(cipherSuite uint16) TcpClientConfigBuilder
 	// Add more Curve Ids to the current TLS Curve Preferences, adding to the preset values : tls.CurveP521, tls.CurveP384,
 	// tls.CurveP256
@@ -59,6 +83,9 @@ type TcpClientConfigBuilder interface {
 type tcpClientConfigBuilder struct{
 	useTls					 bool
 	network                  string
+	framing                  model.FramingMode
+	maxFrameSize             uint32
+	action                   string
 	enc                  	 encoding.Encoding
 	address                  string
 	port                     int
@@ -73,6 +100,14 @@ type tcpClientConfigBuilder struct{
 	renegotiation            tls.RenegotiationSupport
 	cache                    tls.ClientSessionCache
 	preferServerCipherSuites bool
+	dialTimeout              time.Duration
+	keepAlive                time.Duration
+	heartbeatInterval        time.Duration
+	heartbeatTimeout         time.Duration
+	reconnect                *model.ReconnectPolicy
+	stateListener            model.ConnectionStateListener
+	pool                     *model.TcpClientPoolConfig
+	handshake                func() ([]byte, error)
 }
 
 func (b *tcpClientConfigBuilder) UseTlsEncryption(use bool) TcpClientConfigBuilder {
@@ -91,11 +126,58 @@ func (b *tcpClientConfigBuilder) WithHost(address string, port int) TcpClientCon
 	return b
 }
 
+func (b *tcpClientConfigBuilder) WithDialTimeout(timeout time.Duration) TcpClientConfigBuilder {
+	b.dialTimeout = timeout
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithKeepAlive(period time.Duration) TcpClientConfigBuilder {
+	b.keepAlive = period
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithHeartbeat(interval time.Duration, timeout time.Duration) TcpClientConfigBuilder {
+	b.heartbeatInterval = interval
+	b.heartbeatTimeout = timeout
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithReconnect(policy model.ReconnectPolicy) TcpClientConfigBuilder {
+	b.reconnect = &policy
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithStateListener(listener model.ConnectionStateListener) TcpClientConfigBuilder {
+	b.stateListener = listener
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithHandshake(handshake func() ([]byte, error)) TcpClientConfigBuilder {
+	b.handshake = handshake
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithPool(pool model.TcpClientPoolConfig) TcpClientConfigBuilder {
+	b.pool = &pool
+	return b
+}
+
 func (b *tcpClientConfigBuilder) WithEncoding(enc encoding.Encoding) TcpClientConfigBuilder {
 	b.enc=enc
 	return b
 }
 
+func (b *tcpClientConfigBuilder) WithFraming(framing model.FramingMode, maxFrameSize uint32) TcpClientConfigBuilder {
+	b.framing = framing
+	b.maxFrameSize = maxFrameSize
+	return b
+}
+
+func (b *tcpClientConfigBuilder) WithAction(action string) TcpClientConfigBuilder {
+	b.action = action
+	return b
+}
+
 func (b *tcpClientConfigBuilder) WithTLSCerts(certificate string, key string) TcpClientConfigBuilder {
 	cert, err := tls.LoadX509KeyPair(certificate, key)
 	if err == nil {
@@ -114,7 +196,7 @@ func (b *tcpClientConfigBuilder) MoreTLSCerts(certificate string, key string) Tc
 
 func (b *tcpClientConfigBuilder) WithRootCaCert(certificate string) TcpClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -125,7 +207,7 @@ func (b *tcpClientConfigBuilder) WithRootCaCert(certificate string) TcpClientCon
 
 func (b *tcpClientConfigBuilder) WithClientCaCert(certificate string) TcpClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -136,7 +218,7 @@ func (b *tcpClientConfigBuilder) WithClientCaCert(certificate string) TcpClientC
 
 func (b *tcpClientConfigBuilder) MoreClientCaCerts(certificate string) TcpClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -147,7 +229,7 @@ func (b *tcpClientConfigBuilder) MoreClientCaCerts(certificate string) TcpClient
 
 func (b *tcpClientConfigBuilder) MoreRootCaCerts(certificate string) TcpClientConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -227,6 +309,17 @@ func (b *tcpClientConfigBuilder) Build() (model.TcpClientConfig, error) {
 		Port: b.port,
 		Network: b.network,
 		Encoding: b.enc,
+		Framing: b.framing,
+		MaxFrameSize: b.maxFrameSize,
+		Action: b.action,
+		DialTimeout: b.dialTimeout,
+		KeepAlive: b.keepAlive,
+		HeartbeatInterval: b.heartbeatInterval,
+		HeartbeatTimeout: b.heartbeatTimeout,
+		Reconnect: b.reconnect,
+		OnStateChange: b.stateListener,
+		Pool: b.pool,
+		Handshake: b.handshake,
 		Config: tlsConfig,
 	}, err
 }
@@ -241,6 +334,9 @@ func NewTcpClientConfigBuilder() TcpClientConfigBuilder {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 		},
 		curvePref: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
 		minVersion: tls.VersionTLS12,
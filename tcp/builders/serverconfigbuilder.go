@@ -4,10 +4,12 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"github.com/hellgate75/go-network/common"
 	"github.com/hellgate75/go-network/model"
 	"github.com/hellgate75/go-network/model/encoding"
 	"golang.org/x/crypto/acme/autocert"
 	"io/ioutil"
+	"os"
 )
 
 // Helper for building a model.TcpServerConfig instance
@@ -18,8 +20,14 @@ type TcpServerConfigBuilder interface {
 	WithNetwork(network string) TcpServerConfigBuilder
 	// Associate a custom encoding than the default jason format -> responding to 'application/json' Mime type
 	WithEncoding(enc encoding.Encoding) TcpServerConfigBuilder
-	// Associate an host and a port to the builder workflow
+	// Associate a message framing protocol than the default raw stream one, and the maximum frame payload
+	// size in bytes (0 means the stream.DefaultMaxFrameSize)
+	WithFraming(framing model.FramingMode, maxFrameSize uint32) TcpServerConfigBuilder
+	// Associate an host and a port to the builder workflow, for unix sockets the host is the socket file path
+	// and the port must be 0
 	WithHost(address string, port int) TcpServerConfigBuilder
+	// Set up the permissions of the unix socket file, by default they depend on the process umask
+	WithSocketMode(mode os.FileMode) TcpServerConfigBuilder
 	// Add a certificate files to the certificate list to the builder workflow
 	WithTLSCerts(certificate string, key string) TcpServerConfigBuilder
 	// Add some more certificate files to the certificate list to the builder workflow
@@ -28,8 +36,14 @@ type TcpServerConfigBuilder interface {
 	WithRootCaCert(certificate string) TcpServerConfigBuilder
 	// Add one client CA certificate files to the certificate list to the builder workflow
 	WithClientCaCert(certificate string) TcpServerConfigBuilder
+	// Set up the client certificates request and verification policy, by default the client certificates
+	// are required and verified when any client CA certificate is set up, otherwise they are not requested
+	WithClientAuth(clientAuth tls.ClientAuthType) TcpServerConfigBuilder
 	// Set up the certificate manager for the auto-scan of certificates for a folder
 	WithCertificateManager(dir string) TcpServerConfigBuilder
+	// Set up the source of the server certificates, reloaded when their files change and selected by the client
+	// requested server name (SNI), in place of the TLS certificates and the certificate manager, it enables the Tls encryption
+	WithCertificateSource(source *common.CertificateSource) TcpServerConfigBuilder
 	// Add more root CA certificate files to the certificate list to the builder workflow
 	MoreClientCaCerts(certificate string) TcpServerConfigBuilder
 	// Add more client CA certificate files to the certificate list to the builder workflow
@@ -44,7 +58,8 @@ type TcpServerConfigBuilder interface {
 	WithClientSessionCache(cache tls.ClientSessionCache) TcpServerConfigBuilder
 	// Add more Cipher suites to the preset values : tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 	// tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-	// tls.TLS_RSA_WITH_AES_256_CBC_SHA
+	// tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	// tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
 	MoreCipherSuites(cipherSuite uint16) TcpServerConfigBuilder
 	// Add more Curve Ids to the current TLS Curve Preferences, adding to the preset values : tls.CurveP521, tls.CurveP384,
 	// tls.CurveP256
@@ -60,6 +75,9 @@ type serverConfigBuilder struct{
 	address      				string
 	port         				int
 	network  					string
+	framing						model.FramingMode
+	maxFrameSize				uint32
+	socketMode					os.FileMode
 	enc							encoding.Encoding
 	caPool       				*x509.CertPool
 	rootCaPool   				*x509.CertPool
@@ -72,6 +90,8 @@ type serverConfigBuilder struct{
 	renegotiation 				tls.RenegotiationSupport
 	cache						tls.ClientSessionCache
 	preferServerCipherSuites 	bool
+	clientAuth					*tls.ClientAuthType
+	certSource					*common.CertificateSource
 }
 
 func (b *serverConfigBuilder) UseTlsEncryption(use bool) TcpServerConfigBuilder {
@@ -84,6 +104,11 @@ func (b *serverConfigBuilder) WithNetwork(network string) TcpServerConfigBuilder
 	return b
 }
 
+func (b *serverConfigBuilder) WithSocketMode(mode os.FileMode) TcpServerConfigBuilder {
+	b.socketMode = mode
+	return b
+}
+
 func (b *serverConfigBuilder) WithHost(address string, port int) TcpServerConfigBuilder {
 	b.address = address
 	b.port = port
@@ -95,6 +120,12 @@ func (b *serverConfigBuilder) WithEncoding(enc encoding.Encoding) TcpServerConfi
 	return b
 }
 
+func (b *serverConfigBuilder) WithFraming(framing model.FramingMode, maxFrameSize uint32) TcpServerConfigBuilder {
+	b.framing = framing
+	b.maxFrameSize = maxFrameSize
+	return b
+}
+
 func (b *serverConfigBuilder) WithTLSCerts(certificate string, key string) TcpServerConfigBuilder {
 	cert, err := tls.LoadX509KeyPair(certificate, key)
 	if err == nil {
@@ -113,7 +144,7 @@ func (b *serverConfigBuilder) MoreTLSCerts(certificate string, key string) TcpSe
 
 func (b *serverConfigBuilder) WithRootCaCert(certificate string) TcpServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -124,7 +155,7 @@ func (b *serverConfigBuilder) WithRootCaCert(certificate string) TcpServerConfig
 
 func (b *serverConfigBuilder) WithClientCaCert(certificate string) TcpServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -135,7 +166,7 @@ func (b *serverConfigBuilder) WithClientCaCert(certificate string) TcpServerConf
 
 func (b *serverConfigBuilder) MoreClientCaCerts(certificate string) TcpServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.caPool == nil {
 			b.caPool = x509.NewCertPool()
 		}
@@ -146,7 +177,7 @@ func (b *serverConfigBuilder) MoreClientCaCerts(certificate string) TcpServerCon
 
 func (b *serverConfigBuilder) MoreRootCaCerts(certificate string) TcpServerConfigBuilder {
 	caCert, err := ioutil.ReadFile(certificate)
-	if err != nil {
+	if err == nil {
 		if b.rootCaPool == nil {
 			b.rootCaPool = x509.NewCertPool()
 		}
@@ -155,6 +186,17 @@ func (b *serverConfigBuilder) MoreRootCaCerts(certificate string) TcpServerConfi
 	return b
 }
 
+func (b *serverConfigBuilder) WithClientAuth(clientAuth tls.ClientAuthType) TcpServerConfigBuilder {
+	b.clientAuth = &clientAuth
+	return b
+}
+
+func (b *serverConfigBuilder) WithCertificateSource(source *common.CertificateSource) TcpServerConfigBuilder {
+	b.certSource = source
+	b.useTls = true
+	return b
+}
+
 func (b *serverConfigBuilder) WithCertificateManager(dir string) TcpServerConfigBuilder {
 	b.certManager = &autocert.Manager{
 		Prompt: autocert.AcceptTOS,
@@ -204,10 +246,17 @@ func (b *serverConfigBuilder) Build() (model.TcpServerConfig, error) {
 	if b.certManager != nil {
 		getCert = b.certManager.GetCertificate
 	}
+	var clientAuth = tls.NoClientCert
+	if b.clientAuth != nil {
+		clientAuth = *b.clientAuth
+	} else if b.caPool != nil {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
 	var tlsConfig *tls.Config
 	if b.useTls {
 		tlsConfig = &tls.Config{
 			ClientCAs: b.caPool,
+			ClientAuth: clientAuth,
 			Certificates: b.certificates,
 			CipherSuites: b.cipherSuits,
 			InsecureSkipVerify: b.insecure,
@@ -221,11 +270,17 @@ func (b *serverConfigBuilder) Build() (model.TcpServerConfig, error) {
 			Renegotiation: b.renegotiation,
 		}
 	}
+	if tlsConfig != nil && b.certSource != nil {
+		b.certSource.ApplyTo(tlsConfig)
+	}
 	return model.TcpServerConfig{
 		Host: b.address,
 		Port: b.port,
 		Encoding: b.enc,
 		Network: b.network,
+		Framing: b.framing,
+		MaxFrameSize: b.maxFrameSize,
+		SocketMode: b.socketMode,
 		Config: tlsConfig,
 	}, err
 }
@@ -240,6 +295,9 @@ func NewTcpServerConfigBuilder() TcpServerConfigBuilder {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 		},
 		curvePref: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
 		minVersion: tls.VersionTLS12,
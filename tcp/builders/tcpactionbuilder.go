@@ -41,9 +41,13 @@ type tcpAction struct{
 func (action *tcpAction) GetName() string {
 	return action.name
 }
+// Returns a copy of the action bound to the given context, so the same action can serve concurrent requests
 func (action *tcpAction) With(context context.TcpContext) model.TcpAction {
-	action.context = &context
-	return action
+	return &tcpAction{
+		function: action.function,
+		context: &context,
+		name: action.name,
+	}
 }
 
 func (action *tcpAction) Do() error {
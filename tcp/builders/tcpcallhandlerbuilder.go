@@ -19,6 +19,9 @@ type TcpCallHandlerBuilder interface {
 	WithTcpHandling(action model.TcpAction) TcpCallHandlerBuilder
 	// Associate an error channel, for creating a flow of errors from the request
 	WithErrorChannel(ch chan error) TcpCallHandlerBuilder
+	// Add interceptors applied to all the actions of the handler, in the given order.
+	// Handler interceptors run after the server interceptors, just around the action function
+	WithInterceptor(interceptors ...model.TcpInterceptor) TcpCallHandlerBuilder
 	// Build the model.TcpCallHandler and report any error occurred during the build process
 	Build() (model.TcpCallHandler, error)
 }
@@ -29,6 +32,7 @@ type tcpCallHandlerBuilder struct {
 	actions       []model.TcpAction
 	errorHandling bool
 	errCh         chan error
+	interceptors  []model.TcpInterceptor
 }
 
 func (b *tcpCallHandlerBuilder) WithName(name string) TcpCallHandlerBuilder {
@@ -47,6 +51,15 @@ func (b *tcpCallHandlerBuilder) WithErrorChannel(ch chan error) TcpCallHandlerBu
 	return b
 }
 
+func (b *tcpCallHandlerBuilder) WithInterceptor(interceptors ...model.TcpInterceptor) TcpCallHandlerBuilder {
+	for _, i := range interceptors {
+		if i != nil {
+			b.interceptors = append(b.interceptors, i)
+		}
+	}
+	return b
+}
+
 func (b *tcpCallHandlerBuilder) Build() (model.TcpCallHandler, error) {
 	var err error
 	if len(b.name) == 0 {
@@ -62,6 +75,7 @@ func (b *tcpCallHandlerBuilder) Build() (model.TcpCallHandler, error) {
 		errCh:         b.errCh,
 		errorHandling: b.errorHandling,
 		handlerMap:    make(map[string]interface{}),
+		interceptors:  append(make([]model.TcpInterceptor, 0), b.interceptors...),
 	}, err
 }
 
@@ -75,6 +89,8 @@ type  tcpCallHandler struct {
 	handlerMap    map[string]interface{}
 	serverMap     *map[string]interface{}
 	encoding	  encoding.Encoding
+	interceptors  []model.TcpInterceptor
+	serverInterceptors *[]model.TcpInterceptor
 	logger        log.Logger
 }
 
@@ -91,20 +107,42 @@ func (h *tcpCallHandler) HandleRequest(conn net.Conn, closer stream.ConnReaderWr
 	h.logger.Debugf("Running handler %s, waiting for data read ...", h.name)
 	closer.Wait()
 	h.logger.Debugf("Running handler %s, data has been read", h.name)
+	var name = closer.Action()
 	for _, action := range h.actions {
-		context := context2.NewTcpContext(conn, closer, h.encoding)
+		if name != "" && action.GetName() != name {
+			// Named requests are routed to the matching action only
+			continue
+		}
+		context := context2.NewTcpContext(conn, closer, h.encoding).WithContext(closer.Context())
 		// Set up reference to handler map cache element
+		if closer.IsFramed() {
+			// Responses must be sent back as frames, carrying the request message identifier
+			context.Id = closer.MessageId()
+			context.ResponseWriter = closer
+		}
 		context.HandlerMap = &h.handlerMap
 		context.Logger = h.logger
 		// Set up reference to Tcp  global server map cache element
 		context.ServerMap = h.serverMap
-		err := action.With(context).Do()
+		err := h.chain(action)(context)
 		if err != nil && h.errorHandling {
 			h.errCh <- err
 		}
 	}
 }
 
+// Composes server and handler interceptors around the given action execution
+func (h *tcpCallHandler) chain(action model.TcpAction) model.TcpActionFunction {
+	var interceptors = make([]model.TcpInterceptor, 0)
+	if h.serverInterceptors != nil {
+		interceptors = append(interceptors, (*h.serverInterceptors)...)
+	}
+	interceptors = append(interceptors, h.interceptors...)
+	return model.ChainTcpInterceptors(func(c context2.TcpContext) error {
+		return action.With(c).Do()
+	}, interceptors...)
+}
+
 func (h *tcpCallHandler) SetLogger(logger log.Logger) {
 	h.logger = logger
 }
@@ -115,10 +153,14 @@ func (h *tcpCallHandler) SetServerMap(m *map[string]interface{}) {
 func (h *tcpCallHandler) SetEncoding(enc encoding.Encoding) {
 	h.encoding = enc
 }
+func (h *tcpCallHandler) SetInterceptors(interceptors *[]model.TcpInterceptor) {
+	h.serverInterceptors = interceptors
+}
 func NewTcpCallHandlerBuilder() TcpCallHandlerBuilder {
 	return &tcpCallHandlerBuilder{
 		names: make([]string, 0),
 		actions: make([]model.TcpAction, 0),
+		interceptors: make([]model.TcpInterceptor, 0),
 	}
 }
 
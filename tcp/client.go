@@ -1,27 +1,43 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	io2 "github.com/hellgate75/go-network/io"
 	"github.com/hellgate75/go-network/log"
 	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/stream"
 	"io"
 	"io/ioutil"
 	"net"
+	"sync"
 	"time"
 )
 
+var (
+	// Size of the queue of received messages not related to any pending call, available via ReadRemote
+	ClientUnsolicitedQueueSize = 64
+)
+
 type tcpClient struct{
+	sync.Mutex
 	config 			*model.TcpClientConfig
 	cli				net.Conn
+	frames			stream.FrameReaderWriter
+	pending			map[string]chan stream.Message
+	unsolicited		chan stream.Message
+	readErr			error
+	state			model.ConnectionState
+	closed			bool
+	done			chan struct{}
 	logger			log.Logger
 }
 
 func (c *tcpClient) Connect(config model.TcpClientConfig) error {
 	var err error
-	var conn net.Conn
 	defer func() {
 		if r := recover(); r != nil {
 			err = errors.New(fmt.Sprintf("TcpClient.Connect() - Error: %v", r))
@@ -35,48 +51,471 @@ func (c *tcpClient) Connect(config model.TcpClientConfig) error {
 		}
 
 	}
-	c.config = &config
-	if c.config.Network == "" {
+	if config.Network == "" {
 		c.logger.Error("Invalid network value")
 		return errors.New(fmt.Sprint("Invalid network, server and/or port values"))
 	}
+	if isDatagramNetwork(config.Network) {
+		c.logger.Errorf("TcpClient.Connect() - Error: Datagram network %s requires the datagram client", config.Network)
+		return errors.New(fmt.Sprintf("TcpClient.Connect() - Error: Datagram network %s requires the datagram client", config.Network))
+	}
+	c.Lock()
+	c.config = &config
+	c.closed = false
+	c.done = make(chan struct{})
+	c.Unlock()
+	c.setState(model.Connecting)
+	conn, err := c.dial()
+	if err != nil {
+		c.logger.Error(err)
+		c.setState(model.Disconnected)
+		return err
+	}
+	c.attach(conn)
+	return err
+}
+
+// Dials the remote server, using the configured dial timeout and keep-alive period, and sends the handshake frame
+func (c *tcpClient) dial() (net.Conn, error) {
+	conn, err := c.dialConn()
+	if err != nil || c.config.Handshake == nil {
+		return conn, err
+	}
+	frame, err := c.config.Handshake()
+	if err == nil {
+		err = stream.WriteFrame(conn, frame, c.config.MaxFrameSize)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.New(fmt.Sprintf("TcpClient.dial() - Handshake error: %v", err))
+	}
+	return conn, nil
+}
+
+func (c *tcpClient) dialConn() (net.Conn, error) {
 	address := fmt.Sprintf("%s:%v", c.config.Host, c.config.Port)
 	if c.config.Port <= 0 {
 		address = fmt.Sprintf("%s", c.config.Host)
 	}
-
-	if config.Config == nil {
+	var dialer = &net.Dialer{
+		Timeout:   c.config.DialTimeout,
+		KeepAlive: c.config.KeepAlive,
+	}
+	if c.config.Config == nil {
 		// Plain connection
-		conn, err = net.Dial(config.Network, address)
-	} else {
-		// SSL/TLS Encryption
-		conn, err = tls.Dial(config.Network, address, config.Config)
+		return dialer.Dial(c.config.Network, address)
 	}
-	if err == nil {
-		if c.config.Timeout > 0 {
-			err = conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	// SSL/TLS Encryption
+	return tls.DialWithDialer(dialer, c.config.Network, address, c.config.Config)
+}
+
+// Makes the given connection the current one, starting the message reader and the heartbeat in framed mode
+func (c *tcpClient) attach(conn net.Conn) {
+	c.Lock()
+	c.cli = conn
+	c.frames = nil
+	c.readErr = nil
+	if c.config.Framing == model.LengthPrefixedFraming {
+		c.frames = stream.NewLengthPrefixedFrameReaderWriter(conn, c.config.MaxFrameSize)
+		c.pending = make(map[string]chan stream.Message)
+		c.unsolicited = make(chan stream.Message, ClientUnsolicitedQueueSize)
+		go c.readMessages(conn, c.frames, c.unsolicited)
+		if c.config.HeartbeatInterval > 0 {
+			go c.heartbeat(conn, c.frames, c.done)
 		}
-		c.cli = conn
-	} else {
-		c.logger.Error(err)
 	}
-	return err
+	c.Unlock()
+	c.setState(model.Connected)
+}
+
+// Changes the connection state, notifying the state listener
+func (c *tcpClient) setState(state model.ConnectionState) {
+	c.Lock()
+	var previous = c.state
+	c.state = state
+	var listener model.ConnectionStateListener
+	if c.config != nil {
+		listener = c.config.OnStateChange
+	}
+	c.Unlock()
+	if listener != nil && previous != state {
+		listener(previous, state)
+	}
+}
+
+func (c *tcpClient) State() model.ConnectionState {
+	defer c.Unlock()
+	c.Lock()
+	return c.state
 }
 
 func (c *tcpClient) IsOpen() bool {
+	defer c.Unlock()
+	c.Lock()
 	return c.cli != nil
 }
 
 func (c *tcpClient) Close() error {
-	if c.cli == nil {
+	c.Lock()
+	var conn = c.cli
+	if !c.closed && c.done != nil {
+		close(c.done)
+	}
+	c.closed = true
+	c.cli = nil
+	c.Unlock()
+	if conn == nil {
+		c.setState(model.Closed)
 		c.logger.Error("Connection is already closed ...")
 		return errors.New(fmt.Sprint("Connection is already closed ..."))
 	}
-	return c.cli.Close()
+	err := conn.Close()
+	c.setState(model.Closed)
+	return err
+}
+
+// Sends heartbeat messages on the given connection at the configured interval, the connection is closed when
+// an answer does not arrive within the heartbeat timeout, so half-open connections are detected
+func (c *tcpClient) heartbeat(conn net.Conn, frames stream.FrameReaderWriter, done chan struct{}) {
+	var timeout = c.config.HeartbeatTimeout
+	if timeout <= 0 {
+		timeout = c.config.HeartbeatInterval
+	}
+	var ticker = time.NewTicker(c.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		var id = context2.GenerateUUUID()
+		var ch = c.registerCall(conn, id)
+		if ch == nil {
+			return
+		}
+		frame, err := stream.EncodeMessage(stream.Message{
+			Type: stream.PingMessage,
+			Id:   id,
+		})
+		if err == nil {
+			err = frames.WriteFrame(frame)
+		}
+		if err == nil {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			case <-time.After(timeout):
+				err = errors.New(fmt.Sprintf("No heartbeat answer within: %v", timeout))
+			case <-done:
+				c.deregisterCall(id)
+				return
+			}
+		}
+		c.deregisterCall(id)
+		if err != nil {
+			c.logger.Warnf("TcpClient.heartbeat() - Connection with %+v lost - Error: %v", conn.RemoteAddr(), err)
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// Connects again to the server after a connection loss, following the reconnection policy
+func (c *tcpClient) reconnect(done chan struct{}) {
+	var policy = c.config.Reconnect
+	var multiplier = policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	var wait = policy.InitialBackoff
+	c.setState(model.Reconnecting)
+	for attempt := 1; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return
+		}
+		c.logger.Debugf("TcpClient.reconnect() - Reconnection attempt %v ...", attempt)
+		conn, err := c.dial()
+		if err == nil {
+			c.Lock()
+			var closed = c.closed
+			c.Unlock()
+			if closed {
+				_ = conn.Close()
+				return
+			}
+			c.attach(conn)
+			return
+		}
+		c.logger.Warnf("TcpClient.reconnect() - Reconnection attempt %v - Error: %v", attempt, err)
+		wait = time.Duration(float64(wait) * multiplier)
+		if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+	}
+	c.logger.Errorf("TcpClient.reconnect() - Reconnection failed after %v attempts", policy.MaxAttempts)
+	c.setState(model.Disconnected)
+}
+
+// Reads the response messages from the connection and delivers them to the related pending calls.
+// Messages not related to any pending call are queued for ReadRemote.
+// When the connection is lost the client connects again, if a reconnection policy is configured.
+func (c *tcpClient) readMessages(conn net.Conn, frames stream.FrameReaderWriter, unsolicited chan stream.Message) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpClient.readMessages() - Error: %v", r))
+		}
+		c.Lock()
+		var current = c.frames == frames
+		var lost = current && !c.closed
+		if current {
+			c.readErr = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.pending = nil
+			c.frames = nil
+			c.cli = nil
+		}
+		var done = c.done
+		c.Unlock()
+		close(unsolicited)
+		if lost {
+			_ = conn.Close()
+			if c.config.Reconnect != nil {
+				go c.reconnect(done)
+			} else {
+				c.setState(model.Disconnected)
+			}
+		}
+	}()
+	for {
+		var frame []byte
+		frame, err = frames.ReadFrame()
+		if err != nil {
+			return
+		}
+		var msg stream.Message
+		msg, err = stream.DecodeMessage(frame)
+		if err != nil {
+			c.logger.Errorf("TcpClient.readMessages() - Decoding message - Error: %v", err)
+			return
+		}
+		c.Lock()
+		ch, ok := c.pending[msg.Id]
+		if ok {
+			delete(c.pending, msg.Id)
+		}
+		c.Unlock()
+		if ok {
+			ch <- msg
+			continue
+		}
+		select {
+		case unsolicited <- msg:
+		default:
+			c.logger.Warnf("TcpClient.readMessages() - Queue is full, discarding message: %s", msg.Id)
+		}
+	}
+}
+
+// Returns the current connection
+func (c *tcpClient) connection() net.Conn {
+	defer c.Unlock()
+	c.Lock()
+	return c.cli
+}
+
+// Returns the queue of the messages not related to any call received on the current connection
+func (c *tcpClient) unsolicitedMessages() chan stream.Message {
+	defer c.Unlock()
+	c.Lock()
+	return c.unsolicited
+}
+
+// Registers a pending call on the given connection, it returns nil when the connection is not the current one
+func (c *tcpClient) registerCall(conn net.Conn, id string) chan stream.Message {
+	defer c.Unlock()
+	c.Lock()
+	if c.pending == nil || c.cli != conn {
+		return nil
+	}
+	var ch = make(chan stream.Message, 1)
+	c.pending[id] = ch
+	return ch
 }
+
+func (c *tcpClient) deregisterCall(id string) {
+	defer c.Unlock()
+	c.Lock()
+	delete(c.pending, id)
+}
+
+func (c *tcpClient) connectionError() error {
+	defer c.Unlock()
+	c.Lock()
+	if c.readErr != nil && c.readErr != io.EOF {
+		return errors.New(fmt.Sprintf("Connection lost: %v", c.readErr))
+	}
+	return errors.New(fmt.Sprint("Connection closed by the server"))
+}
+
+// Sends a request message for the given action tagged with a new unique identifier, and waits for the response
+// message carrying the same identifier or for the context is done
+func (c *tcpClient) roundTrip(ctx context.Context, action string, data []byte, response interface{}) error {
+	var id = context2.GenerateUUUID()
+	c.Lock()
+	var conn, frames = c.cli, c.frames
+	c.Unlock()
+	if frames == nil {
+		return c.connectionError()
+	}
+	var ch chan stream.Message
+	if response != nil {
+		ch = c.registerCall(conn, id)
+		if ch == nil {
+			return c.connectionError()
+		}
+		defer c.deregisterCall(id)
+	}
+	frame, err := stream.EncodeMessage(stream.Message{
+		Type:   stream.RequestMessage,
+		Id:     id,
+		Action: action,
+		Body:   data,
+	})
+	if err != nil {
+		return err
+	}
+	err = frames.WriteFrame(frame)
+	if err != nil || response == nil {
+		return err
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return c.connectionError()
+		}
+		if msg.Type == stream.ErrorMessage {
+			return &model.TcpError{
+				Code:    model.TcpErrorCode(msg.Code),
+				Action:  msg.Action,
+				Message: string(msg.Body),
+			}
+		}
+		return io2.Unmarshal(msg.Body, c.config.Encoding, response)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sends the framed request data to the configured client action, framed servers answer the requests
+// with no action name with the unknown action error
+func (c *tcpClient) sendAction(ctx context.Context, data []byte, response interface{}) error {
+	if c.config.Action == "" {
+		c.logger.Error("Framed requests require the client action, or the Call method")
+		return errors.New(fmt.Sprint("Framed requests require the client action, or the Call method"))
+	}
+	return c.roundTrip(ctx, c.config.Action, data, response)
+}
+
+// Sends the request data, using framed messages when available
+func (c *tcpClient) sendAndRead(data []byte, response interface{}, timeout time.Duration) error {
+	if c.config.Framing == model.LengthPrefixedFraming {
+		var ctx = context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return c.sendAction(ctx, data, response)
+	}
+	var conn = c.connection()
+	if c.config.Timeout > 0 {
+		// Raw mode calls must complete within the connection timeout
+		_ = conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	}
+	_, err := conn.Write(data)
+	if err != nil {
+		return err
+	}
+	c.logger.Debug("Waiting server received the request...")
+	time.Sleep(timeout)
+	if response != nil {
+		c.logger.Debug("Reading for answer...")
+		err =  c.readParseInput(response)
+		if err != nil {
+			c.logger.Error(err)
+		}
+	}
+	return err
+}
+
+// Sends the request data bound to the given context, using framed messages when available.
+// In raw mode the response read is interrupted when the context is done.
+func (c *tcpClient) sendAndReadContext(ctx context.Context, data []byte, response interface{}) error {
+	if c.config.Framing == model.LengthPrefixedFraming {
+		return c.sendAction(ctx, data, response)
+	}
+	var stop = c.bindContext(ctx)
+	defer stop()
+	_, err := c.connection().Write(data)
+	if err != nil {
+		return c.contextError(ctx, err)
+	}
+	if response != nil {
+		c.logger.Debug("Reading for answer...")
+		err = c.readParseInput(response)
+		if err != nil {
+			c.logger.Error(err)
+			return c.contextError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// Binds the raw connection deadline to the given context: the connection deadline is set to the context one,
+// and it is forced when the context is cancelled. The returned function releases the binding.
+func (c *tcpClient) bindContext(ctx context.Context) func() {
+	var conn = c.connection()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	var done = make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		var deadline time.Time
+		if c.config.Timeout > 0 {
+			deadline = time.Now().Add(c.config.Timeout)
+		}
+		_ = conn.SetDeadline(deadline)
+	}
+}
+
+// Reports the context error in place of the given one, when the context is done
+func (c *tcpClient) contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 func (c *tcpClient) readParseInput(response interface{}) error {
 	if response != nil {
-		data, err := ioutil.ReadAll(c.cli)
+		data, err := ioutil.ReadAll(c.connection())
 		if err != nil {
 			return err
 		}
@@ -96,7 +535,7 @@ func (c *tcpClient) Send(body io.Reader, response interface{}, timeout time.Dura
 			c.logger.Fatal(err)
 		}
 	}()
-	if c.cli == nil {
+	if !c.IsOpen() {
 		c.logger.Error("Client is not connected to a server socket")
 		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
 	}
@@ -105,31 +544,61 @@ func (c *tcpClient) Send(body io.Reader, response interface{}, timeout time.Dura
 		return err
 	}
 	c.logger.Debug("Sending data to client ...")
-	_, err = c.cli.Write(data)
+	err = c.sendAndRead(data, response, timeout)
+	return err
+}
+
+func (c *tcpClient) Encode(request interface{}, response interface{}, timeout time.Duration) error {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpClient.Encode() - Error: %v", r))
+			c.logger.Fatal(err)
+		}
+	}()
+	if !c.IsOpen() {
+		c.logger.Error("Client is not connected to a server socket")
+		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	var data []byte
+	data, err = io2.Marshal(c.config.Encoding, request)
 	if err != nil {
 		return err
 	}
-	c.logger.Debug("Waiting server received the request...")
-	time.Sleep(timeout)
-	if response != nil {
-		c.logger.Debug("Reading for answer...")
-		err =  c.readParseInput(response)
-		if err != nil {
-			c.logger.Error(err)
+	err = c.sendAndRead(data, response, timeout)
+	return err
+}
+
+func (c *tcpClient) SendContext(ctx context.Context, body io.Reader, response interface{}) error {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpClient.SendContext() - Error: %v", r))
+			c.logger.Fatal(err)
 		}
+	}()
+	if !c.IsOpen() {
+		c.logger.Error("Client is not connected to a server socket")
+		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
 	}
+	c.logger.Debug("Sending data to client ...")
+	err = c.sendAndReadContext(ctx, data, response)
 	return err
 }
 
-func (c *tcpClient) Encode(request interface{}, response interface{}, timeout time.Duration) error {
+func (c *tcpClient) EncodeContext(ctx context.Context, request interface{}, response interface{}) error {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("TcpClient.Encode() - Error: %v", r))
+			err = errors.New(fmt.Sprintf("TcpClient.EncodeContext() - Error: %v", r))
 			c.logger.Fatal(err)
 		}
 	}()
-	if c.cli == nil {
+	if !c.IsOpen() {
 		c.logger.Error("Client is not connected to a server socket")
 		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
 	}
@@ -138,19 +607,32 @@ func (c *tcpClient) Encode(request interface{}, response interface{}, timeout ti
 	if err != nil {
 		return err
 	}
-	_, err = c.cli.Write(data)
+	err = c.sendAndReadContext(ctx, data, response)
+	return err
+}
+
+func (c *tcpClient) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpClient.Call() - Error: %v", r))
+			c.logger.Fatal(err)
+		}
+	}()
+	if !c.IsOpen() {
+		c.logger.Error("Client is not connected to a server socket")
+		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	if c.config.Framing != model.LengthPrefixedFraming {
+		c.logger.Error("Client calls require the length-prefixed framing protocol")
+		return errors.New(fmt.Sprint("Client calls require the length-prefixed framing protocol"))
+	}
+	var data []byte
+	data, err = io2.Marshal(c.config.Encoding, request)
 	if err != nil {
 		return err
 	}
-	c.logger.Debug("Waiting server received the request...")
-	time.Sleep(timeout)
-	if response != nil {
-		c.logger.Debug("Reading for answer...")
-		err =  c.readParseInput(response)
-		if err != nil {
-			c.logger.Error(err)
-		}
-	}
+	err = c.roundTrip(ctx, action, data, response)
 	return err
 }
 func (c *tcpClient) ReadRemote(timeout time.Duration, response interface{}) error {
@@ -161,11 +643,26 @@ func (c *tcpClient) ReadRemote(timeout time.Duration, response interface{}) erro
 			c.logger.Fatal(err)
 		}
 	}()
-	if c.cli == nil {
+	if !c.IsOpen() {
 		c.logger.Error("Client is not connected to a server socket")
 		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
 	}
-	if response != nil {
+	if response != nil && c.config.Framing == model.LengthPrefixedFraming {
+		// Framed mode: a single message not related to any call is expected within the timeout
+		var timeoutCh <-chan time.Time
+		if timeout > 0 {
+			timeoutCh = time.After(timeout)
+		}
+		select {
+		case msg, ok := <-c.unsolicitedMessages():
+			if !ok {
+				return c.connectionError()
+			}
+			err = io2.Unmarshal(msg.Body, c.config.Encoding, response)
+		case <-timeoutCh:
+			err = errors.New(fmt.Sprintf("No message received within: %v", timeout))
+		}
+	} else if response != nil {
 		var start = time.Now()
 	readCycle:
 		for timeout == 0 || time.Now().Sub(start) < timeout {
@@ -181,6 +678,43 @@ func (c *tcpClient) ReadRemote(timeout time.Duration, response interface{}) erro
 	return err
 }
 
+func (c *tcpClient) ReadRemoteContext(ctx context.Context, response interface{}) error {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpClient.ReadRemoteContext() - Error: %v", r))
+			c.logger.Fatal(err)
+		}
+	}()
+	if !c.IsOpen() {
+		c.logger.Error("Client is not connected to a server socket")
+		return errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	if response == nil {
+		return errors.New(fmt.Sprint("Nil response interface, cannot parse the remote connection stream"))
+	}
+	if c.config.Framing == model.LengthPrefixedFraming {
+		// Framed mode: a single message not related to any call is expected until the context is done
+		select {
+		case msg, ok := <-c.unsolicitedMessages():
+			if !ok {
+				return c.connectionError()
+			}
+			err = io2.Unmarshal(msg.Body, c.config.Encoding, response)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		return err
+	}
+	var stop = c.bindContext(ctx)
+	defer stop()
+	err = c.readParseInput(response)
+	if err != nil {
+		err = c.contextError(ctx, err)
+	}
+	return err
+}
+
 func NewTcpClient(appName string, verbosity log.LogLevel) model.TcpClient {
 	return &tcpClient{
 		logger: log.NewLogger(appName, verbosity),
@@ -0,0 +1,286 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/builders"
+	"github.com/hellgate75/go-network/tcp/stream"
+	"github.com/hellgate75/go-network/testsuite"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type counter struct {
+	Value int `json:"value"`
+}
+
+// Returns a free local tcp port
+func freePort() int {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// Starts a framed Tcp server on a free local port, serving the given actions
+func startFramedServer(t *testing.T, actions ...model.TcpAction) (model.TcpServer, int) {
+	var port = freePort()
+	config, err := builders.NewTcpServerConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewTcpServer("Test Tcp Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	var handlerBuilder = builders.NewTcpCallHandlerBuilder().WithName("test")
+	for _, action := range actions {
+		handlerBuilder = handlerBuilder.WithTcpHandling(action)
+	}
+	handler, err := handlerBuilder.Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	return server, port
+}
+
+// Returns an action answering the request counter incremented by one
+func incrementAction(name string) model.TcpAction {
+	return builders.NewTcpActionBuilder().WithName(name).With(func(c context2.TcpContext) error {
+		var request counter
+		if err := c.ParseRequest(&request); err != nil {
+			return err
+		}
+		request.Value++
+		return c.WriteResponse(&request)
+	}).Build()
+}
+
+func TestFramedSendAndEncode(t *testing.T) {
+	server, port := startFramedServer(t, incrementAction("increment"))
+	defer server.Stop()
+
+	clientConfig, err := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		WithAction("increment").
+		Build()
+	testsuite.AssertNil(t, "Client config error must be nil", err)
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	defer client.Close()
+	var response counter
+	testsuite.AssertNil(t, "Encode error must be nil", client.Encode(&counter{Value: 1}, &response, 2*time.Second))
+	testsuite.AssertEquals(t, "Encode must receive the action response", 2, response.Value)
+	testsuite.AssertNil(t, "Send error must be nil", client.Send(bytes.NewBufferString(`{"value":5}`), &response, 2*time.Second))
+	testsuite.AssertEquals(t, "Send must receive the action response", 6, response.Value)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	testsuite.AssertNil(t, "EncodeContext error must be nil", client.EncodeContext(ctx, &counter{Value: 10}, &response))
+	testsuite.AssertEquals(t, "EncodeContext must receive the action response", 11, response.Value)
+	testsuite.AssertNil(t, "SendContext error must be nil", client.SendContext(ctx, bytes.NewBufferString(`{"value":20}`), &response))
+	testsuite.AssertEquals(t, "SendContext must receive the action response", 21, response.Value)
+
+	clientConfig.Action = ""
+	other := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", other.Connect(clientConfig))
+	defer other.Close()
+	err = other.Encode(&counter{Value: 1}, &response, 2*time.Second)
+	testsuite.AssertNotNil(t, "Framed Encode without action must be rejected", err)
+	_, isTcpError := err.(*model.TcpError)
+	testsuite.AssertEquals(t, "Framed Encode without action must be rejected before sending", false, isTcpError)
+}
+
+func TestConcurrentCallsOutOfOrder(t *testing.T) {
+	const calls = 8
+	var lock sync.Mutex
+	var completed = make([]int, 0)
+	server, port := startFramedServer(t, builders.NewTcpActionBuilder().WithName("slow-increment").With(func(c context2.TcpContext) error {
+		var request counter
+		if err := c.ParseRequest(&request); err != nil {
+			return err
+		}
+		// Later requests complete first, so the responses arrive in reverse order
+		time.Sleep(time.Duration(calls-request.Value) * 25 * time.Millisecond)
+		lock.Lock()
+		completed = append(completed, request.Value)
+		lock.Unlock()
+		request.Value += 100
+		return c.WriteResponse(&request)
+	}).Build())
+	defer server.Stop()
+
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	var responses = make([]counter, calls)
+	var errs = make([]error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Call(ctx, "slow-increment", &counter{Value: i}, &responses[i])
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < calls; i++ {
+		testsuite.AssertNil(t, "Call error must be nil", errs[i])
+		testsuite.AssertEquals(t, "Each call must receive its own response", i+100, responses[i].Value)
+	}
+	testsuite.AssertEquals(t, "Responses must arrive out of order", calls-1, completed[0])
+}
+
+func TestCallContext(t *testing.T) {
+	var seen = make(chan error, 1)
+	server, port := startFramedServer(t, builders.NewTcpActionBuilder().WithName("wait").With(func(c context2.TcpContext) error {
+		select {
+		case <-c.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		seen <- c.Context().Err()
+		return nil
+	}).Build())
+	defer server.Stop()
+
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var response counter
+	var start = time.Now()
+	err := client.Call(ctx, "wait", &counter{}, &response)
+	testsuite.AssertEquals(t, "Expired context must abort the call", context.DeadlineExceeded, err)
+	testsuite.AssertEquals(t, "Call must return at the deadline", true, time.Since(start) < 2*time.Second)
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancelNow()
+	}()
+	err = client.Call(cancelled, "wait", &counter{}, &response)
+	testsuite.AssertEquals(t, "Cancelled context must abort the call", context.Canceled, err)
+	// Client disconnection cancels the context of the running actions
+	_ = client.Close()
+	select {
+	case err = <-seen:
+		testsuite.AssertNotNil(t, "Action context must be cancelled when the client disconnects", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Action context must be cancelled when the client disconnects")
+	}
+}
+
+// Framed server accepting connections on a local listener, it answers the heartbeat messages while answer is set
+type heartbeatServer struct {
+	sync.Mutex
+	listener net.Listener
+	answer   bool
+	accepted chan net.Conn
+}
+
+func startHeartbeatServer(t *testing.T) *heartbeatServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testsuite.AssertNil(t, "Listen error must be nil", err)
+	var server = &heartbeatServer{
+		listener: l,
+		answer:   true,
+		accepted: make(chan net.Conn, 8),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			server.accepted <- conn
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *heartbeatServer) serve(conn net.Conn) {
+	var frames = stream.NewLengthPrefixedFrameReaderWriter(conn, 0)
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			return
+		}
+		msg, err := stream.DecodeMessage(frame)
+		s.Lock()
+		var answer = s.answer
+		s.Unlock()
+		if err != nil || msg.Type != stream.PingMessage || !answer {
+			continue
+		}
+		pong, _ := stream.EncodeMessage(stream.Message{Type: stream.PongMessage, Id: msg.Id})
+		_ = frames.WriteFrame(pong)
+	}
+}
+
+func (s *heartbeatServer) setAnswer(answer bool) {
+	s.Lock()
+	s.answer = answer
+	s.Unlock()
+}
+
+// Waits for the given connection state transitions
+func awaitStates(t *testing.T, states chan model.ConnectionState, expected ...model.ConnectionState) {
+	for _, state := range expected {
+		select {
+		case current := <-states:
+			testsuite.AssertEquals(t, "Connection state must change", state, current)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Connection state must change to %v", state)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server := startHeartbeatServer(t)
+	var states = make(chan model.ConnectionState, 16)
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().
+		WithHost("127.0.0.1", server.listener.Addr().(*net.TCPAddr).Port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		WithHeartbeat(50*time.Millisecond, 100*time.Millisecond).
+		WithReconnect(model.ReconnectPolicy{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond}).
+		WithStateListener(func(previous, current model.ConnectionState) {
+			states <- current
+		}).
+		Build()
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	defer client.Close()
+	awaitStates(t, states, model.Connecting, model.Connected)
+	conn := <-server.accepted
+
+	// Connection dropped by the server
+	_ = conn.Close()
+	awaitStates(t, states, model.Reconnecting, model.Connected)
+	conn = <-server.accepted
+	// Answered heartbeats keep the connection
+	time.Sleep(200 * time.Millisecond)
+	testsuite.AssertEquals(t, "Answered heartbeats must keep the connection", model.Connected, client.State())
+
+	// Half-open connection: heartbeats are not answered anymore
+	server.setAnswer(false)
+	awaitStates(t, states, model.Reconnecting)
+	server.setAnswer(true)
+	awaitStates(t, states, model.Connected)
+	conn = <-server.accepted
+
+	// Server gone: reconnection fails after the maximum attempts, waiting the growing backoff
+	_ = server.listener.Close()
+	var start = time.Now()
+	_ = conn.Close()
+	awaitStates(t, states, model.Reconnecting, model.Disconnected)
+	testsuite.AssertEquals(t, "Reconnection must wait the backoff", true, time.Since(start) >= 350*time.Millisecond)
+}
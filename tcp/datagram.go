@@ -0,0 +1,582 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	io2 "github.com/hellgate75/go-network/io"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/stream"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// Maximum size of a received datagram, bigger packets are truncated
+	MaxDatagramSize = 65535
+)
+
+// Reports if the given network is a datagram network, served by the datagram server and client
+func isDatagramNetwork(network string) bool {
+	return network == "udp" || network == "udp4" || network == "udp6"
+}
+
+// Binds the connection deadline to the given context, the returned function releases the binding
+func bindConnContext(ctx context.Context, conn net.Conn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	var done = make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		_ = conn.SetDeadline(time.Time{})
+	}
+}
+
+// Reports the context error in place of the given one, when the context is done
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+type datagramServer struct {
+	sync.Mutex
+	config                 *model.TcpServerConfig
+	running                bool
+	done                   chan struct{}
+	drained                chan struct{}
+	logger                 log.Logger
+	activeRequests         int64
+	handlers               []*model.TcpCallHandler
+	packetConn             net.PacketConn
+	serverMap              map[string]interface{}
+	interceptors           []model.TcpInterceptor
+	connectionInterceptors []model.TcpConnectionInterceptor
+}
+
+func (server *datagramServer) Init(config model.TcpServerConfig) (model.TcpServer, error) {
+	if server.Running() {
+		return server, errors.New(fmt.Sprint("DatagramServer.Init() - Server is still running"))
+	}
+	server.config = &config
+	return server, nil
+}
+
+func (server *datagramServer) Start() error {
+	if server.Running() {
+		server.logger.Fatal("DatagramServer.Start() - Error: Server already running")
+		return errors.New(fmt.Sprint("DatagramServer.Start() - Error: Server already running"))
+	}
+	if server.config == nil {
+		server.logger.Fatal("DatagramServer.Start() - Error: No server configuration provided")
+		return errors.New(fmt.Sprint("DatagramServer.Start() - Error: No server configuration provided"))
+	}
+	if !isDatagramNetwork(server.config.Network) {
+		server.logger.Errorf("DatagramServer.Start() - Error: Unsupported network %s", server.config.Network)
+		return errors.New(fmt.Sprintf("DatagramServer.Start() - Error: Unsupported network %s, udp networks are supported", server.config.Network))
+	}
+	var address = fmt.Sprintf("%s:%v", server.config.Host, server.config.Port)
+	conn, err := net.ListenPacket(server.config.Network, address)
+	if err != nil {
+		server.logger.Errorf("DatagramServer.Start() - Server failed to start on: %s, due to error: %v", address, err)
+		return err
+	}
+	server.Lock()
+	server.running = true
+	server.done = make(chan struct{})
+	server.drained = nil
+	server.packetConn = conn
+	server.Unlock()
+	server.logger.Infof("DatagramServer.Start() - Server started on: %s", conn.LocalAddr())
+	go server.readPackets(conn)
+	return nil
+}
+
+// Reads the datagrams and handles each of them concurrently, until the server is stopped
+func (server *datagramServer) readPackets(conn net.PacketConn) {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Fatalf("DatagramServer.readPackets() - Error: %v", r)
+		}
+	}()
+	var buff = make([]byte, MaxDatagramSize)
+	for server.Running() {
+		n, addr, err := conn.ReadFrom(buff)
+		if err != nil {
+			if !server.Running() {
+				return
+			}
+			server.logger.Errorf("DatagramServer.readPackets() - Reading packet - Error: %v", err)
+			continue
+		}
+		var packet = make([]byte, n)
+		copy(packet, buff[:n])
+		server.register()
+		go func(addr net.Addr, packet []byte) {
+			defer server.deregister()
+			server.handlePacket(conn, addr, packet)
+		}(addr, packet)
+	}
+}
+
+// Runs the connection interceptors on a single datagram, and dispatches the request message it carries
+// to the handler that owns the requested action
+func (server *datagramServer) handlePacket(conn net.PacketConn, addr net.Addr, packet []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Fatalf("DatagramServer.handlePacket() - Error: %v", r)
+		}
+	}()
+	var packetConn = stream.NewPacketConn(conn, addr, packet)
+	var connectionMap = make(map[string]interface{})
+	for _, interceptor := range server.connectionInterceptors {
+		next, err := interceptor(packetConn, connectionMap)
+		if err != nil {
+			server.logger.Warnf("DatagramServer.handlePacket() - Packet from %+v rejected - Error: %v", addr, err)
+			return
+		}
+		if next != nil {
+			packetConn = next
+		}
+	}
+	request, err := stream.DecodeMessage(packet)
+	if err != nil || request.Type != stream.RequestMessage {
+		server.logger.Warnf("DatagramServer.handlePacket() - Packet from %+v discarded, it is not a request message - Error: %v", addr, err)
+		return
+	}
+	ctx := context2.WithConnectionMap(context.Background(), connectionMap)
+	var frames = stream.NewPacketFrameReaderWriter(packetConn, nil, uint32(MaxDatagramSize))
+	if request.Action != "" {
+		if handler := server.findHandler(request.Action); handler != nil {
+			server.logger.Debugf("Handling message %s from %+v to action %s of handler named: %s", request.Id, addr, request.Action, (*handler).GetName())
+			(*handler).HandleRequest(packetConn, stream.NewMessageReaderWriterCloser(ctx, request, frames))
+			return
+		}
+	}
+	server.logger.Warnf("DatagramServer.handlePacket() - Unknown action %s requested from %+v", request.Action, addr)
+	err = answerUnknownAction(frames, request)
+	if err != nil {
+		server.logger.Errorf("DatagramServer.handlePacket() - Answering unknown action to %+v - Error: %v", addr, err)
+	}
+}
+
+func (server *datagramServer) findHandler(action string) *model.TcpCallHandler {
+	defer server.Unlock()
+	server.Lock()
+	return server.handlerOf(action)
+}
+
+// Returns the handler owning the given action, the caller must hold the server lock
+func (server *datagramServer) handlerOf(action string) *model.TcpCallHandler {
+	for _, handler := range server.handlers {
+		for _, name := range (*handler).Names() {
+			if name == action {
+				return handler
+			}
+		}
+	}
+	return nil
+}
+
+func (server *datagramServer) register() {
+	defer server.Unlock()
+	server.Lock()
+	server.activeRequests++
+}
+
+func (server *datagramServer) deregister() {
+	defer server.Unlock()
+	server.Lock()
+	server.activeRequests--
+	if server.drained != nil && server.activeRequests <= 0 {
+		close(server.drained)
+		server.drained = nil
+	}
+}
+
+func (server *datagramServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ServerWaitTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func (server *datagramServer) Shutdown(ctx context.Context) error {
+	server.Lock()
+	if !server.running {
+		server.Unlock()
+		var err = errors.New(fmt.Sprint("DatagramServer.Shutdown() - Error: Server is already stopped"))
+		server.logger.Errorf("DatagramServer.Shutdown() -  %v", err)
+		return err
+	}
+	server.running = false
+	defer close(server.done)
+	err := server.packetConn.Close()
+	if err != nil {
+		server.logger.Errorf("DatagramServer.Shutdown() - Closing connection error occurred: %v", err)
+	}
+	server.packetConn = nil
+	if server.activeRequests <= 0 {
+		server.Unlock()
+		return err
+	}
+	var drained = make(chan struct{})
+	server.drained = drained
+	server.logger.Infof("DatagramServer.Shutdown() - Waiting for %v in-flight requests ...", server.activeRequests)
+	server.Unlock()
+	select {
+	case <-drained:
+		return err
+	case <-ctx.Done():
+		server.logger.Warnf("DatagramServer.Shutdown() - Deadline reached, in-flight requests are abandoned")
+		server.Lock()
+		server.drained = nil
+		server.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (server *datagramServer) Running() bool {
+	defer server.Unlock()
+	server.Lock()
+	return server.running
+}
+
+func (server *datagramServer) Working() bool {
+	defer server.Unlock()
+	server.Lock()
+	return server.activeRequests > 0
+}
+
+func (server *datagramServer) Wait() {
+	server.Lock()
+	var done = server.done
+	server.Unlock()
+	if done == nil {
+		return
+	}
+	server.logger.Debugf("DatagramServer.Wait() - Waiting for server shutdown")
+	<-done
+	server.logger.Debugf("DatagramServer.Wait() - exit")
+}
+
+func (server *datagramServer) AddPath(handler model.TcpCallHandler) error {
+	defer server.Unlock()
+	server.Lock()
+	var name = handler.GetName()
+	if len(handler.Names()) == 0 {
+		server.logger.Warnf("DatagramServer.AddPath() - No actions for Tcp handler with name: %s", name)
+		return errors.New(fmt.Sprint("Provided handler has not method implementation"))
+	}
+	for _, h := range server.handlers {
+		if (*h).GetName() == name {
+			server.logger.Warnf("DatagramServer.AddPath() - Duplicated Tcp handler with name: %s", name)
+			return errors.New(fmt.Sprintf("Provided handler has duplicsted handler with name: %s", name))
+		}
+	}
+	for _, action := range handler.Names() {
+		if server.handlerOf(action) != nil {
+			server.logger.Warnf("DatagramServer.AddPath() - Duplicated Tcp action with name: %s", action)
+			return errors.New(fmt.Sprintf("Provided handler has duplicated action with name: %s", action))
+		}
+	}
+	handler.SetServerMap(&server.serverMap)
+	handler.SetLogger(server.logger)
+	handler.SetEncoding(server.config.Encoding)
+	handler.SetInterceptors(&server.interceptors)
+	server.handlers = append(server.handlers, &handler)
+	server.logger.Debugf("DatagramServer.AddPath() - Adding Tcp handler with name: %s", name)
+	return nil
+}
+
+func (server *datagramServer) Use(interceptors ...model.TcpInterceptor) {
+	defer server.Unlock()
+	server.Lock()
+	for _, i := range interceptors {
+		if i != nil {
+			server.interceptors = append(server.interceptors, i)
+		}
+	}
+}
+
+func (server *datagramServer) UseOnAccept(interceptors ...model.TcpConnectionInterceptor) {
+	defer server.Unlock()
+	server.Lock()
+	for _, i := range interceptors {
+		if i != nil {
+			server.connectionInterceptors = append(server.connectionInterceptors, i)
+		}
+	}
+}
+
+// Creates a datagram server for the udp networks: each received packet carries a single request message (the framed
+// message layout, with no length header), dispatched to the handler that owns the requested action. The responses
+// written by the action are sent back to the sender as response message datagrams, unknown actions are answered
+// with an error message. Connection interceptors run on each packet, with a new connection map.
+func NewDatagramServer(appName string, verbosity log.LogLevel) model.TcpServer {
+	return &datagramServer{
+		logger:                 log.NewLogger(appName, verbosity),
+		handlers:               make([]*model.TcpCallHandler, 0),
+		serverMap:              make(map[string]interface{}),
+		interceptors:           make([]model.TcpInterceptor, 0),
+		connectionInterceptors: make([]model.TcpConnectionInterceptor, 0),
+	}
+}
+
+type datagramClient struct {
+	sync.Mutex
+	calls  sync.Mutex
+	config *model.TcpClientConfig
+	cli    net.Conn
+	state  model.ConnectionState
+	logger log.Logger
+}
+
+func (c *datagramClient) setState(state model.ConnectionState) {
+	c.Lock()
+	var previous = c.state
+	c.state = state
+	var listener = c.config.OnStateChange
+	c.Unlock()
+	if listener != nil && previous != state {
+		listener(previous, state)
+	}
+}
+
+func (c *datagramClient) Connect(config model.TcpClientConfig) error {
+	if c.IsOpen() {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	if !isDatagramNetwork(config.Network) {
+		c.logger.Errorf("Unsupported network %s", config.Network)
+		return errors.New(fmt.Sprintf("Unsupported network %s, udp networks are supported", config.Network))
+	}
+	c.Lock()
+	c.config = &config
+	c.Unlock()
+	var dialer = &net.Dialer{
+		Timeout: config.DialTimeout,
+	}
+	conn, err := dialer.Dial(config.Network, fmt.Sprintf("%s:%v", config.Host, config.Port))
+	if err != nil {
+		c.logger.Error(err)
+		return err
+	}
+	c.Lock()
+	c.cli = conn
+	c.Unlock()
+	c.setState(model.Connected)
+	return nil
+}
+
+func (c *datagramClient) Close() error {
+	c.Lock()
+	var conn = c.cli
+	c.cli = nil
+	c.Unlock()
+	if conn == nil {
+		c.logger.Error("Connection is already closed ...")
+		return errors.New(fmt.Sprint("Connection is already closed ..."))
+	}
+	err := conn.Close()
+	c.setState(model.Closed)
+	return err
+}
+
+func (c *datagramClient) IsOpen() bool {
+	defer c.Unlock()
+	c.Lock()
+	return c.cli != nil
+}
+
+func (c *datagramClient) State() model.ConnectionState {
+	defer c.Unlock()
+	c.Lock()
+	return c.state
+}
+
+func (c *datagramClient) connection() (net.Conn, error) {
+	defer c.Unlock()
+	c.Lock()
+	if c.cli == nil {
+		c.logger.Error("Client is not connected to a server socket")
+		return nil, errors.New(fmt.Sprint("Client is not connected to a server socket"))
+	}
+	return c.cli, nil
+}
+
+// Sends the data to the given action as a single request message datagram and reads the response message
+// datagram (when response is not nil), until the context is done. The exchanges on the client are serialized,
+// responses to former expired requests are discarded.
+func (c *datagramClient) exchange(ctx context.Context, action string, data []byte, response interface{}) error {
+	conn, err := c.connection()
+	if err != nil {
+		return err
+	}
+	var id = context2.GenerateUUUID()
+	packet, err := stream.EncodeMessage(stream.Message{
+		Type:   stream.RequestMessage,
+		Id:     id,
+		Action: action,
+		Body:   data,
+	})
+	if err != nil {
+		return err
+	}
+	if len(packet) > MaxDatagramSize {
+		return errors.New(fmt.Sprintf("Datagram too large: %v bytes", len(packet)))
+	}
+	defer c.calls.Unlock()
+	c.calls.Lock()
+	var stop = bindConnContext(ctx, conn)
+	defer stop()
+	_, err = conn.Write(packet)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if response == nil {
+		return nil
+	}
+	for {
+		msg, err := c.readMessage(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if msg.Id == id {
+			return c.parseMessage(msg, response)
+		}
+		c.logger.Warnf("Response message %s not related to the request %s discarded", msg.Id, id)
+	}
+}
+
+// Reads a single datagram, carrying a response or error message
+func (c *datagramClient) readMessage(ctx context.Context, conn net.Conn) (stream.Message, error) {
+	var buff = make([]byte, MaxDatagramSize)
+	n, err := conn.Read(buff)
+	if err != nil {
+		return stream.Message{}, contextError(ctx, err)
+	}
+	return stream.DecodeMessage(buff[:n])
+}
+
+// Decodes the message body in the response, error messages are returned as *model.TcpError
+func (c *datagramClient) parseMessage(msg stream.Message, response interface{}) error {
+	if msg.Type == stream.ErrorMessage {
+		return &model.TcpError{
+			Code:    model.TcpErrorCode(msg.Code),
+			Action:  msg.Action,
+			Message: string(msg.Body),
+		}
+	}
+	return io2.Unmarshal(msg.Body, c.config.Encoding, response)
+}
+
+// Sends the data to the action set in the client configuration
+func (c *datagramClient) sendAction(ctx context.Context, data []byte, response interface{}) error {
+	if _, err := c.connection(); err != nil {
+		return err
+	}
+	if c.config.Action == "" {
+		c.logger.Error("Datagram requests require the client action, or the Call method")
+		return errors.New(fmt.Sprint("Datagram requests require the client action, or the Call method"))
+	}
+	return c.exchange(ctx, c.config.Action, data, response)
+}
+
+func (c *datagramClient) timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (c *datagramClient) Send(body io.Reader, response interface{}, timeout time.Duration) error {
+	ctx, cancel := c.timeoutContext(timeout)
+	defer cancel()
+	return c.SendContext(ctx, body, response)
+}
+
+func (c *datagramClient) Encode(request interface{}, response interface{}, timeout time.Duration) error {
+	ctx, cancel := c.timeoutContext(timeout)
+	defer cancel()
+	return c.EncodeContext(ctx, request, response)
+}
+
+func (c *datagramClient) ReadRemote(timeout time.Duration, response interface{}) error {
+	ctx, cancel := c.timeoutContext(timeout)
+	defer cancel()
+	return c.ReadRemoteContext(ctx, response)
+}
+
+func (c *datagramClient) SendContext(ctx context.Context, body io.Reader, response interface{}) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return c.sendAction(ctx, data, response)
+}
+
+func (c *datagramClient) EncodeContext(ctx context.Context, request interface{}, response interface{}) error {
+	if _, err := c.connection(); err != nil {
+		return err
+	}
+	data, err := io2.Marshal(c.config.Encoding, request)
+	if err != nil {
+		return err
+	}
+	return c.sendAction(ctx, data, response)
+}
+
+func (c *datagramClient) ReadRemoteContext(ctx context.Context, response interface{}) error {
+	if response == nil {
+		return errors.New(fmt.Sprint("Nil response interface, cannot parse the remote connection stream"))
+	}
+	conn, err := c.connection()
+	if err != nil {
+		return err
+	}
+	defer c.calls.Unlock()
+	c.calls.Lock()
+	var stop = bindConnContext(ctx, conn)
+	defer stop()
+	msg, err := c.readMessage(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return c.parseMessage(msg, response)
+}
+
+func (c *datagramClient) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	if _, err := c.connection(); err != nil {
+		return err
+	}
+	data, err := io2.Marshal(c.config.Encoding, request)
+	if err != nil {
+		return err
+	}
+	return c.exchange(ctx, action, data, response)
+}
+
+// Creates a datagram client for the udp networks: each request is sent to a named action as a single request
+// message datagram, and a single response message datagram is read. Send and Encode requests are sent to
+// the action set in the client configuration, failures reported by the server are returned as *model.TcpError.
+func NewDatagramClient(appName string, verbosity log.LogLevel) model.TcpClient {
+	return &datagramClient{
+		logger: log.NewLogger(appName, verbosity),
+	}
+}
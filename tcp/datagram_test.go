@@ -0,0 +1,91 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/builders"
+	"github.com/hellgate75/go-network/testsuite"
+	"net"
+	"testing"
+	"time"
+)
+
+// Returns a free local udp port
+func freeDatagramPort() int {
+	conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDatagramRoundTrip(t *testing.T) {
+	var port = freeDatagramPort()
+	config, err := builders.NewTcpServerConfigBuilder().WithNetwork("udp").WithHost("127.0.0.1", port).Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewDatagramServer("Test Udp Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	increments, _ := builders.NewTcpCallHandlerBuilder().WithName("increments").
+		WithTcpHandling(incrementAction("increment")).
+		Build()
+	doubles, _ := builders.NewTcpCallHandlerBuilder().WithName("doubles").
+		WithTcpHandling(builders.NewTcpActionBuilder().WithName("double").With(func(c context2.TcpContext) error {
+			var request counter
+			if err := c.ParseRequest(&request); err != nil {
+				return err
+			}
+			request.Value *= 2
+			return c.WriteResponse(&request)
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(increments))
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(doubles))
+	duplicated, _ := builders.NewTcpCallHandlerBuilder().WithName("duplicated").
+		WithTcpHandling(incrementAction("increment")).
+		Build()
+	testsuite.AssertNotNil(t, "Duplicated action must be rejected", server.AddPath(duplicated))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithNetwork("udp").WithHost("127.0.0.1", port).
+		WithAction("double").
+		Build()
+	client := NewDatagramClient("Test Udp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var response counter
+	testsuite.AssertNil(t, "Call error must be nil", client.Call(ctx, "increment", &counter{Value: 1}, &response))
+	testsuite.AssertEquals(t, "Call must run the named action only", 2, response.Value)
+	testsuite.AssertNil(t, "Call error must be nil", client.Call(ctx, "double", &counter{Value: 3}, &response))
+	testsuite.AssertEquals(t, "Call must run the named action only", 6, response.Value)
+	testsuite.AssertNil(t, "Encode error must be nil", client.Encode(&counter{Value: 5}, &response, 2*time.Second))
+	testsuite.AssertEquals(t, "Encode must run the client action", 10, response.Value)
+	testsuite.AssertNil(t, "Send error must be nil", client.Send(bytes.NewBufferString(`{"value":7}`), &response, 2*time.Second))
+	testsuite.AssertEquals(t, "Send must run the client action", 14, response.Value)
+	err = client.Call(ctx, "missing", &counter{}, &response)
+	tcpErr, ok := err.(*model.TcpError)
+	testsuite.AssertEquals(t, "Unknown action must be answered with a TcpError", true, ok)
+	testsuite.AssertEquals(t, "Unknown action error code", model.UnknownActionError, tcpErr.Code)
+
+	clientConfig.Action = ""
+	other := NewDatagramClient("Test Udp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", other.Connect(clientConfig))
+	defer other.Close()
+	testsuite.AssertNotNil(t, "Encode without action must be rejected", other.Encode(&counter{}, &response, 2*time.Second))
+}
+
+func TestDatagramNetworks(t *testing.T) {
+	for _, network := range []string{"ip4:1", "unixgram"} {
+		config, _ := builders.NewTcpServerConfigBuilder().WithNetwork(network).WithHost("127.0.0.1", freeDatagramPort()).Build()
+		server, _ := NewDatagramServer("Test Udp Server", log.FATAL).Init(config)
+		testsuite.AssertNotNil(t, "Datagram server must reject the network "+network, server.Start())
+		clientConfig, _ := builders.NewTcpClientConfigBuilder().WithNetwork(network).WithHost("127.0.0.1", 1).Build()
+		testsuite.AssertNotNil(t, "Datagram client must reject the network "+network, NewDatagramClient("Test Udp Client", log.FATAL).Connect(clientConfig))
+	}
+	config, _ := builders.NewTcpServerConfigBuilder().WithNetwork("udp").WithHost("127.0.0.1", freeDatagramPort()).Build()
+	server, _ := NewTcpServer("Test Tcp Server", log.FATAL).Init(config)
+	testsuite.AssertNotNil(t, "Stream server must reject the datagram networks", server.Start())
+}
@@ -0,0 +1,203 @@
+package interceptors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/stream"
+	"net"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Recovers panics raised by the next functions, returning them as errors,
+// so they flow to the handler error channel
+func Recovery() model.TcpInterceptor {
+	return func(next model.TcpActionFunction) model.TcpActionFunction {
+		return func(c context.TcpContext) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = errors.New(fmt.Sprintf("Recovery() - Panic in request %s from %+v: %v", c.Id, c.RemoteAddress, r))
+					if c.Logger != nil {
+						c.Logger.Errorf("%v\n%s", err, debug.Stack())
+					}
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// Logs each action execution with request identifier, remote address and duration, using the server logger
+func Logging() model.TcpInterceptor {
+	return func(next model.TcpActionFunction) model.TcpActionFunction {
+		return func(c context.TcpContext) error {
+			var start = time.Now()
+			err := next(c)
+			if c.Logger != nil {
+				if err != nil {
+					c.Logger.Errorf("Request %s from %+v - duration: %v, error: %v", c.Id, c.RemoteAddress, time.Now().Sub(start), err)
+				} else {
+					c.Logger.Infof("Request %s from %+v - duration: %v", c.Id, c.RemoteAddress, time.Now().Sub(start))
+				}
+			}
+			return err
+		}
+	}
+}
+
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	var networks = make([]*net.IPNet, 0)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func remoteIP(conn net.Conn) net.IP {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts only connections whose remote address belongs to one of the given CIDR networks (eg.: 192.168.1.0/24).
+// It reports an error if any network is not valid
+func AllowNetworks(cidrs ...string) (model.TcpConnectionInterceptor, error) {
+	networks, err := parseNetworks(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+		var ip = remoteIP(conn)
+		if ip == nil || !containsIP(networks, ip) {
+			return conn, errors.New(fmt.Sprintf("Remote address %v is not allowed", conn.RemoteAddr()))
+		}
+		return conn, nil
+	}, nil
+}
+
+// Rejects connections whose remote address belongs to one of the given CIDR networks (eg.: 10.0.0.0/8).
+// It reports an error if any network is not valid
+func DenyNetworks(cidrs ...string) (model.TcpConnectionInterceptor, error) {
+	networks, err := parseNetworks(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+		var ip = remoteIP(conn)
+		if ip == nil || containsIP(networks, ip) {
+			return conn, errors.New(fmt.Sprintf("Remote address %v is denied", conn.RemoteAddr()))
+		}
+		return conn, nil
+	}, nil
+}
+
+// Describe a function validating the first frame sent by a client, it can store connection level
+// information (eg.: the authenticated identity) in the connection map
+type FrameValidator func(frame []byte, connectionMap map[string]interface{}) error
+
+// Reads the first length-prefixed frame sent by the client and validates it, before any request is read.
+// The client must send the frame within the given timeout (0 means no timeout), frames bigger than the given
+// maximum frame size (0 means stream.DefaultMaxFrameSize) are rejected. The frame is not passed to the handlers.
+func FirstFrame(validate FrameValidator, timeout time.Duration, maxFrameSize uint32) model.TcpConnectionInterceptor {
+	return func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+		if timeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				return conn, err
+			}
+			defer func() {
+				_ = conn.SetReadDeadline(time.Time{})
+			}()
+		}
+		frame, err := stream.ReadFrame(conn, maxFrameSize)
+		if err != nil {
+			return conn, errors.New(fmt.Sprintf("Unable to read the first frame: %v", err))
+		}
+		return conn, validate(frame, connectionMap)
+	}
+}
+
+// Requires the verified client certificate of TLS connections (mutual TLS), storing in the connection map
+// the principal identified by the certificate, with the roles returned by the given mapper (eg.: model.SubjectRoles),
+// nil means no roles. The server must request and verify the client certificates, see
+// TcpServerConfigBuilder.WithClientCaCert and WithClientAuth
+func ClientCertificate(mapper model.CertificateMapper) model.TcpConnectionInterceptor {
+	return func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+		peer, _ := connectionMap[context.PeerCertificateKey].(*context.PeerCertificate)
+		if peer == nil {
+			return conn, errors.New(fmt.Sprintf("Remote address %v has not presented a verified client certificate", conn.RemoteAddr()))
+		}
+		var roles []string
+		if mapper != nil {
+			var err error
+			if roles, err = mapper(peer); err != nil {
+				return conn, err
+			}
+		}
+		connectionMap[context.PrincipalKey] = peer.Principal(roles...)
+		return conn, nil
+	}
+}
+
+// Collects the bytes read from and written to the connections
+type ByteMeter struct {
+	read    uint64
+	written uint64
+}
+
+// Returns the total number of bytes read from the metered connections
+func (m *ByteMeter) BytesRead() uint64 {
+	return atomic.LoadUint64(&m.read)
+}
+
+// Returns the total number of bytes written to the metered connections
+func (m *ByteMeter) BytesWritten() uint64 {
+	return atomic.LoadUint64(&m.written)
+}
+
+// Returns a connection interceptor counting in this meter the bytes read from and written to each connection
+func (m *ByteMeter) Interceptor() model.TcpConnectionInterceptor {
+	return func(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+		return &meteredConn{Conn: conn, meter: m}, nil
+	}
+}
+
+type meteredConn struct {
+	net.Conn
+	meter *ByteMeter
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddUint64(&c.meter.read, uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddUint64(&c.meter.written, uint64(n))
+	return n, err
+}
@@ -0,0 +1,92 @@
+package interceptors
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/stream"
+	"github.com/hellgate75/go-network/testsuite"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFirstFrame(t *testing.T) {
+	var interceptor = FirstFrame(func(frame []byte, connectionMap map[string]interface{}) error {
+		if string(frame) != "sample-token" {
+			return errors.New("Invalid token")
+		}
+		connectionMap["user"] = "sample-user"
+		return nil
+	}, time.Second, 0)
+	server, client := net.Pipe()
+	go func() {
+		_ = stream.WriteFrame(client, []byte("sample-token"), 0)
+	}()
+	var connectionMap = make(map[string]interface{})
+	_, err := interceptor(server, connectionMap)
+	testsuite.AssertNil(t, "Valid first frame must be accepted", err)
+	testsuite.AssertEquals(t, "Validator must fill the connection map", "sample-user", connectionMap["user"])
+	go func() {
+		_ = stream.WriteFrame(client, []byte("wrong-token"), 0)
+	}()
+	_, err = interceptor(server, make(map[string]interface{}))
+	testsuite.AssertNotNil(t, "Invalid first frame must be rejected", err)
+	_ = client.Close()
+	_ = server.Close()
+}
+
+func TestNetworks(t *testing.T) {
+	_, err := AllowNetworks("192.168.1.0/33")
+	testsuite.AssertNotNil(t, "Invalid network must be reported", err)
+	allow, err := AllowNetworks("127.0.0.0/8")
+	testsuite.AssertNil(t, "Valid network error must be nil", err)
+	deny, err := DenyNetworks("127.0.0.0/8")
+	testsuite.AssertNil(t, "Valid network error must be nil", err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testsuite.AssertNil(t, "Listener error must be nil", err)
+	defer l.Close()
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+	conn, err := l.Accept()
+	testsuite.AssertNil(t, "Accept error must be nil", err)
+	defer conn.Close()
+	_, err = allow(conn, nil)
+	testsuite.AssertNil(t, "Allowed network connection must be accepted", err)
+	_, err = deny(conn, nil)
+	testsuite.AssertNotNil(t, "Denied network connection must be rejected", err)
+}
+
+func TestClientCertificate(t *testing.T) {
+	var interceptor = ClientCertificate(model.SubjectRoles(map[string][]string{"billing": {"reader"}}))
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	_, err := interceptor(server, make(map[string]interface{}))
+	testsuite.AssertNotNil(t, "Connection without client certificate must be rejected", err)
+	var cert = &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "billing", Organization: []string{"Acme"}},
+		Issuer:       pkix.Name{CommonName: "Acme CA"},
+		SerialNumber: big.NewInt(1),
+	}
+	var connectionMap = map[string]interface{}{
+		context.PeerCertificateKey: context.NewPeerCertificate(&tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}),
+	}
+	_, err = interceptor(server, connectionMap)
+	testsuite.AssertNil(t, "Connection with client certificate must be accepted", err)
+	var principal = connectionMap[context.PrincipalKey].(*context.Principal)
+	testsuite.AssertEquals(t, "Principal name must be the common name", "billing", principal.Name)
+	testsuite.AssertEquals(t, "Principal must have the mapped roles", true, principal.HasRole("reader"))
+	testsuite.AssertEquals(t, "Principal claims must carry the issuer", "CN=Acme CA", principal.Claims["issuer"])
+}
@@ -0,0 +1,331 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	"sync"
+	"time"
+)
+
+var (
+	// Maximum interval between two pool maintenance runs, closing expired idle clients and dialing the missing ones
+	PoolMaintenanceInterval = 30 * time.Second
+)
+
+type pooledClient struct {
+	client   model.TcpClient
+	created  time.Time
+	released time.Time
+}
+
+type tcpClientPool struct {
+	sync.Mutex
+	config    model.TcpClientConfig
+	pool      model.TcpClientPoolConfig
+	idle      []*pooledClient
+	inUse     map[model.TcpClient]*pooledClient
+	open      int
+	stats     model.TcpClientPoolStats
+	available chan struct{}
+	closed    bool
+	done      chan struct{}
+	appName   string
+	verbosity log.LogLevel
+	logger    log.Logger
+}
+
+// Dials a new client, with no automatic reconnection: the pool replaces the lost connections
+func (p *tcpClientPool) dial() (*pooledClient, error) {
+	var client = NewTcpClient(p.appName, p.verbosity)
+	var config = p.config
+	config.Reconnect = nil
+	err := client.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	p.Lock()
+	p.stats.Dialed++
+	p.Unlock()
+	return &pooledClient{
+		client:  client,
+		created: time.Now(),
+	}, nil
+}
+
+func (p *tcpClientPool) expired(entry *pooledClient, now time.Time) bool {
+	return p.pool.MaxLifetime > 0 && now.Sub(entry.created) >= p.pool.MaxLifetime
+}
+
+func (p *tcpClientPool) healthy(entry *pooledClient) bool {
+	if p.pool.HealthCheck != nil {
+		return p.pool.HealthCheck(entry.client) == nil
+	}
+	return entry.client.IsOpen() && entry.client.State() == model.Connected
+}
+
+// Closes a client removed from the pool, giving back its place to the waiting borrowers
+func (p *tcpClientPool) discard(entry *pooledClient, evicted bool) {
+	if entry.client.IsOpen() {
+		_ = entry.client.Close()
+	}
+	p.Lock()
+	p.open--
+	if evicted {
+		p.stats.Evicted++
+	}
+	p.Unlock()
+	p.notify()
+}
+
+// Wakes up a borrower waiting for a released client
+func (p *tcpClientPool) notify() {
+	select {
+	case p.available <- struct{}{}:
+	default:
+	}
+}
+
+func (p *tcpClientPool) Borrow(ctx context.Context) (model.TcpClient, error) {
+	var waited = false
+	for {
+		p.Lock()
+		if p.closed {
+			p.Unlock()
+			return nil, errors.New(fmt.Sprint("Tcp Client pool is closed"))
+		}
+		if n := len(p.idle); n > 0 {
+			var entry = p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.Unlock()
+			if p.expired(entry, time.Now()) || !p.healthy(entry) {
+				p.logger.Debug("TcpClientPool.Borrow() - Discarding expired or unhealthy client ...")
+				p.discard(entry, true)
+				continue
+			}
+			p.Lock()
+			p.inUse[entry.client] = entry
+			p.Unlock()
+			return entry.client, nil
+		}
+		if p.pool.MaxOpen <= 0 || p.open < p.pool.MaxOpen {
+			p.open++
+			p.Unlock()
+			entry, err := p.dial()
+			if err != nil {
+				p.Lock()
+				p.open--
+				p.Unlock()
+				p.notify()
+				p.logger.Errorf("TcpClientPool.Borrow() - Dialing a new client - Error: %v", err)
+				return nil, err
+			}
+			p.Lock()
+			p.inUse[entry.client] = entry
+			p.Unlock()
+			return entry.client, nil
+		}
+		if !waited {
+			waited = true
+			p.stats.Waits++
+		}
+		p.Unlock()
+		select {
+		case <-p.available:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *tcpClientPool) Release(client model.TcpClient) error {
+	p.Lock()
+	entry, ok := p.inUse[client]
+	if !ok {
+		p.Unlock()
+		return errors.New(fmt.Sprint("Tcp Client has not been borrowed from this pool"))
+	}
+	delete(p.inUse, client)
+	var now = time.Now()
+	var keep = !p.closed && client.IsOpen() && !p.expired(entry, now) &&
+		(p.pool.MaxIdle <= 0 || len(p.idle) < p.pool.MaxIdle)
+	if keep {
+		entry.released = now
+		p.idle = append(p.idle, entry)
+	}
+	p.Unlock()
+	if !keep {
+		p.discard(entry, p.expired(entry, now))
+		return nil
+	}
+	p.notify()
+	return nil
+}
+
+func (p *tcpClientPool) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	client, err := p.Borrow(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = p.Release(client)
+	}()
+	return client.Call(ctx, action, request, response)
+}
+
+func (p *tcpClientPool) Stats() model.TcpClientPoolStats {
+	defer p.Unlock()
+	p.Lock()
+	var stats = p.stats
+	stats.Open = p.open
+	stats.Idle = len(p.idle)
+	stats.InUse = len(p.inUse)
+	return stats
+}
+
+func (p *tcpClientPool) Close() error {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return errors.New(fmt.Sprint("Tcp Client pool is already closed"))
+	}
+	p.closed = true
+	close(p.done)
+	var idle = p.idle
+	p.idle = nil
+	p.Unlock()
+	for _, entry := range idle {
+		p.discard(entry, false)
+	}
+	return nil
+}
+
+// Closes the expired idle clients, and dials the clients missing to the minimum idle number
+func (p *tcpClientPool) maintain() {
+	var now = time.Now()
+	var evicted = make([]*pooledClient, 0)
+	p.Lock()
+	var idle = make([]*pooledClient, 0, len(p.idle))
+	for i, entry := range p.idle {
+		// Idle clients are sorted by release time, the oldest first
+		var extra = len(p.idle)-i > p.pool.MinIdle
+		if p.expired(entry, now) || (extra && p.pool.IdleTimeout > 0 && now.Sub(entry.released) >= p.pool.IdleTimeout) {
+			evicted = append(evicted, entry)
+			continue
+		}
+		idle = append(idle, entry)
+	}
+	p.idle = idle
+	p.Unlock()
+	for _, entry := range evicted {
+		p.discard(entry, true)
+	}
+	p.fill()
+}
+
+// Dials the clients missing to the minimum idle number, within the maximum open clients
+func (p *tcpClientPool) fill() {
+	p.Lock()
+	var missing = p.pool.MinIdle - len(p.idle)
+	if p.pool.MaxOpen > 0 && p.open+missing > p.pool.MaxOpen {
+		missing = p.pool.MaxOpen - p.open
+	}
+	if p.closed || missing <= 0 {
+		p.Unlock()
+		return
+	}
+	p.open += missing
+	p.Unlock()
+	for i := 0; i < missing; i++ {
+		entry, err := p.dial()
+		p.Lock()
+		if err != nil || p.closed {
+			p.open--
+			p.Unlock()
+			if err != nil {
+				p.logger.Errorf("TcpClientPool.fill() - Dialing a new client - Error: %v", err)
+			} else {
+				_ = entry.client.Close()
+			}
+			continue
+		}
+		entry.released = time.Now()
+		p.idle = append(p.idle, entry)
+		p.Unlock()
+		p.notify()
+	}
+}
+
+func (p *tcpClientPool) maintenanceInterval() time.Duration {
+	var interval = PoolMaintenanceInterval
+	for _, timeout := range []time.Duration{p.pool.IdleTimeout / 2, p.pool.MaxLifetime / 2} {
+		if timeout > 0 && timeout < interval {
+			interval = timeout
+		}
+	}
+	return interval
+}
+
+func (p *tcpClientPool) maintenance() {
+	var ticker = time.NewTicker(p.maintenanceInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.maintain()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Creates a pool of clients connected to the server described by the given configuration, using the configuration
+// pool properties. The minimum number of idle clients is dialed before returning, reporting any connection error.
+// Clients should use the LengthPrefixedFraming protocol, because in raw mode the server closes the connection
+// after each request.
+func NewTcpClientPool(config model.TcpClientConfig, appName string, verbosity log.LogLevel) (model.TcpClientPool, error) {
+	if config.Network == "" {
+		return nil, errors.New(fmt.Sprint("Invalid network value"))
+	}
+	var pool = model.TcpClientPoolConfig{}
+	if config.Pool != nil {
+		pool = *config.Pool
+	}
+	if pool.MaxIdle > 0 && pool.MinIdle > pool.MaxIdle {
+		return nil, errors.New(fmt.Sprintf("Minimum idle clients %v exceed the maximum idle clients %v", pool.MinIdle, pool.MaxIdle))
+	}
+	if pool.MaxOpen > 0 && pool.MinIdle > pool.MaxOpen {
+		return nil, errors.New(fmt.Sprintf("Minimum idle clients %v exceed the maximum open clients %v", pool.MinIdle, pool.MaxOpen))
+	}
+	var size = pool.MaxOpen
+	if size <= 0 {
+		size = 1
+	}
+	var p = &tcpClientPool{
+		config:    config,
+		pool:      pool,
+		idle:      make([]*pooledClient, 0),
+		inUse:     make(map[model.TcpClient]*pooledClient),
+		available: make(chan struct{}, size),
+		done:      make(chan struct{}),
+		appName:   appName,
+		verbosity: verbosity,
+		logger:    log.NewLogger(appName, verbosity),
+	}
+	for i := 0; i < pool.MinIdle; i++ {
+		entry, err := p.dial()
+		if err != nil {
+			for _, entry := range p.idle {
+				_ = entry.client.Close()
+			}
+			return nil, err
+		}
+		entry.released = time.Now()
+		p.idle = append(p.idle, entry)
+		p.open++
+	}
+	go p.maintenance()
+	return p, nil
+}
@@ -0,0 +1,135 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	"github.com/hellgate75/go-network/tcp/builders"
+	"github.com/hellgate75/go-network/testsuite"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Creates a pool of clients connected to the given local port
+func newTestPool(t *testing.T, port int, pool model.TcpClientPoolConfig) model.TcpClientPool {
+	clientConfig, err := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		WithPool(pool).
+		Build()
+	testsuite.AssertNil(t, "Client config error must be nil", err)
+	clients, err := NewTcpClientPool(clientConfig, "Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Pool error must be nil", err)
+	return clients
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	server, port := startFramedServer(t, incrementAction("increment"))
+	defer server.Stop()
+	clients := newTestPool(t, port, model.TcpClientPoolConfig{MaxOpen: 1})
+	defer clients.Close()
+
+	client, err := clients.Borrow(context.Background())
+	testsuite.AssertNil(t, "Borrow error must be nil", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = clients.Borrow(ctx)
+	testsuite.AssertEquals(t, "Borrow must wait until the context is done", context.DeadlineExceeded, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = clients.Release(client)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	other, err := clients.Borrow(ctx)
+	testsuite.AssertNil(t, "Borrow must receive the released client", err)
+	testsuite.AssertEquals(t, "Released client must be reused", client, other)
+	var stats = clients.Stats()
+	testsuite.AssertEquals(t, "Pool must not exceed the maximum open clients", 1, stats.Open)
+	testsuite.AssertEquals(t, "Pool must dial a single client", int64(1), stats.Dialed)
+	testsuite.AssertEquals(t, "Pool must count the waiting borrows", int64(2), stats.Waits)
+	var response counter
+	testsuite.AssertNil(t, "Release error must be nil", clients.Release(other))
+	testsuite.AssertNil(t, "Pool call error must be nil", clients.Call(ctx, "increment", &counter{Value: 1}, &response))
+	testsuite.AssertEquals(t, "Pool call must receive the response", 2, response.Value)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	server, port := startFramedServer(t, incrementAction("increment"))
+	defer server.Stop()
+	var lock sync.Mutex
+	var unhealthy model.TcpClient
+	clients := newTestPool(t, port, model.TcpClientPoolConfig{
+		HealthCheck: func(client model.TcpClient) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if client == unhealthy {
+				return errors.New("unhealthy client")
+			}
+			return nil
+		},
+	})
+	defer clients.Close()
+
+	client, _ := clients.Borrow(context.Background())
+	testsuite.AssertNil(t, "Release error must be nil", clients.Release(client))
+	lock.Lock()
+	unhealthy = client
+	lock.Unlock()
+	other, err := clients.Borrow(context.Background())
+	testsuite.AssertNil(t, "Borrow error must be nil", err)
+	testsuite.AssertNotEquals(t, "Unhealthy client must not be borrowed", client, other)
+	testsuite.AssertEquals(t, "Unhealthy client must be closed", false, client.IsOpen())
+	var stats = clients.Stats()
+	testsuite.AssertEquals(t, "Unhealthy client must be evicted", int64(1), stats.Evicted)
+	testsuite.AssertEquals(t, "Pool must dial a new client", int64(2), stats.Dialed)
+	testsuite.AssertEquals(t, "Pool must count the open clients", 1, stats.Open)
+}
+
+func TestPoolIdleTimeoutAndMaxLifetime(t *testing.T) {
+	server, port := startFramedServer(t, incrementAction("increment"))
+	defer server.Stop()
+
+	idleClients := newTestPool(t, port, model.TcpClientPoolConfig{IdleTimeout: 50 * time.Millisecond})
+	defer idleClients.Close()
+	client, _ := idleClients.Borrow(context.Background())
+	testsuite.AssertNil(t, "Release error must be nil", idleClients.Release(client))
+	testsuite.AssertEquals(t, "Released client must be idle", 1, idleClients.Stats().Idle)
+	time.Sleep(200 * time.Millisecond)
+	var stats = idleClients.Stats()
+	testsuite.AssertEquals(t, "Idle client must be evicted after the idle timeout", 0, stats.Idle)
+	testsuite.AssertEquals(t, "Evicted idle client must be counted", int64(1), stats.Evicted)
+	testsuite.AssertEquals(t, "Evicted idle client must be closed", false, client.IsOpen())
+
+	lifetimeClients := newTestPool(t, port, model.TcpClientPoolConfig{MinIdle: 1, MaxLifetime: 100 * time.Millisecond})
+	defer lifetimeClients.Close()
+	borrowed, _ := lifetimeClients.Borrow(context.Background())
+	time.Sleep(150 * time.Millisecond)
+	testsuite.AssertNil(t, "Release error must be nil", lifetimeClients.Release(borrowed))
+	testsuite.AssertEquals(t, "Expired client must be closed when released", false, borrowed.IsOpen())
+	time.Sleep(100 * time.Millisecond)
+	stats = lifetimeClients.Stats()
+	testsuite.AssertEquals(t, "Pool must keep the minimum idle clients", 1, stats.Idle)
+	testsuite.AssertEquals(t, "Expired clients must be replaced", true, stats.Dialed >= 2)
+	testsuite.AssertEquals(t, "Expired clients must be evicted", true, stats.Evicted >= 1)
+}
+
+func TestPoolCloseWithBorrowedClients(t *testing.T) {
+	server, port := startFramedServer(t, incrementAction("increment"))
+	defer server.Stop()
+	clients := newTestPool(t, port, model.TcpClientPoolConfig{MinIdle: 1})
+
+	borrowed, _ := clients.Borrow(context.Background())
+	idle, _ := clients.Borrow(context.Background())
+	testsuite.AssertNil(t, "Release error must be nil", clients.Release(idle))
+	testsuite.AssertNil(t, "Close error must be nil", clients.Close())
+	testsuite.AssertEquals(t, "Idle clients must be closed", false, idle.IsOpen())
+	testsuite.AssertEquals(t, "Borrowed clients must stay open", true, borrowed.IsOpen())
+	_, err := clients.Borrow(context.Background())
+	testsuite.AssertNotNil(t, "Closed pool must reject borrows", err)
+	testsuite.AssertNil(t, "Release error must be nil", clients.Release(borrowed))
+	testsuite.AssertEquals(t, "Clients released after close must be closed", false, borrowed.IsOpen())
+	testsuite.AssertEquals(t, "Closed pool must have no open clients", 0, clients.Stats().Open)
+	testsuite.AssertNotNil(t, "Pool must not be closed twice", clients.Close())
+}
@@ -1,44 +1,47 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/hellgate75/go-network/log"
 	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
 	"github.com/hellgate75/go-network/tcp/stream"
+	"io"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
-type Signal byte
-
-const (
-	shutdown	Signal = iota + 1
-	purge
-	exit
-)
-
 var (
+	// Maximum time Stop waits for the in-flight requests, before closing the connections
 	ServerWaitTimeout = 120 * time.Second
+	// Maximum time for completing the TLS handshake of an accepted connection
+	ServerHandshakeTimeout = 10 * time.Second
 )
+
 type tcpServer struct {
 	sync.Mutex
 	config			*model.TcpServerConfig
 	running			bool
-	internal		chan Signal
-	commands		chan Signal
+	done			chan struct{}
+	drained			chan struct{}
+	connections		map[net.Conn]struct{}
 	logger			log.Logger
 	activeRequests	int64
 	handlers		[]*model.TcpCallHandler
 	tcpListener		*net.Listener
-	timer			*time.Ticker
 	serverMap		map[string]interface{}
+	interceptors	[]model.TcpInterceptor
+	connectionInterceptors	[]model.TcpConnectionInterceptor
 }
 
 func(server *tcpServer) Init(config model.TcpServerConfig) (model.TcpServer, error) {
-	if server.running {
+	if server.Running() {
 		return server, errors.New(fmt.Sprint("TcpServer.Init() - Server is still running"))
 	}
 	server.config = &config
@@ -53,7 +56,7 @@ func(server *tcpServer) Start() error {
 			server.logger.Fatalf("TcpServer.Start() -  Error: %v", err)
 		}
 	}()
-	if server.running {
+	if server.Running() {
 		server.logger.Fatal("TcpServer.Start() - Error: Server already running")
 		return errors.New(fmt.Sprint("TcpServer.Start() - Error: Server already running"))
 	}
@@ -61,23 +64,43 @@ func(server *tcpServer) Start() error {
 		server.logger.Fatal("TcpServer.Start() - Error: No server configuration provided")
 		return errors.New(fmt.Sprint("TcpServer.Start() - Error: No server configuration provided"))
 	}
-	server.internal = make(chan Signal)
-	server.commands = make(chan Signal)
 	var address = fmt.Sprintf("%s:%v", server.config.Host, server.config.Port)
 	if server.config.Port <= 0 {
 		address = fmt.Sprintf("%s", server.config.Host)
 	}
+	if isDatagramNetwork(server.config.Network) {
+		server.logger.Errorf("TcpServer.Start() - Error: Datagram network %s requires the datagram server", server.config.Network)
+		return errors.New(fmt.Sprintf("TcpServer.Start() - Error: Datagram network %s requires the datagram server", server.config.Network))
+	}
+	if isUnixNetwork(server.config.Network) {
+		err = removeStaleSocket(address)
+		if err != nil {
+			server.logger.Errorf("TcpServer.Start() - Server failed to start on: %s, due to error: %v", address, err)
+			return err
+		}
+	}
 	var l net.Listener
 	if server.config.Config != nil {
 		l, err = tls.Listen(server.config.Network, address, server.config.Config)
 	} else {
 		l, err = net.Listen(server.config.Network, address)
 	}
+	if err == nil && isUnixNetwork(server.config.Network) && server.config.SocketMode != 0 {
+		err = os.Chmod(address, server.config.SocketMode)
+		if err != nil {
+			_ = l.Close()
+		}
+	}
 	if err == nil {
+		server.Lock()
 		server.running = true
-		server.logger.Infof("TcpServer.Start() - Server started on: %s", address)
+		server.done = make(chan struct{})
+		server.drained = nil
+		server.connections = make(map[net.Conn]struct{})
 		server.tcpListener = &l
-		go server.acceptClients()
+		server.Unlock()
+		server.logger.Infof("TcpServer.Start() - Server started on: %s", address)
+		go server.acceptClients(l)
 	} else {
 		server.logger.Errorf("TcpServer.Start() - Server failed to start on: %s, due to error: %v", address, err)
 		server.tcpListener = nil
@@ -85,6 +108,32 @@ func(server *tcpServer) Start() error {
 	return err
 }
 
+// Reports if the given network is a unix socket network
+func isUnixNetwork(network string) bool {
+	return strings.HasPrefix(network, "unix")
+}
+
+// Removes the socket file left by a server not stopped properly, any other kind of file is reported as error.
+// Listening unix sockets are removed by the server when it stops.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(fmt.Sprintf("File %s exists and it is not a socket", path))
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		_ = conn.Close()
+		return errors.New(fmt.Sprintf("Socket %s is in use", path))
+	}
+	return os.Remove(path)
+}
+
 func (server *tcpServer) handleConnection(conn net.Conn) {
 	var err error
 	defer func() {
@@ -102,19 +151,38 @@ func (server *tcpServer) handleConnection(conn net.Conn) {
 				server.logger.Fatalf("TcpServer.handleConnection() - Close connection with address %+v - Error: %v", addr, err)
 			}
 		}()
-		rwCloser := stream.NewConnReaderWriterCloser()
+		var connectionMap = make(map[string]interface{})
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			err = handshake(tlsConn, connectionMap)
+			if err != nil {
+				server.logger.Warnf("TcpServer.handleConnection() - TLS handshake with %+v failed - Error: %v", addr, err)
+				return
+			}
+		}
+		conn, err = server.intercept(conn, connectionMap)
+		if err != nil {
+			server.logger.Warnf("TcpServer.handleConnection() - Connection from %+v rejected - Error: %v", addr, err)
+			return
+		}
+		// Connection context carries the connection map filled by the interceptors
+		ctx := context2.WithConnectionMap(context.Background(), connectionMap)
+		if server.config.Framing == model.LengthPrefixedFraming {
+			server.serveFrames(ctx, conn)
+			return
+		}
+		rwCloser := stream.NewConnReaderWriterCloserContext(ctx)
 		rwCloser.Enroll(conn)
 		var wg = sync.WaitGroup{}
 		for _, handler := range server.handlers{
 			if handler != nil {
-				go func(connection net.Conn, rw stream.ConnReaderWriterCloser) {
-					wg.Add(1)
+				wg.Add(1)
+				go func(handler *model.TcpCallHandler, connection net.Conn, rw stream.ConnReaderWriterCloser) {
 					server.register()
 					server.logger.Debugf("Handling request from %+v to handler named: %s", addr, (*handler).GetName())
 					(*handler).HandleRequest(connection, rw)
 					server.deregister()
 					wg.Done()
-				}(conn, rwCloser)
+				}(handler, conn, rwCloser)
 			}
 		}
 		time.Sleep(1 * time.Second)
@@ -129,50 +197,194 @@ func (server *tcpServer) handleConnection(conn net.Conn) {
 	}
 }
 
-func (server *tcpServer) acceptClients() {
-	var err error
+// Completes the TLS handshake before the connection interceptors run, storing the verified client certificate
+// in the connection map, so the interceptors can authenticate the client
+func handshake(conn *tls.Conn, connectionMap map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ServerHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	var state = conn.ConnectionState()
+	if peer := context2.NewPeerCertificate(&state); peer != nil {
+		connectionMap[context2.PeerCertificateKey] = peer
+	}
+	return nil
+}
+
+// Reads length-prefixed request messages from the connection until the peer closes it, and dispatches
+// each message to the registered handlers concurrently, so many calls can be multiplexed on the
+// same connection. Responses carry the request message identifier.
+func (server *tcpServer) serveFrames(parent context.Context, conn net.Conn) {
+	addr := conn.RemoteAddr()
+	frames := stream.NewLengthPrefixedFrameReaderWriter(conn, server.config.MaxFrameSize)
+	// Connection context is cancelled when the client disconnects
+	ctx, cancel := context.WithCancel(parent)
+	var wg = sync.WaitGroup{}
 	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("TcpServer.acceptClients() - Error: %v", r))
-			server.logger.Fatalf("TcpServer.acceptClients() - Error: %v", err)
+		if server.Running() {
+			// Client disconnected: the in-flight requests are cancelled
+			cancel()
 		}
+		wg.Wait()
+		cancel()
 	}()
-	if server.tcpListener != nil {
-		for server.running{
-			var conn net.Conn
-			conn, err = (*server.tcpListener).Accept()
-			if err != nil{
-				server.logger.Errorf("TcpServer.acceptClients() - Acceptance Error: %v", err)
-				continue
+	for server.Running() {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			if err != io.EOF && server.Running() {
+				server.logger.Errorf("TcpServer.serveFrames() - Reading frame from %+v - Error: %v", addr, err)
 			}
-			server.logger.Debugf("TcpServer.acceptClients() - Handling request from: %+v ...", conn.RemoteAddr())
-			go server.handleConnection(conn)
+			return
 		}
-	} else {
-		server.logger.Fatalf("TcpServer.acceptClients() - Invalid listener - Stopping server ...")
-		err = server.Stop()
-		server.logger.Error(err)
+		msg, err := stream.DecodeMessage(frame)
+		if err != nil {
+			server.logger.Errorf("TcpServer.serveFrames() - Decoding message from %+v - Error: %v", addr, err)
+			return
+		}
+		if msg.Type == stream.PingMessage {
+			server.pong(conn, frames, msg)
+			continue
+		}
+		if msg.Type != stream.RequestMessage {
+			server.logger.Warnf("TcpServer.serveFrames() - Discarding message of type %v from %+v", msg.Type, addr)
+			continue
+		}
+		wg.Add(1)
+		server.register()
+		go func(request stream.Message) {
+			defer func() {
+				server.deregister()
+				wg.Done()
+			}()
+			server.dispatch(ctx, conn, frames, request)
+		}(msg)
+	}
+}
+
+// Answers a client heartbeat message, with a pong message carrying the same identifier
+func (server *tcpServer) pong(conn net.Conn, frames stream.FrameReaderWriter, ping stream.Message) {
+	data, err := stream.EncodeMessage(stream.Message{
+		Type: stream.PongMessage,
+		Id:   ping.Id,
+	})
+	if err == nil {
+		err = frames.WriteFrame(data)
+	}
+	if err != nil {
+		server.logger.Errorf("TcpServer.pong() - Answering heartbeat to %+v - Error: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// Routes a request message to the handler owning the requested action, or answers with an unknown action
+// error message. Messages with no action name are answered with the unknown action error too, the broadcast
+// to every registered handler is left to the raw (unframed) connections.
+func (server *tcpServer) dispatch(ctx context.Context, conn net.Conn, frames stream.FrameReaderWriter, request stream.Message) {
+	addr := conn.RemoteAddr()
+	if request.Action != "" {
+		if handler := server.findHandler(request.Action); handler != nil {
+			server.logger.Debugf("Handling message %s from %+v to action %s of handler named: %s", request.Id, addr, request.Action, (*handler).GetName())
+			(*handler).HandleRequest(conn, stream.NewMessageReaderWriterCloser(ctx, request, frames))
+			return
+		}
+	}
+	server.logger.Warnf("TcpServer.dispatch() - Unknown action %s requested from %+v", request.Action, addr)
+	err := answerUnknownAction(frames, request)
+	if err != nil {
+		server.logger.Errorf("TcpServer.dispatch() - Answering unknown action to %+v - Error: %v", addr, err)
 	}
 }
 
-func (server *tcpServer) shutdownTimer() {
-	server.timer = time.NewTicker(5 * time.Second)
+// Answers the request with the unknown action error message
+func answerUnknownAction(frames stream.FrameReaderWriter, request stream.Message) error {
+	data, err := stream.EncodeMessage(stream.Message{
+		Type:   stream.ErrorMessage,
+		Id:     request.Id,
+		Action: request.Action,
+		Code:   string(model.UnknownActionError),
+		Body:   []byte(fmt.Sprintf("No handler registered for action: %s", request.Action)),
+	})
+	if err != nil {
+		return err
+	}
+	return frames.WriteFrame(data)
+}
+
+// Runs the connection interceptors on an accepted connection, the returned connection replaces the accepted one
+func (server *tcpServer) intercept(conn net.Conn, connectionMap map[string]interface{}) (net.Conn, error) {
+	for _, interceptor := range server.connectionInterceptors {
+		next, err := interceptor(conn, connectionMap)
+		if err != nil {
+			return conn, err
+		}
+		if next != nil {
+			conn = next
+		}
+	}
+	return conn, nil
+}
+
+func (server *tcpServer) findHandler(action string) *model.TcpCallHandler {
+	for _, handler := range server.handlers {
+		if handler == nil {
+			continue
+		}
+		for _, name := range (*handler).Names() {
+			if name == action {
+				return handler
+			}
+		}
+	}
+	return nil
+}
+
+func (server *tcpServer) acceptClients(listener net.Listener) {
+	var err error
 	defer func() {
-		server.timer.Stop()
-		server.timer = nil
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("TcpServer.acceptClients() - Error: %v", r))
+			server.logger.Fatalf("TcpServer.acceptClients() - Error: %v", err)
+		}
 	}()
-	for {
-		select {
-		case <- server.timer.C:
-			if server.checkExit() {
-				server.evacuate()
+	for server.Running() {
+		var conn net.Conn
+		conn, err = listener.Accept()
+		if err != nil{
+			if !server.Running() {
 				return
 			}
-
+			server.logger.Errorf("TcpServer.acceptClients() - Acceptance Error: %v", err)
+			continue
 		}
+		if !server.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		server.logger.Debugf("TcpServer.acceptClients() - Handling request from: %+v ...", conn.RemoteAddr())
+		go func(conn net.Conn) {
+			defer server.untrack(conn)
+			server.handleConnection(conn)
+		}(conn)
 	}
 }
 
+// Tracks an accepted connection, it returns false when the server is shutting down
+func (server *tcpServer) track(conn net.Conn) bool {
+	defer server.Unlock()
+	server.Lock()
+	if !server.running {
+		return false
+	}
+	server.connections[conn] = struct{}{}
+	return true
+}
+
+func (server *tcpServer) untrack(conn net.Conn) {
+	defer server.Unlock()
+	server.Lock()
+	delete(server.connections, conn)
+	server.checkDrained()
+}
 
 func (server *tcpServer) register() {
 	defer server.Unlock()
@@ -184,83 +396,95 @@ func (server *tcpServer) deregister() {
 	defer server.Unlock()
 	server.Lock()
 	server.activeRequests--
+	server.checkDrained()
 }
 
-func (server *tcpServer) checkExit() bool {
-	if ! server.Running() && ! server.Working() {
-		server.internal <- exit
-		return true
+// Signals the shutdown in progress that no connection and no request is left, it must be called holding the lock
+func (server *tcpServer) checkDrained() {
+	if server.drained != nil && len(server.connections) == 0 && server.activeRequests <= 0 {
+		close(server.drained)
+		server.drained = nil
 	}
-	return false
 }
 
-
-func (server *tcpServer) evacuate() {
-	close(server.internal)
-	server.internal = nil
-	close(server.commands)
-	server.commands = nil
+func(server *tcpServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ServerWaitTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
 }
 
-func(server *tcpServer) Stop() error {
+func(server *tcpServer) Shutdown(ctx context.Context) error {
 	var err error
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprintf("TcpServer.Stop() - Error: %v", r))
-			server.logger.Fatalf("TcpServer.Stop() -  Error: %v", err)
+			err = errors.New(fmt.Sprintf("TcpServer.Shutdown() - Error: %v", r))
+			server.logger.Fatalf("TcpServer.Shutdown() -  Error: %v", err)
 		}
 	}()
+	server.Lock()
 	if ! server.running {
-		err = errors.New(fmt.Sprint("TcpServer.Stop() - Error: Server is already stopped"))
-		server.logger.Errorf("TcpServer.Stop() -  %v", err)
+		server.Unlock()
+		err = errors.New(fmt.Sprint("TcpServer.Shutdown() - Error: Server is already stopped"))
+		server.logger.Errorf("TcpServer.Shutdown() -  %v", err)
 		return err
 	}
-	server.internal <- shutdown
-	go server.shutdownTimer()
 	server.running = false
+	defer close(server.done)
 	if server.tcpListener != nil {
-		err := (*server.tcpListener).Close()
+		err = (*server.tcpListener).Close()
 		if err != nil {
-			server.logger.Errorf("TcpServer.Stop() - Gently shutting down server error occurred: %v", err)
-			server.logger.Warnf("TcpServer.Stop() - Try brute-force server close ...")
-			server.activeRequests = 0
+			server.logger.Errorf("TcpServer.Shutdown() - Closing listener error occurred: %v", err)
 		}
 		server.tcpListener = nil
 	}
-	return err
+	if server.config.Framing == model.LengthPrefixedFraming {
+		// Stops reading new requests, in-flight requests can still write their responses
+		for conn := range server.connections {
+			_ = conn.SetReadDeadline(time.Now())
+		}
+	}
+	var drained = make(chan struct{})
+	server.drained = drained
+	server.logger.Infof("TcpServer.Shutdown() - Waiting for %v connections and %v in-flight requests ...", len(server.connections), server.activeRequests)
+	server.checkDrained()
+	server.Unlock()
+	select {
+	case <-drained:
+		return err
+	case <-ctx.Done():
+	}
+	server.logger.Warnf("TcpServer.Shutdown() - Deadline reached, closing remaining connections ...")
+	server.Lock()
+	server.drained = nil
+	for conn := range server.connections {
+		_ = conn.Close()
+	}
+	server.Unlock()
+	return ctx.Err()
 }
 
 func(server *tcpServer) Running() bool {
+	defer server.Unlock()
+	server.Lock()
 	return server.running
 }
 
 func(server *tcpServer) Working() bool {
+	defer server.Unlock()
+	server.Lock()
 	return server.activeRequests > 0
 }
 
 func(server *tcpServer) Wait() {
-	defer func() {
-		if r := recover(); r != nil {
-			server.logger.Fatalf("TcpServer.Wait() - Fatal Error: %v", r)
-		}
-	}()
-	server.logger.Debugf("TcpServer.Wait() - Waiting for server shutdown")
-waitCycle:
-	for server.Running() || server.Working() {
-		select {
-		case sig := <- server.internal:
-			if sig == shutdown {
-				server.commands	<- purge
-			} else if sig == exit {
-				break waitCycle
-			}
-		case <- time.After(ServerWaitTimeout):
-			continue
-		}
+	server.Lock()
+	var done = server.done
+	server.Unlock()
+	if done == nil {
+		return
 	}
-	server.logger.Warnf("TcpServer.Wait() - Server shutdown in progress, exiting ...")
-	time.Sleep(10 * time.Second)
-	server.logger.Warnf("TcpServer.Wait() - exit")
+	server.logger.Debugf("TcpServer.Wait() - Waiting for server shutdown")
+	<-done
+	server.logger.Debugf("TcpServer.Wait() - exit")
 }
 func(server *tcpServer) containsHandler(name string) bool {
 	for _, handler := range server.handlers {
@@ -271,6 +495,16 @@ func(server *tcpServer) containsHandler(name string) bool {
 	return false
 }
 
+// Returns the first of the given action names already registered by an handler, or empty
+func(server *tcpServer) containsAction(names []string) string {
+	for _, name := range names {
+		if server.findHandler(name) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
 func(server *tcpServer) AddPath(handler model.TcpCallHandler) error {
 	var err error
 	defer func() {
@@ -286,17 +520,43 @@ func(server *tcpServer) AddPath(handler model.TcpCallHandler) error {
 	} else if server.containsHandler(name) {
 		err = errors.New(fmt.Sprintf("Provided handler has duplicsted handler with name: %s", name))
 		server.logger.Warnf("TcpServer.AddPath() - Duplicated Tcp handler with name: %s", name)
+	} else if action := server.containsAction(handler.Names()); action != "" {
+		err = errors.New(fmt.Sprintf("Provided handler has duplicated action with name: %s", action))
+		server.logger.Warnf("TcpServer.AddPath() - Duplicated Tcp action with name: %s", action)
 	} else {
 		server.logger.Debugf("TcpServer.AddPath() - Duplicated Tcp handler with name: %s", name)
 		handler.SetServerMap(&server.serverMap)
 		handler.SetLogger(server.logger)
 		handler.SetEncoding(server.config.Encoding)
+		handler.SetInterceptors(&server.interceptors)
 		server.handlers = append(server.handlers, &handler)
 		server.logger.Debugf("TcpServer.AddPath() - Adding Tcp handler with name: %s", name)
 	}
 	return err
 }
 
+func(server *tcpServer) Use(interceptors ...model.TcpInterceptor) {
+	defer server.Unlock()
+	server.Lock()
+	for _, i := range interceptors {
+		if i != nil {
+			server.interceptors = append(server.interceptors, i)
+		}
+	}
+	server.logger.Debugf("TcpServer.Use() - Server interceptors count: %v", len(server.interceptors))
+}
+
+func(server *tcpServer) UseOnAccept(interceptors ...model.TcpConnectionInterceptor) {
+	defer server.Unlock()
+	server.Lock()
+	for _, i := range interceptors {
+		if i != nil {
+			server.connectionInterceptors = append(server.connectionInterceptors, i)
+		}
+	}
+	server.logger.Debugf("TcpServer.UseOnAccept() - Connection interceptors count: %v", len(server.connectionInterceptors))
+}
+
 func NewTcpServer(appName string, verbosity log.LogLevel) model.TcpServer {
 	return &tcpServer{
 		config: nil,
@@ -304,7 +564,8 @@ func NewTcpServer(appName string, verbosity log.LogLevel) model.TcpServer {
 		logger: log.NewLogger(appName, verbosity),
 		handlers: make([]*model.TcpCallHandler, 0),
 		tcpListener: nil,
-		timer: nil,
 		serverMap: make(map[string]interface{}),
+		interceptors: make([]model.TcpInterceptor, 0),
+		connectionInterceptors: make([]model.TcpConnectionInterceptor, 0),
 	}
 }
\ No newline at end of file
@@ -0,0 +1,250 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/hellgate75/go-network/certs"
+	"github.com/hellgate75/go-network/log"
+	"github.com/hellgate75/go-network/model"
+	context2 "github.com/hellgate75/go-network/model/context"
+	"github.com/hellgate75/go-network/tcp/builders"
+	"github.com/hellgate75/go-network/tcp/interceptors"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+type whoAmI struct {
+	Name string `json:"name"`
+}
+
+func TestMutualTls(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "mtls")
+	defer os.RemoveAll(dir)
+	ca, err := certs.NewAuthority("Test CA", certs.ECDSA, time.Hour)
+	testsuite.AssertNil(t, "Authority error must be nil", err)
+	serverCert, _ := ca.IssueServer("localhost", "127.0.0.1")
+	serverFiles, err := serverCert.Write(dir, "server")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	clientCert, _ := ca.IssueClient("billing", "spiffe://acme.com/billing")
+	clientFiles, err := clientCert.Write(dir, "billing")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+	other, _ := certs.NewAuthority("Other CA", certs.RSA, time.Hour)
+	otherCert, _ := other.IssueClient("billing")
+	otherFiles, err := otherCert.Write(dir+"/other", "billing")
+	testsuite.AssertNil(t, "Write error must be nil", err)
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var port = l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+	config, err := builders.NewTcpServerConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		UseTlsEncryption(true).
+		WithTLSCerts(serverFiles.CertPath, serverFiles.KeyPath).
+		WithClientCaCert(serverFiles.CaPath).
+		Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewTcpServer("Test Tcp Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	server.UseOnAccept(interceptors.ClientCertificate(model.SubjectRoles(map[string][]string{"billing": {"reader"}})))
+	handler, err := builders.NewTcpCallHandlerBuilder().WithName("identity").
+		WithTcpHandling(builders.NewTcpActionBuilder().WithName("who-am-i").With(func(c context2.TcpContext) error {
+			return c.WriteResponse(&whoAmI{Name: fmt.Sprintf("%s %v %s", c.Principal.Name, c.Principal.Roles, c.PeerCertificate.URIs[0])})
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "Handler error must be nil", err)
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+
+	var call = func(files certs.Files) (string, error) {
+		clientConfig, err := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+			WithFraming(model.LengthPrefixedFraming, 0).
+			UseTlsEncryption(true).
+			WithTLSCerts(files.CertPath, files.KeyPath).
+			WithRootCaCert(serverFiles.CaPath).
+			Build()
+		testsuite.AssertNil(t, "Client config error must be nil", err)
+		client := NewTcpClient("Test Tcp Client", log.FATAL)
+		if err := client.Connect(clientConfig); err != nil {
+			return "", err
+		}
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var response whoAmI
+		err = client.Call(ctx, "who-am-i", &whoAmI{}, &response)
+		return response.Name, err
+	}
+	name, err := call(clientFiles)
+	testsuite.AssertNil(t, "Trusted client call error must be nil", err)
+	testsuite.AssertEquals(t, "Action must see the certificate identity", "billing [reader] spiffe://acme.com/billing", name)
+	_, err = call(otherFiles)
+	testsuite.AssertNotNil(t, "Client of an untrusted authority must be rejected", err)
+}
+
+func TestEmptyAction(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var port = l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+	config, err := builders.NewTcpServerConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewTcpServer("Test Tcp Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	var calls = 0
+	handler, _ := builders.NewTcpCallHandlerBuilder().WithName("identity").
+		WithTcpHandling(builders.NewTcpActionBuilder().WithName("who-am-i").With(func(c context2.TcpContext) error {
+			calls++
+			return c.WriteResponse(&whoAmI{Name: "server"})
+		}).Build()).
+		Build()
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start error must be nil", server.Start())
+	defer server.Stop()
+
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var response whoAmI
+	err = client.Call(ctx, "", &whoAmI{}, &response)
+	tcpErr, ok := err.(*model.TcpError)
+	testsuite.AssertEquals(t, "Empty action must be answered with a TcpError", true, ok)
+	testsuite.AssertEquals(t, "Empty action must be an unknown action", model.UnknownActionError, tcpErr.Code)
+	testsuite.AssertEquals(t, "Empty action must not run the actions", 0, calls)
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	var started = make(chan struct{}, 1)
+	var finished = make(chan struct{}, 1)
+	server, port := startFramedServer(t, builders.NewTcpActionBuilder().WithName("slow-increment").With(func(c context2.TcpContext) error {
+		var request counter
+		if err := c.ParseRequest(&request); err != nil {
+			return err
+		}
+		started <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		request.Value++
+		err := c.WriteResponse(&request)
+		finished <- struct{}{}
+		return err
+	}).Build())
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithHost("127.0.0.1", port).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	var call = func(action string, response *counter) chan error {
+		var result = make(chan error, 1)
+		client := NewTcpClient("Test Tcp Client", log.FATAL)
+		testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+		go func() {
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result <- client.Call(ctx, action, &counter{Value: 1}, response)
+		}()
+		<-started
+		return result
+	}
+
+	// In-flight requests complete before the shutdown returns
+	var response counter
+	var result = call("slow-increment", &response)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	testsuite.AssertNil(t, "Shutdown error must be nil", server.Shutdown(ctx))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("In-flight request must complete before the shutdown returns")
+	}
+	select {
+	case err := <-result:
+		testsuite.AssertNil(t, "In-flight call error must be nil", err)
+		testsuite.AssertEquals(t, "In-flight call must receive the response", 2, response.Value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("In-flight call must receive the response")
+	}
+	testsuite.AssertEquals(t, "Server must not be running after shutdown", false, server.Running())
+
+	// Remaining connections are closed at the deadline
+	server, port = startFramedServer(t, builders.NewTcpActionBuilder().WithName("wait").With(func(c context2.TcpContext) error {
+		started <- struct{}{}
+		select {
+		case <-c.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return nil
+	}).Build())
+	clientConfig.Port = port
+	result = call("wait", &response)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	testsuite.AssertEquals(t, "Shutdown must return the context error at the deadline", context.DeadlineExceeded, server.Shutdown(ctx))
+	testsuite.AssertEquals(t, "Shutdown must not wait the running requests", true, time.Since(start) < 2*time.Second)
+	select {
+	case err := <-result:
+		testsuite.AssertNotNil(t, "Call on a closed connection must fail", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Remaining connections must be closed at the deadline")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "unix")
+	defer os.RemoveAll(dir)
+	var path = dir + "/test.sock"
+	// Socket file left by a server not stopped properly
+	stale, err := net.Listen("unix", path)
+	testsuite.AssertNil(t, "Listen error must be nil", err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	config, err := builders.NewTcpServerConfigBuilder().WithNetwork("unix").WithHost(path, 0).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		WithSocketMode(0600).
+		Build()
+	testsuite.AssertNil(t, "Config error must be nil", err)
+	server, err := NewTcpServer("Test Tcp Server", log.ERROR).Init(config)
+	testsuite.AssertNil(t, "Init error must be nil", err)
+	handler, _ := builders.NewTcpCallHandlerBuilder().WithName("test").WithTcpHandling(incrementAction("increment")).Build()
+	testsuite.AssertNil(t, "AddPath error must be nil", server.AddPath(handler))
+	testsuite.AssertNil(t, "Start must remove the stale socket", server.Start())
+	info, err := os.Stat(path)
+	testsuite.AssertNil(t, "Socket file must exist", err)
+	testsuite.AssertEquals(t, "Socket file must be a socket", true, info.Mode()&os.ModeSocket != 0)
+	testsuite.AssertEquals(t, "Socket file must have the configured mode", os.FileMode(0600), info.Mode().Perm())
+	other, _ := NewTcpServer("Test Tcp Server", log.FATAL).Init(config)
+	testsuite.AssertNotNil(t, "Socket in use must not be removed", other.Start())
+
+	clientConfig, _ := builders.NewTcpClientConfigBuilder().WithNetwork("unix").WithHost(path, 0).
+		WithFraming(model.LengthPrefixedFraming, 0).
+		Build()
+	client := NewTcpClient("Test Tcp Client", log.FATAL)
+	testsuite.AssertNil(t, "Connect error must be nil", client.Connect(clientConfig))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var response counter
+	testsuite.AssertNil(t, "Call error must be nil", client.Call(ctx, "increment", &counter{Value: 1}, &response))
+	testsuite.AssertEquals(t, "Call must receive the response", 2, response.Value)
+	_ = client.Close()
+	testsuite.AssertNil(t, "Stop error must be nil", server.Stop())
+	_, err = os.Stat(path)
+	testsuite.AssertEquals(t, "Socket file must be removed when the server stops", true, os.IsNotExist(err))
+
+	// Any other kind of file is not removed
+	testsuite.AssertNil(t, "Write error must be nil", ioutil.WriteFile(path, []byte("data"), 0600))
+	server, _ = NewTcpServer("Test Tcp Server", log.FATAL).Init(config)
+	testsuite.AssertNotNil(t, "Regular file must not be replaced by the socket", server.Start())
+	_, err = os.Stat(path)
+	testsuite.AssertNil(t, "Regular file must not be removed", err)
+}
@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// Size in bytes of the frame length header
+	FrameHeaderSize = 4
+	// Default maximum size of a single frame payload (4 MiB)
+	DefaultMaxFrameSize uint32 = 4 * 1024 * 1024
+)
+
+var (
+	// Error reported when a frame exceeds the configured maximum frame size
+	ErrFrameTooLarge = errors.New("Frame size exceeds the maximum allowed frame size")
+)
+
+// Describe capabilities of a message frame reader and writer component
+type FrameReaderWriter interface {
+	// Reads a complete frame payload from the underlying stream
+	ReadFrame() ([]byte, error)
+	// Writes the given payload as a single frame to the underlying stream
+	WriteFrame(data []byte) error
+	// Returns the maximum allowed frame payload size
+	MaxFrameSize() uint32
+}
+
+type lengthPrefixedFrameReaderWriter struct {
+	sync.Mutex
+	rw           io.ReadWriter
+	maxFrameSize uint32
+}
+
+func (f *lengthPrefixedFrameReaderWriter) ReadFrame() ([]byte, error) {
+	return ReadFrame(f.rw, f.maxFrameSize)
+}
+
+func (f *lengthPrefixedFrameReaderWriter) WriteFrame(data []byte) error {
+	defer f.Unlock()
+	f.Lock()
+	return WriteFrame(f.rw, data, f.maxFrameSize)
+}
+
+func (f *lengthPrefixedFrameReaderWriter) MaxFrameSize() uint32 {
+	return f.maxFrameSize
+}
+
+// Creates a new length-prefixed frame reader/writer: each frame is sent as a 4 bytes big-endian
+// payload length header followed by the payload. A zero maxFrameSize means DefaultMaxFrameSize.
+// Writes are serialized, so the component can be shared between multiple writing goroutines.
+func NewLengthPrefixedFrameReaderWriter(rw io.ReadWriter, maxFrameSize uint32) FrameReaderWriter {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	return &lengthPrefixedFrameReaderWriter{
+		rw:           rw,
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// Reads a single length-prefixed frame from the given reader.
+// It raises ErrFrameTooLarge if the header declares a payload bigger than maxFrameSize
+// (zero means DefaultMaxFrameSize).
+func ReadFrame(r io.Reader, maxFrameSize uint32) ([]byte, error) {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	var header = make([]byte, FrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	var size = binary.BigEndian.Uint32(header)
+	if size > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	var data = make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Writes the given data as a single length-prefixed frame to the given writer.
+// It raises ErrFrameTooLarge if the data is bigger than maxFrameSize (zero means DefaultMaxFrameSize).
+func WriteFrame(w io.Writer, data []byte, maxFrameSize uint32) error {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	if uint64(len(data)) > uint64(maxFrameSize) {
+		return ErrFrameTooLarge
+	}
+	var buff = make([]byte, FrameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buff, uint32(len(data)))
+	copy(buff[FrameHeaderSize:], data)
+	n, err := w.Write(buff)
+	if err == nil && n != len(buff) {
+		err = errors.New(fmt.Sprintf("Expected written <%v> bytes but wrote <%v>", len(buff), n))
+	}
+	return err
+}
+
+// Single message reader/writer/closer component: reading returns the request message body,
+// each write is sent back to the peer as a response message frame, with the request identifier.
+type messageRwCloser struct {
+	ctx     context.Context
+	request Message
+	reader  *bytes.Reader
+	frames  FrameReaderWriter
+	open    bool
+}
+
+func (m *messageRwCloser) Read(p []byte) (n int, err error) {
+	return m.reader.Read(p)
+}
+
+func (m *messageRwCloser) Write(p []byte) (n int, err error) {
+	if !m.open {
+		return 0, errors.New("ConnReaderWriterCloser.Write() - Error: Message stream is closed")
+	}
+	data, err := EncodeMessage(Message{
+		Type:   ResponseMessage,
+		Id:     m.request.Id,
+		Action: m.request.Action,
+		Body:   p,
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = m.frames.WriteFrame(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (m *messageRwCloser) Close() error {
+	m.open = false
+	return nil
+}
+
+func (m *messageRwCloser) Enroll(conn net.Conn) {
+}
+
+func (m *messageRwCloser) IsOpen() bool {
+	return m.open
+}
+
+func (m *messageRwCloser) IsReading() bool {
+	return true
+}
+
+func (m *messageRwCloser) IsFramed() bool {
+	return true
+}
+
+func (m *messageRwCloser) MessageId() string {
+	return m.request.Id
+}
+
+func (m *messageRwCloser) Action() string {
+	return m.request.Action
+}
+
+func (m *messageRwCloser) Context() context.Context {
+	return m.ctx
+}
+
+func (m *messageRwCloser) Wait() {
+}
+
+// Creates a ConnReaderWriterCloser bound to a single received request message: reads return the message body
+// and each write is sent to the peer as a response message, with the same identifier of the request,
+// using the given frame reader/writer. The given context is the connection one.
+func NewMessageReaderWriterCloser(ctx context.Context, request Message, frames FrameReaderWriter) ConnReaderWriterCloser {
+	return &messageRwCloser{
+		ctx:     ctx,
+		request: request,
+		reader:  bytes.NewReader(request.Body),
+		frames:  frames,
+		open:    true,
+	}
+}
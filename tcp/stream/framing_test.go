@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"github.com/hellgate75/go-network/testsuite"
+	"io"
+	"testing"
+)
+
+func TestWriteReadFrame(t *testing.T) {
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	var first = []byte("first message")
+	var second = []byte("second message")
+	err := WriteFrame(buff, first, 0)
+	testsuite.AssertNil(t, "First frame write error must be nil", err)
+	err = WriteFrame(buff, second, 0)
+	testsuite.AssertNil(t, "Second frame write error must be nil", err)
+	testsuite.AssertEquals(t, "Buffer must contain both frames", 2*FrameHeaderSize+len(first)+len(second), buff.Len())
+	data, err := ReadFrame(buff, 0)
+	testsuite.AssertNil(t, "First frame read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "First frame must be same", first, data)
+	data, err = ReadFrame(buff, 0)
+	testsuite.AssertNil(t, "Second frame read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Second frame must be same", second, data)
+	_, err = ReadFrame(buff, 0)
+	testsuite.AssertEquals(t, "Empty stream read must report EOF", io.EOF, err)
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	err := WriteFrame(buff, make([]byte, 16), 8)
+	testsuite.AssertEquals(t, "Oversized frame write must fail", ErrFrameTooLarge, err)
+	testsuite.AssertEquals(t, "Oversized frame must not be written", 0, buff.Len())
+	err = WriteFrame(buff, make([]byte, 16), 0)
+	testsuite.AssertNil(t, "Frame write error must be nil", err)
+	_, err = ReadFrame(buff, 8)
+	testsuite.AssertEquals(t, "Oversized frame read must fail", ErrFrameTooLarge, err)
+}
+
+func TestTruncatedFrame(t *testing.T) {
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	_ = WriteFrame(buff, []byte("truncated message"), 0)
+	var truncated = bytes.NewBuffer(buff.Bytes()[:buff.Len()-3])
+	_, err := ReadFrame(truncated, 0)
+	testsuite.AssertEquals(t, "Truncated frame read must report unexpected EOF", io.ErrUnexpectedEOF, err)
+}
+
+func TestMessageReaderWriterCloser(t *testing.T) {
+	var buff = bytes.NewBuffer(make([]byte, 0))
+	var frames = NewLengthPrefixedFrameReaderWriter(buff, 0)
+	testsuite.AssertEquals(t, "Max frame size must be the default one", DefaultMaxFrameSize, frames.MaxFrameSize())
+	var rw = NewMessageReaderWriterCloser(context.Background(), Message{Type: RequestMessage, Id: "id-1", Action: "sample", Body: []byte("request")}, frames)
+	testsuite.AssertEquals(t, "Component must be framed", true, rw.IsFramed())
+	testsuite.AssertEquals(t, "Component must report the request identifier", "id-1", rw.MessageId())
+	testsuite.AssertEquals(t, "Component must report the request action", "sample", rw.Action())
+	request := make([]byte, 7)
+	_, err := io.ReadFull(rw, request)
+	testsuite.AssertNil(t, "Message read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Request must be the message body", []byte("request"), request)
+	_, err = rw.Write([]byte("response"))
+	testsuite.AssertNil(t, "Message write error must be nil", err)
+	frame, err := frames.ReadFrame()
+	testsuite.AssertNil(t, "Response frame read error must be nil", err)
+	response, err := DecodeMessage(frame)
+	testsuite.AssertNil(t, "Response decode error must be nil", err)
+	testsuite.AssertEquals(t, "Response must be a response message", ResponseMessage, response.Type)
+	testsuite.AssertEquals(t, "Response must echo the request identifier", "id-1", response.Id)
+	testsuite.AssertEquals(t, "Response must echo the request action", "sample", response.Action)
+	testsuite.AssertByteArraysEquals(t, "Response body must be the written data", []byte("response"), response.Body)
+	_ = rw.Close()
+	_, err = rw.Write([]byte("response"))
+	testsuite.AssertNotNil(t, "Write on closed component must fail", err)
+}
+
+func TestEncodeDecodeMessage(t *testing.T) {
+	data, err := EncodeMessage(Message{Type: ErrorMessage, Id: "0f8fad5b-d9cb-469f-a165-70867728950e", Action: "sample", Code: "unknown-action", Body: []byte("{}")})
+	testsuite.AssertNil(t, "Message encode error must be nil", err)
+	msg, err := DecodeMessage(data)
+	testsuite.AssertNil(t, "Message decode error must be nil", err)
+	testsuite.AssertEquals(t, "Message type must be same", ErrorMessage, msg.Type)
+	testsuite.AssertEquals(t, "Message identifier must be same", "0f8fad5b-d9cb-469f-a165-70867728950e", msg.Id)
+	testsuite.AssertEquals(t, "Message action must be same", "sample", msg.Action)
+	testsuite.AssertEquals(t, "Message code must be same", "unknown-action", msg.Code)
+	testsuite.AssertByteArraysEquals(t, "Message body must be same", []byte("{}"), msg.Body)
+	_, err = DecodeMessage(data[:5])
+	testsuite.AssertNotNil(t, "Truncated message decode must fail", err)
+	_, err = DecodeMessage([]byte{99, 1, 0, 0})
+	testsuite.AssertNotNil(t, "Unknown message version decode must fail", err)
+}
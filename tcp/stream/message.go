@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Framed message type
+type MessageType byte
+
+const (
+	// Message sent from the client to the server
+	RequestMessage MessageType = iota + 1
+	// Message sent from the server to the client, answering a request
+	ResponseMessage
+	// Message sent from the server to the client, reporting a request failure
+	ErrorMessage
+	// Heartbeat message sent from the client to the server
+	PingMessage
+	// Message sent from the server to the client, answering a heartbeat message
+	PongMessage
+)
+
+const (
+	// Current framed message layout version
+	MessageVersion byte = 1
+)
+
+// Describe a single message exchanged within a frame
+type Message struct {
+	// Message type
+	Type MessageType
+	// Correlation identifier, a response carries the same identifier of the request
+	Id string
+	// Name of the requested action, a response carries the same action of the request
+	Action string
+	// Error code, for error messages
+	Code string
+	// Encoded message content, or error description for error messages
+	Body []byte
+}
+
+func writeMessageString(buff []byte, value string) []byte {
+	var size = make([]byte, 2)
+	binary.BigEndian.PutUint16(size, uint16(len(value)))
+	buff = append(buff, size...)
+	return append(buff, value...)
+}
+
+func readMessageString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", data, errors.New("Message header is truncated")
+	}
+	var size = int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+size {
+		return "", data, errors.New("Message header is truncated")
+	}
+	return string(data[2 : 2+size]), data[2+size:], nil
+}
+
+// Encodes a message in the frame payload layout: version, type, correlation identifier, action name,
+// error code and body
+func EncodeMessage(msg Message) ([]byte, error) {
+	for _, value := range []string{msg.Id, msg.Action, msg.Code} {
+		if len(value) > math.MaxUint16 {
+			return nil, errors.New(fmt.Sprintf("Message header field too long: %v bytes", len(value)))
+		}
+	}
+	var buff = make([]byte, 0, 8+len(msg.Id)+len(msg.Action)+len(msg.Code)+len(msg.Body))
+	buff = append(buff, MessageVersion, byte(msg.Type))
+	buff = writeMessageString(buff, msg.Id)
+	buff = writeMessageString(buff, msg.Action)
+	buff = writeMessageString(buff, msg.Code)
+	return append(buff, msg.Body...), nil
+}
+
+// Decodes a frame payload in a message
+func DecodeMessage(data []byte) (Message, error) {
+	var msg = Message{}
+	if len(data) < 2 {
+		return msg, errors.New("Message header is truncated")
+	}
+	if data[0] != MessageVersion {
+		return msg, errors.New(fmt.Sprintf("Unsupported message version: %v", data[0]))
+	}
+	msg.Type = MessageType(data[1])
+	var err error
+	var rest []byte
+	msg.Id, rest, err = readMessageString(data[2:])
+	if err != nil {
+		return msg, err
+	}
+	msg.Action, rest, err = readMessageString(rest)
+	if err != nil {
+		return msg, err
+	}
+	msg.Code, rest, err = readMessageString(rest)
+	if err != nil {
+		return msg, err
+	}
+	msg.Body = rest
+	return msg, nil
+}
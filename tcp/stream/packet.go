@@ -0,0 +1,168 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Single datagram connection: reads return the received packet, each write is sent back to the
+// packet sender as a new datagram
+type packetConn struct {
+	conn   net.PacketConn
+	addr   net.Addr
+	reader *bytes.Reader
+}
+
+func (p *packetConn) Read(b []byte) (n int, err error) {
+	return p.reader.Read(b)
+}
+
+func (p *packetConn) Write(b []byte) (n int, err error) {
+	return p.conn.WriteTo(b, p.addr)
+}
+
+func (p *packetConn) Close() error {
+	return nil
+}
+
+func (p *packetConn) LocalAddr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+func (p *packetConn) RemoteAddr() net.Addr {
+	return p.addr
+}
+
+func (p *packetConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *packetConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *packetConn) SetWriteDeadline(t time.Time) error {
+	return p.conn.SetWriteDeadline(t)
+}
+
+// Creates a net.Conn bound to a single datagram received on the given packet connection from the given address:
+// reads return the packet content and each write is sent to the address as a datagram. Closing it has no effect
+// on the packet connection.
+func NewPacketConn(conn net.PacketConn, addr net.Addr, packet []byte) net.Conn {
+	return &packetConn{
+		conn:   conn,
+		addr:   addr,
+		reader: bytes.NewReader(packet),
+	}
+}
+
+// Single datagram reader/writer/closer component: reading returns the packet content,
+// each write is sent back to the packet sender as a datagram.
+type packetRwCloser struct {
+	ctx    context.Context
+	conn   net.Conn
+	reader *bytes.Reader
+	open   bool
+}
+
+func (p *packetRwCloser) Read(b []byte) (n int, err error) {
+	return p.reader.Read(b)
+}
+
+func (p *packetRwCloser) Write(b []byte) (n int, err error) {
+	if !p.open {
+		return 0, errors.New("ConnReaderWriterCloser.Write() - Error: Packet stream is closed")
+	}
+	return p.conn.Write(b)
+}
+
+func (p *packetRwCloser) Close() error {
+	p.open = false
+	return nil
+}
+
+func (p *packetRwCloser) Enroll(conn net.Conn) {
+}
+
+func (p *packetRwCloser) IsOpen() bool {
+	return p.open
+}
+
+func (p *packetRwCloser) IsReading() bool {
+	return true
+}
+
+func (p *packetRwCloser) IsFramed() bool {
+	return false
+}
+
+func (p *packetRwCloser) MessageId() string {
+	return ""
+}
+
+func (p *packetRwCloser) Action() string {
+	return ""
+}
+
+func (p *packetRwCloser) Context() context.Context {
+	return p.ctx
+}
+
+func (p *packetRwCloser) Wait() {
+}
+
+// Creates a ConnReaderWriterCloser bound to a single received datagram: reads return the packet content
+// and each write is sent to the packet sender, using the given packet connection (see NewPacketConn).
+// The given context is the server one.
+func NewPacketReaderWriterCloser(ctx context.Context, conn net.Conn, packet []byte) ConnReaderWriterCloser {
+	return &packetRwCloser{
+		ctx:    ctx,
+		conn:   conn,
+		reader: bytes.NewReader(packet),
+		open:   true,
+	}
+}
+
+// Single datagram frame reader/writer component: the only frame read is the received packet,
+// each written frame is sent back to the packet sender as a datagram.
+type packetFrameReaderWriter struct {
+	conn         net.Conn
+	packet       []byte
+	maxFrameSize uint32
+}
+
+func (p *packetFrameReaderWriter) ReadFrame() ([]byte, error) {
+	if p.packet == nil {
+		return nil, io.EOF
+	}
+	var packet = p.packet
+	p.packet = nil
+	return packet, nil
+}
+
+func (p *packetFrameReaderWriter) WriteFrame(data []byte) error {
+	if uint32(len(data)) > p.maxFrameSize {
+		return ErrFrameTooLarge
+	}
+	_, err := p.conn.Write(data)
+	return err
+}
+
+func (p *packetFrameReaderWriter) MaxFrameSize() uint32 {
+	return p.maxFrameSize
+}
+
+// Creates a FrameReaderWriter bound to a single received datagram: the packet is read as a frame (a datagram
+// keeps its boundaries, so no length header is used) and each frame is written to the packet sender as a datagram,
+// using the given packet connection (see NewPacketConn).
+func NewPacketFrameReaderWriter(conn net.Conn, packet []byte, maxFrameSize uint32) FrameReaderWriter {
+	return &packetFrameReaderWriter{
+		conn:         conn,
+		packet:       packet,
+		maxFrameSize: maxFrameSize,
+	}
+}
@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"context"
+	"github.com/hellgate75/go-network/testsuite"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketReaderWriterCloser(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	testsuite.AssertNil(t, "Server listen error must be nil", err)
+	defer server.Close()
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	testsuite.AssertNil(t, "Client dial error must be nil", err)
+	defer client.Close()
+	var request = []byte("request packet")
+	_, err = client.Write(request)
+	testsuite.AssertNil(t, "Client write error must be nil", err)
+	var buff = make([]byte, 1024)
+	_ = server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := server.ReadFrom(buff)
+	testsuite.AssertNil(t, "Server read error must be nil", err)
+	var conn = NewPacketConn(server, addr, buff[:n])
+	var rwc = NewPacketReaderWriterCloser(context.Background(), conn, buff[:n])
+	testsuite.AssertEquals(t, "Packet stream must not be framed", false, rwc.IsFramed())
+	data, err := ioutil.ReadAll(rwc)
+	testsuite.AssertNil(t, "Packet read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Packet content must be same", request, data)
+	var response = []byte("response packet")
+	_, err = rwc.Write(response)
+	testsuite.AssertNil(t, "Packet write error must be nil", err)
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err = client.Read(buff)
+	testsuite.AssertNil(t, "Client read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Response packet must be same", response, buff[:n])
+	_ = rwc.Close()
+	_, err = rwc.Write(response)
+	testsuite.AssertNotNil(t, "Closed packet write error must not be nil", err)
+}
+
+func TestPacketFrameReaderWriter(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	testsuite.AssertNil(t, "Server listen error must be nil", err)
+	defer server.Close()
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	testsuite.AssertNil(t, "Client dial error must be nil", err)
+	defer client.Close()
+	var request = []byte("request packet")
+	_, _ = client.Write(request)
+	var buff = make([]byte, 1024)
+	_ = server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := server.ReadFrom(buff)
+	testsuite.AssertNil(t, "Server read error must be nil", err)
+	var frames = NewPacketFrameReaderWriter(NewPacketConn(server, addr, buff[:n]), buff[:n], 16)
+	frame, err := frames.ReadFrame()
+	testsuite.AssertNil(t, "Frame read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Frame must be the packet", request, frame)
+	_, err = frames.ReadFrame()
+	testsuite.AssertNotNil(t, "Packet must be read once", err)
+	testsuite.AssertNil(t, "Frame write error must be nil", frames.WriteFrame([]byte("response")))
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err = client.Read(buff)
+	testsuite.AssertNil(t, "Client read error must be nil", err)
+	testsuite.AssertByteArraysEquals(t, "Frame must be sent as a datagram", []byte("response"), buff[:n])
+	testsuite.AssertEquals(t, "Frames bigger than the maximum size must be rejected", ErrFrameTooLarge, frames.WriteFrame(make([]byte, 17)))
+}
@@ -2,6 +2,7 @@ package stream
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +19,15 @@ type ConnReaderWriterCloser interface {
 	IsOpen() bool
 	// Checks if a new stream is started and the component is reading data from the related connection
 	IsReading() bool
+	// Checks if the component delivers single length-prefixed frames, instead of the raw connection stream
+	IsFramed() bool
+	// Returns the correlation identifier of the message in progress, or empty for raw streams
+	MessageId() string
+	// Returns the name of the action requested by the message in progress, or empty for raw streams
+	Action() string
+	// Returns the connection context, cancelled when the remote peer closes the connection
+	// or the component is closed
+	Context() context.Context
 	// Wait for a new connection is read for the first time
 	Wait()
 }
@@ -26,6 +36,8 @@ type rwCloser struct{
 	buffer		*bytes.Buffer
 	running		bool
 	reading		bool
+	ctx			context.Context
+	cancel		context.CancelFunc
 }
 
 func (rwc *rwCloser) Read(p []byte) (n int, err error) {
@@ -55,6 +67,22 @@ func (rwc *rwCloser) IsReading() bool {
 	return rwc.reading
 }
 
+func (rwc *rwCloser) IsFramed() bool {
+	return false
+}
+
+func (rwc *rwCloser) MessageId() string {
+	return ""
+}
+
+func (rwc *rwCloser) Action() string {
+	return ""
+}
+
+func (rwc *rwCloser) Context() context.Context {
+	return rwc.ctx
+}
+
 func (rwc *rwCloser) Wait() {
 	for ! rwc.reading {
 		time.Sleep(250 * time.Millisecond)
@@ -69,6 +97,7 @@ func (rwc *rwCloser) Close() error {
 		}
 	}()
 	rwc.running = false
+	rwc.cancel()
 	rwc.buffer.Reset()
 	return err
 }
@@ -91,6 +120,10 @@ func (rwc *rwCloser) readFrom(conn net.Conn) {
 			readCount += int64(n)
 			n, err = conn.Read(data)
 		}
+		if err == io.EOF {
+			// Remote peer closed the connection
+			rwc.cancel()
+		}
 		if err != nil {
 			time.Sleep(250 * time.Microsecond)
 			continue
@@ -117,7 +150,15 @@ func (rwc *rwCloser) Enroll(conn net.Conn) {
 }
 
 func NewConnReaderWriterCloser() ConnReaderWriterCloser {
+	return NewConnReaderWriterCloserContext(context.Background())
+}
+
+// Creates a ConnReaderWriterCloser whose connection context is derived from the given one
+func NewConnReaderWriterCloserContext(parent context.Context) ConnReaderWriterCloser {
+	ctx, cancel := context.WithCancel(parent)
 	return &rwCloser{
+		ctx: ctx,
+		cancel: cancel,
 		running: false,
 		reading: false,
 		buffer: bytes.NewBuffer(make([]byte, 0)),